@@ -22,6 +22,7 @@ import (
 	"strconv"
 
 	build "github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/cache"
 	"github.com/commonjava/indy-tests/pkg/common"
 
 	"github.com/spf13/cobra"
@@ -30,6 +31,9 @@ import (
 // example: http://orchhost/pnc-rest/v2/builds/97241/logs/build
 var targetIndy, repoReplPattern, buildType string
 var processNum int
+var upload build.UploadOptions
+var journalFile, resume string
+var speed float64
 
 const DEFAULT_PROCESS_NUM = 1
 const DEFAULT_REPO_REPL_PATTERN = ""
@@ -40,7 +44,14 @@ func NewBuildTestCmd() *cobra.Command {
 	exec := &cobra.Command{
 		Use:   "build $indy_url $folo_track_id",
 		Short: "To do a build test by 'replay' a pnc successful build through its folo tracking record",
+		Example: `build http://indy.xyz.com build-12345 -t http://indy-test.xyz.com
+build --resume /tmp/journal/build-913413.jsonl`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if !common.IsEmptyString(resume) {
+				checkEnvVars()
+				build.Resume(resume, processNum, upload, speed)
+				return
+			}
 			if !validate(args) {
 				cmd.Help()
 				os.Exit(1)
@@ -53,13 +64,20 @@ func NewBuildTestCmd() *cobra.Command {
 				fmt.Printf("targetIndy is not specified, will use the same one as the $indy_url: %s\n", indyURL)
 				targetIndy = indyURL
 			}
-			build.Run(indyURL, foloTrackId, "", targetIndy, buildType, processNum)
+			build.Run(indyURL, foloTrackId, "", targetIndy, buildType, processNum, upload, journalFile, speed)
 		},
 	}
 
 	exec.Flags().StringVarP(&targetIndy, "targetIndy", "t", "", "The target indy server to do the testing. Will get from this flag or from env variables 'INDY_TARGET' if flag is not specified. If both are not specified, will use $indy_url.")
 	exec.Flags().StringVarP(&buildType, "buildType", "b", DEFAULT_BUILD_TYPE, "The type of the build, should be 'maven' or 'npm'. Default is 'maven'.")
 	exec.Flags().IntVarP(&processNum, "processNum", "p", DEFAULT_PROCESS_NUM, "The number of processes to download and upload files in parralel.")
+	exec.Flags().BoolVar(&upload.Stream, "stream", false, "Pipe the uploads from the original indy to the target indy, without caching them on the local disk.")
+	exec.Flags().Int64Var(&upload.MemoryLimit, "streamMemLimit", build.DEFAULT_STREAM_MEMORY_LIMIT, "Max size in bytes of an upload to read into memory with --stream, so that it can be retried. Bigger ones are piped.")
+	exec.Flags().Float64Var(&speed, "speed", 0, "Replay the downloads and uploads at their times in the folo record, this times faster, e.g, 1, 2, 10. 0 means as fast as possible, downloads first.")
+	exec.Flags().StringVar(&journalFile, "journal", "", "The file to record the progress of the build, for --resume. Default is journal/<build>.jsonl in $TEST_MOUNT_PATH or /tmp.")
+	exec.Flags().StringVar(&resume, "resume", "", "Resume the failed build of the journal file with the same build name, skipping the verified artifacts. $indy_url and $folo_track_id are not needed.")
+	exec.Flags().StringVar(&upload.CacheDir, "cacheDir", cache.DefaultDir(), "The dir of the cache of the uploads, shared by the runs and the builds with the same content.")
+	exec.Flags().Int64Var(&upload.CacheMaxSize, "cacheMaxSize", cache.DEFAULT_MAX_SIZE, "Max size in bytes of the cache. The least recently used files are evicted beyond it. 0 means no limit.")
 
 	return exec
 }
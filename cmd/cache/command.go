@@ -0,0 +1,98 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/cache"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var cacheDir string
+var maxSize int64
+
+func NewCacheCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "cache",
+		Short: "To manage the cache of the uploads shared by the build tests",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	exec.PersistentFlags().StringVar(&cacheDir, "cacheDir", cache.DefaultDir(), "The dir of the cache.")
+
+	exec.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "Print the number and the total size of the cached files",
+		Run: func(cmd *cobra.Command, args []string) {
+			s, err := cache.Open(cacheDir, 0).Stats()
+			if err != nil {
+				fmt.Printf("Error: cannot read cache %s, %s\n", cacheDir, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Cache: %s\n", cacheDir)
+			fmt.Printf("Files: %d\n", s.Objects)
+			fmt.Printf("Size: %s\n", common.ByteCountSI(s.Size))
+			if s.Objects > 0 {
+				fmt.Printf("Least recently used: %s\n", s.Oldest.Format(time.RFC3339))
+				fmt.Printf("Most recently used: %s\n", s.Newest.Format(time.RFC3339))
+			}
+		},
+	})
+
+	exec.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Check the content of the cached files against their checksums, and remove the corrupted ones",
+		Run: func(cmd *cobra.Command, args []string) {
+			checked, corrupted, err := cache.Open(cacheDir, 0).Verify()
+			if err != nil {
+				fmt.Printf("Error: cannot read cache %s, %s\n", cacheDir, err)
+				os.Exit(1)
+			}
+			for _, key := range corrupted {
+				fmt.Printf("Corrupted, removed: %s\n", key)
+			}
+			fmt.Printf("Verified %d cached files, corrupted: %d\n", checked, len(corrupted))
+			if len(corrupted) > 0 {
+				os.Exit(1)
+			}
+		},
+	})
+
+	prune := &cobra.Command{
+		Use:     "prune",
+		Short:   "Remove the least recently used files until the cache is within the max size",
+		Example: "cache prune --maxSize 0",
+		Run: func(cmd *cobra.Command, args []string) {
+			removed, freed, err := cache.Open(cacheDir, 0).Prune(maxSize)
+			if err != nil {
+				fmt.Printf("Error: cannot prune cache %s, %s\n", cacheDir, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed %d cached files, freed: %s\n", removed, common.ByteCountSI(freed))
+		},
+	}
+	prune.Flags().Int64Var(&maxSize, "maxSize", cache.DEFAULT_MAX_SIZE, "Max size in bytes of the cache after pruning. 0 removes all.")
+	exec.AddCommand(prune)
+
+	return exec
+}
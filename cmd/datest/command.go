@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/commonjava/indy-tests/pkg/datest"
 
@@ -28,12 +29,17 @@ import (
 
 var targetIndy, daGroup, dataDir string
 var processNum int
+var opts datest.Options
+var stages string
 
 func NewDATestCmd() *cobra.Command {
 
 	exec := &cobra.Command{
-		Use:   "datest $targetIndy $daGroup $processNum",
+		Use:   "datest $targetIndy $daGroup $dataDir $processNum",
 		Short: "To do a da test based on the alignment logs from PNC build",
+		Example: `datest http://indy.xyz.com DA /data/da-logs/ 10
+datest http://indy.xyz.com DA /data/da-logs/ 200 --rps 50 --duration 5m --selection weighted
+datest http://indy.xyz.com DA /data/da-logs/ 200 --stages 1m:20,5m:100,1m:0`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
@@ -43,15 +49,34 @@ func NewDATestCmd() *cobra.Command {
 			if err == nil {
 				fmt.Println(processNum)
 			}
-			datest.Run(args[0], args[1], args[2], processNum)
+			stageList, err := datest.ParseStages(stages)
+			if err == nil {
+				opts.Load.Stages = stageList
+				err = opts.Load.Validate()
+			}
+			if err != nil {
+				fmt.Printf("Error: %s\n\n", err)
+				cmd.Help()
+				os.Exit(1)
+			}
+			datest.Run(args[0], args[1], args[2], processNum, opts)
 		},
 	}
 
+	exec.Flags().StringVar(&opts.StatsFile, "statsFile", "", "The file to write the latency statistics as JSON, for tracking the trend across runs.")
+	exec.Flags().Float64Var(&opts.Load.RPS, "rps", 0, "Open-model load: send requests at this constant rate for the duration, regardless of the responses. processNum is the max requests in flight.")
+	exec.Flags().DurationVar(&opts.Load.Duration, "duration", 0, "Duration of the constant rate load.")
+	exec.Flags().StringVar(&stages, "stages", "", "Open-model load with ramp-up/ramp-down stages, e.g, '30s:10,2m:50,30s:0' ramps to 10 rps in 30s, to 50 rps in 2m, then down to 0 in 30s.")
+	exec.Flags().StringVar(&opts.Load.Selection, "selection", datest.SELECTION_REPLAY, "URL selection of the open-model load, 'replay' in order or 'weighted' random by the times a GA appears in the logs.")
+	exec.Flags().DurationVar(&opts.Load.Window, "window", 10*time.Second, "Interval of the timeline statistics of the open-model load.")
+	exec.Flags().Int64Var(&opts.Load.Seed, "seed", 0, "Random seed of the weighted selection, for reproducible runs. 0 means random.")
+	exec.Flags().Float64Var(&opts.FailureThreshold, "failureThreshold", 0, "Max percentage (0 to 100) of failed lookups, above which the test fails. 404 is not a failure.")
+
 	return exec
 }
 
 func validate(args []string) bool {
-	if len(args) <= 2 {
+	if len(args) < 4 {
 		fmt.Printf("there are at least 4 non-empty arguments: targetIndy, daGroup, dataDir, processNum!\n\n")
 		return false
 	}
@@ -20,16 +20,27 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/cache"
 	"github.com/commonjava/indy-tests/pkg/integrationtest"
+	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
 	"github.com/spf13/cobra"
 )
 
+var poll integrationtest.PollOptions
+var group bool
+var parallel int
+var upload buildtest.UploadOptions
+var promoteMode string
+
 func NewIntegrationTestCmd() *cobra.Command {
 
 	exec := &cobra.Command{
-		Use:     "integrationtest $indyBaseUrl $datasetRepoUrl $buildId $promoteTargetStore $metaCheckRepo(optional) --dryRun(optional)",
-		Short:   "To run integration test",
-		Example: "integrationtest http://indy.xyz.com https://gitlab.xyz.com/nos/nos-integrationtest-dataset 2836 test-builds",
+		Use:   "integrationtest $indyBaseUrl $datasetRepoUrl $buildId $promoteTargetStore $metaCheckRepo(optional) --dryRun(optional)",
+		Short: "To run integration test",
+		Example: `integrationtest http://indy.xyz.com https://gitlab.xyz.com/nos/nos-integrationtest-dataset 2836 test-builds
+integrationtest http://indy.xyz.com https://gitlab.xyz.com/nos/nos-integrationtest-dataset 12327 test-builds --group --parallel 3`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
@@ -42,13 +53,28 @@ func NewIntegrationTestCmd() *cobra.Command {
 			if len(args) >= 5 {
 				metaCheckRepo = args[4]
 			}
-			integrationtest.Run(args[0], args[1], args[2], args[3], metaCheckRepo, clearCache, dryRun, keepPod)
+			if group {
+				if !integrationtest.RunGroup(args[0], args[1], args[2], args[3], metaCheckRepo, promoteMode, parallel, clearCache, dryRun, poll, upload) {
+					report.Exit(1)
+				}
+				return
+			}
+			integrationtest.Run(args[0], args[1], args[2], args[3], metaCheckRepo, promoteMode, clearCache, dryRun, keepPod, poll, upload)
 		},
 	}
 
 	exec.Flags().BoolP("clearCache", "c", false, "Clear cached built artifact files. This will force download from origin again.")
 	exec.Flags().BoolP("dryRun", "d", false, "Print msg for repo creation, down/upload, promote, and clean up, without really doing it.")
 	exec.Flags().BoolP("keepPod", "k", false, "Keep the pod after test to debug.")
+	exec.Flags().BoolVar(&group, "group", false, "The buildId is a group build. Run all the builds in it following the dependency graph.")
+	exec.Flags().IntVar(&parallel, "parallel", 2, "Max builds to run at a time on independent branches of the dependency graph, with --group.")
+	exec.Flags().StringVar(&promoteMode, "promoteMode", promotetest.MODE_PATHS, "'paths' to promote the uploaded paths to the promoteTargetStore hosted repo, or 'group' to add the build repo to the promoteTargetStore group.")
+	exec.Flags().DurationVar(&poll.Timeout, "metadataTimeout", integrationtest.DEFAULT_POLL_TIMEOUT, "Max time to wait for the metadata to change after promotion and rollback.")
+	exec.Flags().DurationVar(&poll.Interval, "metadataPollInterval", integrationtest.DEFAULT_POLL_INTERVAL, "Interval of checking the metadata after promotion and rollback.")
+	exec.Flags().BoolVar(&upload.Stream, "stream", false, "Pipe the uploads from the original indy to the target indy, without caching them on the local disk.")
+	exec.Flags().Int64Var(&upload.MemoryLimit, "streamMemLimit", buildtest.DEFAULT_STREAM_MEMORY_LIMIT, "Max size in bytes of an upload to read into memory with --stream, so that it can be retried. Bigger ones are piped.")
+	exec.Flags().StringVar(&upload.CacheDir, "cacheDir", cache.DefaultDir(), "The dir of the cache of the uploads, shared by the runs and the builds with the same content.")
+	exec.Flags().Int64Var(&upload.CacheMaxSize, "cacheMaxSize", cache.DEFAULT_MAX_SIZE, "Max size in bytes of the cache. The least recently used files are evicted beyond it. 0 means no limit.")
 
 	return exec
 }
@@ -58,5 +84,9 @@ func validate(args []string) bool {
 		fmt.Printf("There are 4 mandatory arguments: indyBaseUrl, datasetRepoUrl, buildId, promoteTargetStore!\n")
 		return false
 	}
+	if promoteMode != promotetest.MODE_PATHS && promoteMode != promotetest.MODE_GROUP {
+		fmt.Printf("Unknown promoteMode %s, should be %s or %s!\n", promoteMode, promotetest.MODE_PATHS, promotetest.MODE_GROUP)
+		return false
+	}
 	return true
 }
@@ -0,0 +1,120 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package login
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+var entry common.AuthEntry
+
+func NewLoginCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "login $baseUrl",
+		Short: "To save the credential (basic, bearer token or oidc client credentials) for an indy or pnc server, which is used by all the following requests to it",
+		Example: `login http://indy.xyz.com --type basic --username jdoe --password secret
+login https://orch.xyz.com --type bearer --token eyJhbGciOi...
+login https://indy.xyz.com --type oidc --tokenUrl https://sso.xyz.com/auth/realms/x/protocol/openid-connect/token --clientId indy-test --clientSecret secret`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 || common.IsEmptyString(args[0]) {
+				fmt.Printf("baseUrl is not specified!\n\n")
+				cmd.Help()
+				os.Exit(1)
+			}
+			entry.BaseURL = args[0]
+			checkEnvVars()
+			if err := entry.Validate(); err != nil {
+				fmt.Printf("Error: %s\n\n", err)
+				cmd.Help()
+				os.Exit(1)
+			}
+			if err := common.VerifyAuthEntry(entry); err != nil {
+				fmt.Printf("Error: login failed, %s\n", err)
+				os.Exit(1)
+			}
+			configFile := authConfigFile(cmd)
+			if err := common.SaveAuthEntry(configFile, entry); err != nil {
+				fmt.Printf("Error: cannot save credential to %s, %s\n", configFile, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Login succeeded, %s credential for %s is saved to %s\n", entry.Type, common.NormIndyURL(entry.BaseURL), configFile)
+		},
+	}
+
+	exec.Flags().StringVarP(&entry.Type, "type", "t", common.AUTH_BASIC, "The auth type, should be 'basic', 'bearer' or 'oidc'.")
+	exec.Flags().StringVarP(&entry.Username, "username", "u", "", "The username for basic auth.")
+	exec.Flags().StringVarP(&entry.Password, "password", "p", "", "The password for basic auth. Will get from env variable 'INDY_TEST_PASSWORD' if not specified.")
+	exec.Flags().StringVar(&entry.Token, "token", "", "The static bearer token. Will get from env variable 'INDY_TEST_TOKEN' if not specified.")
+	exec.Flags().StringVar(&entry.TokenURL, "tokenUrl", "", "The oidc token endpoint for the client credentials flow.")
+	exec.Flags().StringVar(&entry.ClientID, "clientId", "", "The oidc client id.")
+	exec.Flags().StringVar(&entry.ClientSecret, "clientSecret", "", "The oidc client secret. Will get from env variable 'INDY_TEST_CLIENT_SECRET' if not specified.")
+	exec.Flags().StringVar(&entry.Scope, "scope", "", "The oidc scope to request, optional.")
+
+	return exec
+}
+
+func NewLogoutCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "logout $baseUrl",
+		Short: "To remove the saved credential for an indy or pnc server",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 || common.IsEmptyString(args[0]) {
+				fmt.Printf("baseUrl is not specified!\n\n")
+				cmd.Help()
+				os.Exit(1)
+			}
+			configFile := authConfigFile(cmd)
+			removed, err := common.RemoveAuthEntry(configFile, args[0])
+			if err != nil {
+				fmt.Printf("Error: cannot update %s, %s\n", configFile, err)
+				os.Exit(1)
+			}
+			if removed {
+				fmt.Printf("Logout succeeded for %s\n", args[0])
+			} else {
+				fmt.Printf("No credential found for %s\n", args[0])
+			}
+		},
+	}
+
+	return exec
+}
+
+func authConfigFile(cmd *cobra.Command) string {
+	if f, err := cmd.Flags().GetString("auth-config"); err == nil && !common.IsEmptyString(f) {
+		return f
+	}
+	return common.DefaultAuthConfigFile()
+}
+
+func checkEnvVars() {
+	if common.IsEmptyString(entry.Password) {
+		entry.Password = os.Getenv("INDY_TEST_PASSWORD")
+	}
+	if common.IsEmptyString(entry.Token) {
+		entry.Token = os.Getenv("INDY_TEST_TOKEN")
+	}
+	if common.IsEmptyString(entry.ClientSecret) {
+		entry.ClientSecret = os.Getenv("INDY_TEST_CLIENT_SECRET")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockpnc
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockpnc"
+	"github.com/spf13/cobra"
+)
+
+var listenAddr string
+
+const DEFAULT_LISTEN_ADDR = ":8080"
+
+func NewMockPNCCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:     "mock-pnc $dataDir",
+		Short:   "To serve recorded PNC fixtures (builds, group builds, dependency graphs, align logs and folo reports) from a local directory",
+		Example: "mock-pnc pkg/dataset/testdata/pnc --listen :8080",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !validate(args) {
+				cmd.Help()
+				os.Exit(1)
+			}
+			if err := mockpnc.ListenAndServe(listenAddr, args[0]); err != nil {
+				fmt.Printf("Mock PNC server stopped: %s\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	exec.Flags().StringVarP(&listenAddr, "listen", "l", DEFAULT_LISTEN_ADDR, "The address to listen on.")
+
+	return exec
+}
+
+func validate(args []string) bool {
+	if len(args) < 1 || common.IsEmptyString(args[0]) {
+		fmt.Printf("dataDir is not specified!\n\n")
+		return false
+	}
+	if !common.FileOrDirExists(args[0]) {
+		fmt.Printf("dataDir %s does not exist!\n\n", args[0])
+		return false
+	}
+	return true
+}
@@ -25,6 +25,8 @@ import (
 )
 
 var targetIndy, trackingId, promoteTarget string
+var mode string
+var async promotetest.AsyncOptions
 
 func NewPromoteTestCmd() *cobra.Command {
 
@@ -32,15 +34,22 @@ func NewPromoteTestCmd() *cobra.Command {
 		Use:   "promote $targetIndy $foloTrackId $promoteTarget",
 		Short: "To do a promote test with an existed folo tracking report and an target indy hosted repo",
 		Run: func(cmd *cobra.Command, args []string) {
-			if !validate(args) {
+			if !validate(args) || !validateMode() {
 				cmd.Help()
 				os.Exit(1)
 			}
 
-			promotetest.Run(args[0], args[1], args[2])
+			promotetest.Run(args[0], args[1], args[2], mode, async)
 		},
 	}
 
+	exec.Flags().StringVar(&mode, "mode", promotetest.MODE_PATHS, "'paths' to promote the uploaded paths to the target hosted repo, or 'group' to add the build repo to the target group.")
+	exec.Flags().BoolVar(&async.Enabled, "async", false, "Promote asynchronously, and wait for the result after the request is accepted.")
+	exec.Flags().StringVar(&async.Callback, "callback", "", "Listen address of a local receiver for the result posted by indy, e.g, ':8090'. Poll the result from indy if not set.")
+	exec.Flags().StringVar(&async.CallbackURL, "callbackUrl", "", "The url for indy to post the result to, default http://<hostname>:<port>/promotion/callback of the receiver.")
+	exec.Flags().DurationVar(&async.PollInterval, "pollInterval", promotetest.DEFAULT_POLL_INTERVAL, "Interval of polling the result of the async promotion.")
+	exec.Flags().DurationVar(&async.Timeout, "timeout", promotetest.DEFAULT_ASYNC_TIMEOUT, "Max time to wait for the async promotion to be done.")
+
 	return exec
 }
 
@@ -51,3 +60,15 @@ func validate(args []string) bool {
 	}
 	return true
 }
+
+func validateMode() bool {
+	if mode != promotetest.MODE_PATHS && mode != promotetest.MODE_GROUP {
+		fmt.Printf("Unknown mode %s, should be %s or %s!\n\n", mode, promotetest.MODE_PATHS, promotetest.MODE_GROUP)
+		return false
+	}
+	if mode == promotetest.MODE_GROUP && async.Enabled {
+		fmt.Printf("--async is only supported in %s mode!\n\n", promotetest.MODE_PATHS)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/spf13/cobra"
+)
+
+var rules map[string]string
+
+func NewPromoteRulesCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "promote-rules $targetIndy $promoteTarget",
+		Short: "To check that indy rejects the promotions violating the validation rules of the target hosted repo",
+		Example: `promote-rules http://indy.example.com pnc-builds
+promote-rules http://indy.example.com maven:hosted:pnc-builds --rule missing-pom=project-artifacts.groovy`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				fmt.Printf("there are 2 non-empty arguments: targetIndy, promoteTarget!\n\n")
+				cmd.Help()
+				os.Exit(1)
+			}
+			for name := range rules {
+				if _, ok := promotetest.DEFAULT_RULES[name]; !ok {
+					fmt.Printf("Unknown rule case %s, should be one of %s!\n\n", name, strings.Join(promotetest.RULE_CASES, ", "))
+					os.Exit(1)
+				}
+			}
+			promotetest.RunRules(args[0], args[1], rules)
+		},
+	}
+
+	exec.Flags().StringToStringVar(&rules, "rule", nil, fmt.Sprintf("The rule expected to reject a case, e.g, 'snapshot=no-snapshots.groovy'. Cases: %s.",
+		strings.Join(promotetest.RULE_CASES, ", ")))
+
+	return exec
+}
@@ -0,0 +1,53 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/spf13/cobra"
+)
+
+var stress promotetest.StressOptions
+
+func NewPromoteStressCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "promote-stress $originalIndy $foloTrackId $targetIndy $promoteTarget",
+		Short: "To replay a build several times and promote the builds to one target at once, with overlapping and disjoint paths",
+		Example: `promote-stress http://orig-indy.example.com build-1234 http://indy.example.com pnc-builds
+promote-stress http://orig-indy.example.com build-1234 http://indy.example.com maven:hosted:pnc-builds --builds 5 --copies 4`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 4 {
+				fmt.Printf("there are 4 non-empty arguments: originalIndy, foloTrackId, targetIndy, promoteTarget!\n\n")
+				cmd.Help()
+				os.Exit(1)
+			}
+			promotetest.RunStress(args[0], args[1], args[2], args[3], stress)
+		},
+	}
+
+	exec.Flags().IntVar(&stress.Builds, "builds", promotetest.DEFAULT_STRESS_BUILDS, "The number of builds replayed from the folo record, each with its own version, i.e, disjoint paths.")
+	exec.Flags().IntVar(&stress.Copies, "copies", promotetest.DEFAULT_STRESS_COPIES, "The number of concurrent promotions of each build, with the same, i.e, overlapping paths.")
+	exec.Flags().IntVarP(&stress.ProcessNum, "processNum", "p", promotetest.DEFAULT_STRESS_ROUTINES, "The number of processes to download and upload files in parralel for each build.")
+	exec.Flags().DurationVar(&stress.PollInterval, "pollInterval", promotetest.DEFAULT_POLL_INTERVAL, "Interval of checking the target after the promotions and the rollbacks.")
+	exec.Flags().DurationVar(&stress.Timeout, "timeout", promotetest.DEFAULT_STRESS_TIMEOUT, "Max time to wait for the target to be as expected after the promotions and the rollbacks.")
+
+	return exec
+}
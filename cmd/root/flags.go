@@ -0,0 +1,92 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+// Global options shared by all the commands
+var (
+	retryPolicy = common.DefaultRetryPolicy
+	tlsOptions  common.TLSOptions
+	transport   = common.DefaultTransportOptions
+	authConfig  string
+	reportDir   string
+)
+
+func addGlobalFlags(rootCmd *cobra.Command) {
+	flags := rootCmd.PersistentFlags()
+	flags.IntVar(&retryPolicy.MaxAttempts, "retry-attempts", retryPolicy.MaxAttempts, "Max attempts of each http request, including the first one. 1 means no retry.")
+	flags.DurationVar(&retryPolicy.BaseDelay, "retry-base", retryPolicy.BaseDelay, "Base delay of the exponential backoff between retries.")
+	flags.DurationVar(&retryPolicy.MaxDelay, "retry-cap", retryPolicy.MaxDelay, "Max delay between retries.")
+	flags.Float64Var(&retryPolicy.Jitter, "retry-jitter", retryPolicy.Jitter, "Fraction (0 to 1) of the backoff delay to randomize.")
+	flags.IntSliceVar(&retryPolicy.RetryableStatus, "retry-status", retryPolicy.RetryableStatus, "Response status codes to retry.")
+	flags.BoolVar(&retryPolicy.RetryNonIdempotent, "retry-non-idempotent", false, "Also retry non-idempotent requests, e.g, POST of promotion.")
+
+	flags.StringVar(&tlsOptions.CACert, "ca-cert", "", "PEM file of extra CA certificates to trust for https indy/pnc servers.")
+	flags.StringVar(&tlsOptions.ClientCert, "client-cert", "", "PEM file of the client certificate for mutual TLS. Must be used with --client-key.")
+	flags.StringVar(&tlsOptions.ClientKey, "client-key", "", "PEM file of the client private key for mutual TLS.")
+	flags.BoolVar(&tlsOptions.InsecureSkipVerify, "insecure-skip-verify", false, "Skip verifying the server certificate. Only for testing!")
+
+	flags.IntVar(&transport.MaxIdleConns, "max-idle-conns", transport.MaxIdleConns, "Max idle (keep-alive) connections across all hosts.")
+	flags.IntVar(&transport.MaxIdleConnsPerHost, "max-idle-conns-per-host", transport.MaxIdleConnsPerHost, "Max idle (keep-alive) connections to each host.")
+	flags.IntVar(&transport.MaxConnsPerHost, "max-conns-per-host", transport.MaxConnsPerHost, "Max connections to each host, including the active ones. 0 means no limit.")
+	flags.DurationVar(&transport.DialTimeout, "dial-timeout", transport.DialTimeout, "Timeout of establishing a tcp connection.")
+	flags.DurationVar(&transport.TLSHandshakeTimeout, "tls-handshake-timeout", transport.TLSHandshakeTimeout, "Timeout of the TLS handshake.")
+	flags.DurationVar(&transport.ResponseHeaderTimeout, "response-header-timeout", transport.ResponseHeaderTimeout, "Timeout of waiting for the response headers after the request is sent.")
+	flags.DurationVar(&transport.IdleConnTimeout, "idle-conn-timeout", transport.IdleConnTimeout, "How long an idle connection is kept in the pool.")
+	flags.DurationVar(&transport.Timeout, "request-timeout", transport.Timeout, "Overall timeout of each http request, including reading the response body. 0 means no limit.")
+	flags.DurationVar(&transport.TCPKeepAlive, "tcp-keep-alive", transport.TCPKeepAlive, "Interval of tcp keep-alive probes. Negative value disables them.")
+	flags.BoolVar(&transport.DisableKeepAlives, "disable-keep-alives", false, "Use a new connection for each request.")
+	flags.BoolVar(&transport.DisableHTTP2, "disable-http2", false, "Use HTTP/1.1 only, like the maven http wagon.")
+
+	flags.StringVar(&reportDir, "report-dir", "", "The directory to write the run report as report.json and junit.xml. No report if not specified.")
+	flags.StringVar(&authConfig, "auth-config", common.DefaultAuthConfigFile(), "The file of credentials saved by the login command. Will get from env variable 'INDY_TEST_AUTH_CONFIG' if not specified.")
+}
+
+// applyGlobalFlags is called before any command runs
+func applyGlobalFlags(cmd *cobra.Command, args []string) {
+	common.SetRetryPolicy(retryPolicy)
+	common.ConfigureTransport(transport)
+	if err := common.ConfigureTLS(tlsOptions); err != nil {
+		fmt.Printf("Error: invalid TLS options, %s\n", err)
+		os.Exit(1)
+	}
+	entries, err := common.LoadAuthConfig(authConfig)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
+	common.SetAuthEntries(entries)
+	report.Start(cmd.Name(), args, reportDir)
+}
+
+// reportGlobalStats is called after the command finishes
+func reportGlobalStats(cmd *cobra.Command, args []string) {
+	common.PrintRetryStats()
+	common.PrintTimingStats()
+	if err := report.Write(); err != nil {
+		fmt.Printf("Error: cannot write report, %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"os"
 
 	"github.com/commonjava/indy-tests/cmd/buildtest"
+	"github.com/commonjava/indy-tests/cmd/cache"
 	"github.com/commonjava/indy-tests/cmd/dataset"
 	"github.com/commonjava/indy-tests/cmd/datest"
 	"github.com/commonjava/indy-tests/cmd/integrationtest"
+	"github.com/commonjava/indy-tests/cmd/login"
+	"github.com/commonjava/indy-tests/cmd/mockpnc"
 	"github.com/commonjava/indy-tests/cmd/promotetest"
+	"github.com/commonjava/indy-tests/cmd/scenario"
 	"github.com/spf13/cobra"
 )
 
@@ -19,12 +23,22 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 		},
+		PersistentPreRun:  applyGlobalFlags,
+		PersistentPostRun: reportGlobalStats,
 	}
+	addGlobalFlags(rootCmd)
 	rootCmd.AddCommand(buildtest.NewBuildTestCmd())
 	rootCmd.AddCommand(promotetest.NewPromoteTestCmd())
+	rootCmd.AddCommand(promotetest.NewPromoteRulesCmd())
+	rootCmd.AddCommand(promotetest.NewPromoteStressCmd())
 	rootCmd.AddCommand(datest.NewDATestCmd())
 	rootCmd.AddCommand(dataset.NewDatasetCmd())
 	rootCmd.AddCommand(integrationtest.NewIntegrationTestCmd())
+	rootCmd.AddCommand(scenario.NewScenarioCmd())
+	rootCmd.AddCommand(cache.NewCacheCmd())
+	rootCmd.AddCommand(mockpnc.NewMockPNCCmd())
+	rootCmd.AddCommand(login.NewLoginCmd())
+	rootCmd.AddCommand(login.NewLogoutCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
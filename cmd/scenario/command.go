@@ -0,0 +1,74 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package scenario
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/commonjava/indy-tests/pkg/scenario"
+	"github.com/spf13/cobra"
+)
+
+func NewScenarioCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "scenario",
+		Short: "To run a test flow declared in a YAML scenario file",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	exec.AddCommand(&cobra.Command{
+		Use:     "run $scenarioFile",
+		Short:   "Run the steps of the scenario in order and check the assertions",
+		Example: "scenario run scenarios/integrationtest.yaml --report-dir=build/report",
+		Run: func(cmd *cobra.Command, args []string) {
+			s := load(cmd, args)
+			if !scenario.Run(s) {
+				report.Exit(1)
+			}
+		},
+	})
+
+	exec.AddCommand(&cobra.Command{
+		Use:   "validate $scenarioFile",
+		Short: "Check the scenario file without running it",
+		Run: func(cmd *cobra.Command, args []string) {
+			s := load(cmd, args)
+			fmt.Printf("Scenario %s is valid, steps: %d\n", s.Name, len(s.Steps))
+		},
+	})
+
+	return exec
+}
+
+func load(cmd *cobra.Command, args []string) *scenario.Scenario {
+	if len(args) < 1 {
+		fmt.Printf("There is 1 mandatory argument: scenarioFile!\n")
+		cmd.Help()
+		os.Exit(1)
+	}
+	s, err := scenario.Load(args[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
+	return s
+}
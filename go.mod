@@ -3,11 +3,12 @@ module github.com/commonjava/indy-tests
 go 1.14
 
 require (
+	github.com/go-git/go-git/v5 v5.4.2
 	github.com/go-openapi/strfmt v0.20.1 // indirect
 	github.com/jedib0t/go-pretty v4.3.0+incompatible
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/sirupsen/logrus v1.4.2
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/spf13/cobra v0.0.3
-	github.com/go-git/go-git/v5 v5.4.2
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,203 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package buildtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const TMP_JOURNAL_DIR = "/tmp/journal"
+
+// Phases of the artifacts in a journal
+const (
+	PHASE_DOWNLOAD = "download"
+	PHASE_UPLOAD   = "upload"
+)
+
+// States of an artifact in a journal, in order
+const (
+	STATE_PENDING    = "pending"
+	STATE_DOWNLOADED = "downloaded" // downloaded from the target indy, or from the original indy to the cache for an upload
+	STATE_UPLOADED   = "uploaded"   // uploaded to the target indy
+	STATE_VERIFIED   = "verified"   // the checksum files generated by indy are checked too
+)
+
+// JournalHeader is what's needed to resume the build, which is the first line of the journal
+type JournalHeader struct {
+	BuildName    string    `json:"buildName"`
+	FoloId       string    `json:"foloId"`
+	OriginalIndy string    `json:"originalIndy"`
+	TargetIndy   string    `json:"targetIndy"`
+	BuildType    string    `json:"buildType"`
+	Start        time.Time `json:"start"`
+}
+
+type journalEntry struct {
+	Phase string    `json:"phase"`
+	Path  string    `json:"path"`
+	State string    `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+// Journal is the checkpoint of a build replay, so that a failed replay can be resumed with the same build name,
+// skipping the artifacts that are done. It's a file of json lines, the header followed by a line for each state
+// change of an artifact, which is appended as it happens. A nil journal records nothing.
+type Journal struct {
+	JournalHeader
+	File string
+
+	states map[string]string // the state by phase and path
+	out    *os.File
+	mu     sync.Mutex
+}
+
+// DefaultJournalFile is <ENVAR_TEST_MOUNT_PATH>/journal/<build>.jsonl if the envar is defined, otherwise in
+// TMP_JOURNAL_DIR
+func DefaultJournalFile(buildName string) string {
+	dir := TMP_JOURNAL_DIR
+	if mountPath := os.Getenv(common.ENVAR_TEST_MOUNT_PATH); mountPath != "" {
+		dir = path.Join(mountPath, "journal")
+	}
+	return path.Join(dir, buildName+".jsonl")
+}
+
+// CreateJournal creates the journal file for a new build replay, which overwrites the existing one
+func CreateJournal(file string, header JournalHeader) (*Journal, error) {
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	if header.Start.IsZero() {
+		header.Start = time.Now()
+	}
+	b, _ := json.Marshal(header)
+	if _, err := out.Write(append(b, '\n')); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &Journal{JournalHeader: header, File: file, states: make(map[string]string), out: out}, nil
+}
+
+// OpenJournal loads the journal of a previous build replay to resume it. The new state changes are appended.
+func OpenJournal(file string) (*Journal, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	j := &Journal{File: file, states: make(map[string]string)}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("empty journal %s", file)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &j.JournalHeader); err != nil || j.BuildName == "" {
+		return nil, fmt.Errorf("invalid journal %s, no build in the first line", file)
+	}
+	for scanner.Scan() {
+		var e journalEntry
+		// The last line may be partial if the previous run was killed while writing it
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		j.states[e.Phase+":"+e.Path] = e.State
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read journal %s, %s", file, err)
+	}
+
+	if j.out, err = os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		return nil, err
+	}
+	// Terminate the partial last line, so that it does not break the next one
+	last := make([]byte, 1)
+	if info, err := in.Stat(); err == nil && info.Size() > 0 {
+		if _, err := in.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			j.out.Write([]byte{'\n'})
+		}
+	}
+	return j, nil
+}
+
+// State returns the state of an artifact, STATE_PENDING if it's not started
+func (j *Journal) State(phase, artiPath string) string {
+	if j == nil {
+		return STATE_PENDING
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if state, ok := j.states[phase+":"+artiPath]; ok {
+		return state
+	}
+	return STATE_PENDING
+}
+
+// Done checks if the artifact is verified in a previous run, which is skipped when resumed
+func (j *Journal) Done(phase, artiPath string) bool {
+	return j.State(phase, artiPath) == STATE_VERIFIED
+}
+
+// Mark records the new state of an artifact. A failure to write the journal is only warned, since it only means
+// the artifact is done again when resumed.
+func (j *Journal) Mark(phase, artiPath, state string) {
+	if j == nil {
+		return
+	}
+	b, _ := json.Marshal(journalEntry{Phase: phase, Path: artiPath, State: state, Time: time.Now()})
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.states[phase+":"+artiPath] = state
+	if _, err := j.out.Write(append(b, '\n')); err != nil {
+		fmt.Printf("Warning: cannot write journal %s, %s\n", j.File, err)
+	}
+}
+
+// Count returns the number of artifacts of the phase in each state
+func (j *Journal) Count(phase string) map[string]int {
+	counts := make(map[string]int)
+	if j == nil {
+		return counts
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for key, state := range j.states {
+		if strings.HasPrefix(key, phase+":") {
+			counts[state]++
+		}
+	}
+	return counts
+}
+
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.out.Close()
+}
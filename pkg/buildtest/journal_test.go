@@ -0,0 +1,72 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package buildtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJournal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "journal")
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "build-1.jsonl")
+
+	Convey("TestJournal", t, func() {
+		var none *Journal
+		none.Mark(PHASE_UPLOAD, "/a.jar", STATE_VERIFIED)
+		So(none.Done(PHASE_UPLOAD, "/a.jar"), ShouldBeFalse)
+
+		j, err := CreateJournal(file, JournalHeader{BuildName: "build-1", FoloId: "build-0", BuildType: TYPE_MVN})
+		So(err, ShouldBeNil)
+		j.Mark(PHASE_DOWNLOAD, "/a.jar", STATE_DOWNLOADED)
+		j.Mark(PHASE_DOWNLOAD, "/a.jar", STATE_VERIFIED)
+		j.Mark(PHASE_UPLOAD, "/a.jar", STATE_DOWNLOADED)
+		j.Mark(PHASE_UPLOAD, "/b.jar", STATE_UPLOADED)
+		So(j.Close(), ShouldBeNil)
+		// Killed while writing a line
+		f, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(`{"phase":"upload","path":"/b.j`)
+		f.Close()
+
+		j, err = OpenJournal(file)
+		So(err, ShouldBeNil)
+		So(j.BuildName, ShouldEqual, "build-1")
+		So(j.FoloId, ShouldEqual, "build-0")
+		So(j.Start.IsZero(), ShouldBeFalse)
+		So(j.Done(PHASE_DOWNLOAD, "/a.jar"), ShouldBeTrue)
+		So(j.Done(PHASE_UPLOAD, "/a.jar"), ShouldBeFalse)
+		So(j.State(PHASE_UPLOAD, "/a.jar"), ShouldEqual, STATE_DOWNLOADED)
+		So(j.State(PHASE_UPLOAD, "/b.jar"), ShouldEqual, STATE_UPLOADED)
+		So(j.State(PHASE_UPLOAD, "/c.jar"), ShouldEqual, STATE_PENDING)
+		So(j.Count(PHASE_UPLOAD), ShouldResemble, map[string]int{STATE_DOWNLOADED: 1, STATE_UPLOADED: 1})
+		j.Mark(PHASE_UPLOAD, "/b.jar", STATE_VERIFIED)
+		j.Close()
+
+		j, _ = OpenJournal(file)
+		So(j.Done(PHASE_UPLOAD, "/b.jar"), ShouldBeTrue)
+		j.Close()
+
+		ioutil.WriteFile(file, []byte("{}\n"), 0644)
+		_, err = OpenJournal(file)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,143 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package buildtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+// replayEvent is a download or upload of the original build at its time
+type replayEvent struct {
+	offset   time.Duration // since the first request of the original build
+	phase    string        // PHASE_DOWNLOAD or PHASE_UPLOAD
+	artiPath string
+	urls     []string // the original and target urls, as in the entries of the phases
+}
+
+// scheduleByTimestamps orders the downloads and uploads by the first timestamps (in milliseconds) of their folo
+// entries, relative to the earliest one. The entries without timestamps are at the start.
+func scheduleByTimestamps(foloRecord common.TrackedContent, downloads, uploads map[string][]string) []replayEvent {
+	var events []replayEvent
+	var timestamps []int64 // of the events, -1 if unknown
+	first := int64(-1)
+	add := func(phase string, entries []common.TrackedContentEntry, urls map[string][]string) {
+		index := make(map[string]int) // the event of a path, since a path may be in more than one entry
+		for _, e := range entries {
+			u, ok := urls[e.Path]
+			if !ok {
+				continue
+			}
+			i, ok := index[e.Path]
+			if !ok {
+				i = len(events)
+				index[e.Path] = i
+				events = append(events, replayEvent{phase: phase, artiPath: e.Path, urls: u})
+				timestamps = append(timestamps, -1)
+			}
+			for _, t := range e.Timestamps {
+				if timestamps[i] < 0 || t < timestamps[i] {
+					timestamps[i] = t
+				}
+				if first < 0 || t < first {
+					first = t
+				}
+			}
+		}
+	}
+	add(PHASE_DOWNLOAD, foloRecord.Downloads, downloads)
+	add(PHASE_UPLOAD, foloRecord.Uploads, uploads)
+
+	for i, t := range timestamps {
+		if t >= 0 {
+			events[i].offset = time.Duration(t-first) * time.Millisecond
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].offset < events[j].offset
+	})
+	return events
+}
+
+// replayByTimestamps starts each event at its offset divided by speed, e.g, 10 for 10 times faster than the original
+// build, so that the downloads and uploads are interleaved as they were. At most processNum events run at a time,
+// and an event which cannot start in time is late, the max of which is reported. No more events are started after
+// one fails. It returns false if any of them fails.
+func replayByTimestamps(processNum int, speed float64, events []replayEvent, download, upload func(artiPath, originalURL, targetURL string) bool) bool {
+	if len(events) == 0 {
+		return true
+	}
+	if processNum < 1 {
+		processNum = 1
+	}
+	original := events[len(events)-1].offset
+	fmt.Printf("Start replaying %d download and upload artifacts of %v at %gx speed, with %d routines.\n", len(events), original, speed, processNum)
+	fmt.Printf("==========================================\n\n")
+
+	sem := make(chan struct{}, processNum)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+	var maxLag time.Duration
+	start := time.Now()
+	for _, e := range events {
+		due := start.Add(time.Duration(float64(e.offset) / speed))
+		time.Sleep(time.Until(due))
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		if lag := time.Since(due); lag > maxLag {
+			maxLag = lag
+		}
+		wg.Add(1)
+		go func(e replayEvent) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			job := download
+			if e.phase == PHASE_UPLOAD {
+				job = upload
+			}
+			if !job(e.artiPath, e.urls[0], e.urls[1]) {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	fmt.Println("==========================================")
+	report.RecordMetric("replay max lag", maxLag)
+	if failed {
+		fmt.Printf("Build test failed due to some download or upload errors. Please see above logs to see the details.\n\n")
+		return false
+	}
+	fmt.Printf("Replay finished, elapsed: %v, original: %v, max lag: %v\n\n", time.Since(start), original, maxLag)
+	return true
+}
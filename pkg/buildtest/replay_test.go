@@ -0,0 +1,127 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package buildtest
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduleByTimestamps(t *testing.T) {
+	record := common.TrackedContent{
+		Downloads: []common.TrackedContentEntry{
+			{Path: "/b.jar", Timestamps: []int64{1000300}},
+			{Path: "/a.pom", Timestamps: []int64{1000200, 1000000}},
+			{Path: "/b.jar", StoreKey: "maven:remote:other", Timestamps: []int64{1000100}},
+			{Path: "/none.jar"},
+		},
+		Uploads: []common.TrackedContentEntry{
+			{Path: "/c.jar", Timestamps: []int64{1000150}},
+			{Path: "/skipped.jar", Timestamps: []int64{999000}},
+		},
+	}
+	downloads := map[string][]string{"/a.pom": {"", "a"}, "/b.jar": {"", "b"}, "/none.jar": {"", "none"}}
+	uploads := map[string][]string{"/c.jar": {"c0", "c"}}
+
+	events := scheduleByTimestamps(record, downloads, uploads)
+	Convey("TestScheduleByTimestamps", t, func() {
+		So(len(events), ShouldEqual, 4)
+		So(events[0].artiPath, ShouldEqual, "/a.pom")
+		So(events[0].offset, ShouldEqual, 0)
+		So(events[1].artiPath, ShouldEqual, "/none.jar")
+		So(events[1].offset, ShouldEqual, 0)
+		So(events[2].artiPath, ShouldEqual, "/b.jar")
+		So(events[2].offset, ShouldEqual, 100*time.Millisecond)
+		So(events[3].artiPath, ShouldEqual, "/c.jar")
+		So(events[3].phase, ShouldEqual, PHASE_UPLOAD)
+		So(events[3].urls, ShouldResemble, []string{"c0", "c"})
+		So(events[3].offset, ShouldEqual, 150*time.Millisecond)
+	})
+}
+
+func TestReplayByTimestamps(t *testing.T) {
+	events := []replayEvent{
+		{offset: 0, phase: PHASE_DOWNLOAD, artiPath: "/a", urls: []string{"", "a"}},
+		{offset: 100 * time.Millisecond, phase: PHASE_UPLOAD, artiPath: "/b", urls: []string{"", "b"}},
+		{offset: 200 * time.Millisecond, phase: PHASE_DOWNLOAD, artiPath: "/c", urls: []string{"", "c"}},
+	}
+	var mu sync.Mutex
+	var order []string
+	var starts []time.Duration
+	var start time.Time
+	job := func(fail string) func(artiPath, originalURL, targetURL string) bool {
+		return func(artiPath, originalURL, targetURL string) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, artiPath)
+			starts = append(starts, time.Since(start))
+			return artiPath != fail
+		}
+	}
+
+	report.Start("build", nil, "")
+	start = time.Now()
+	passed := replayByTimestamps(2, 2, events, job(""), job(""))
+	replayed, offsets := order, starts
+
+	order, starts = nil, nil
+	start = time.Now()
+	failed := replayByTimestamps(2, 2, events, job("/a"), job(""))
+	stopped := order
+
+	Convey("TestReplayByTimestamps", t, func() {
+		So(passed, ShouldBeTrue)
+		So(replayed, ShouldResemble, []string{"/a", "/b", "/c"})
+		// 2x faster
+		So(offsets[1], ShouldBeBetween, 40*time.Millisecond, 90*time.Millisecond)
+		So(offsets[2], ShouldBeBetween, 90*time.Millisecond, 190*time.Millisecond)
+		So(report.Current().Metrics[0].Name, ShouldEqual, "replay max lag")
+
+		So(failed, ShouldBeFalse)
+		So(stopped, ShouldResemble, []string{"/a"})
+	})
+}
+
+func TestDoRunReplay(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	mountPath, _ := ioutil.TempDir("", "buildtest")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalBuild(indy, "build-1")
+	buildName := common.GenerateRandomBuildName()
+	report.Start("build", nil, "")
+	passed := DoRun(indy.URL, "", indy.URL, TYPE_MVN, buildName, foloTrackContent, nil, 2, false, false, UploadOptions{}, nil, 10)
+	record, _ := indy.FoloRecord(buildName)
+
+	Convey("TestDoRunReplay", t, func() {
+		So(passed, ShouldBeTrue)
+		So(report.Current().Summary.Failed, ShouldEqual, 0)
+		So(len(record.Downloads), ShouldEqual, 1)
+		So(len(record.Uploads), ShouldEqual, 1)
+	})
+}
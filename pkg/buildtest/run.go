@@ -2,133 +2,177 @@ package buildtest
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/commonjava/indy-tests/pkg/cache"
 	common "github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 const (
 	TMP_DOWNLOAD_DIR = "/tmp/download"
-	TMP_UPLOAD_DIR   = "/tmp/upload"
+
+	DEFAULT_STREAM_MEMORY_LIMIT = 1 << 20
 )
 
-func Run(originalIndy, foloId, replacement, targetIndy, buildType string, processNum int) {
-	origIndy := originalIndy
-	if !strings.HasPrefix(origIndy, "http://") {
-		origIndy = "http://" + origIndy
-	}
+// UploadOptions of the upload phase. By default, the uploads are downloaded from the original indy to a local
+// cache first, which is shared by the next runs and the other builds with the same content.
+type UploadOptions struct {
+	Stream       bool   // pipe the uploads from the original indy to the target indy without the local cache
+	MemoryLimit  int64  // in stream mode, the uploads up to the size are read into memory first, so they can be retried
+	CacheDir     string // the dir of the content-addressed cache, cache.DefaultDir() if empty
+	CacheMaxSize int64  // the least recently used files are evicted when the cache exceeds the size, no limit if 0
+}
+
+// Run replays the build with a new build name. The progress is recorded in the journal file, or the default one
+// if it's empty, so that the build can be resumed by Resume if it fails.
+func Run(originalIndy, foloId, replacement, targetIndy, buildType string, processNum int, upload UploadOptions, journalFile string,
+	speed float64) {
+	origIndy := common.NormIndyURL(originalIndy)
 	foloTrackContent := common.GetFoloRecord(origIndy, foloId)
 	newBuildName := common.GenerateRandomBuildName()
-	DoRun(originalIndy, replacement, targetIndy, buildType, newBuildName, foloTrackContent, nil, processNum, false, false)
+	if common.IsEmptyString(journalFile) {
+		journalFile = DefaultJournalFile(newBuildName)
+	}
+	journal, err := CreateJournal(journalFile, JournalHeader{BuildName: newBuildName, FoloId: foloId, OriginalIndy: originalIndy,
+		TargetIndy: targetIndy, BuildType: buildType})
+	if err != nil {
+		fmt.Printf("Error: cannot create journal %s, %s\n", journalFile, err)
+		report.Exit(1)
+	}
+	defer journal.Close()
+	fmt.Printf("Journal: %s, resume the build with '--resume %s' if it fails\n", journalFile, journalFile)
+	if !DoRun(originalIndy, replacement, targetIndy, buildType, newBuildName, foloTrackContent, nil, processNum, false, false, upload, journal, speed) {
+		report.Exit(1)
+	}
+}
+
+// Resume continues the build replay of the journal with the same build name. The artifacts verified in the
+// previous runs are skipped, and the others are done again from the start.
+func Resume(journalFile string, processNum int, upload UploadOptions, speed float64) {
+	journal, err := OpenJournal(journalFile)
+	if err != nil {
+		fmt.Printf("Error: cannot resume the build, %s\n", err)
+		report.Exit(1)
+	}
+	defer journal.Close()
+	downloads, uploads := journal.Count(PHASE_DOWNLOAD), journal.Count(PHASE_UPLOAD)
+	fmt.Printf("Resume build %s started at %s, verified downloads: %d, verified uploads: %d\n", journal.BuildName,
+		journal.Start.Format(time.RFC3339), downloads[STATE_VERIFIED], uploads[STATE_VERIFIED])
+	foloTrackContent := common.GetFoloRecord(common.NormIndyURL(journal.OriginalIndy), journal.FoloId)
+	if !DoRun(journal.OriginalIndy, "", journal.TargetIndy, journal.BuildType, journal.BuildName, foloTrackContent, nil, processNum,
+		false, false, upload, journal, speed) {
+		report.Exit(1)
+	}
 }
 
-// Create the repo structure and do the download/upload
+// Create the repo structure and do the download/upload. It returns false if any of them fails. If journal is not
+// nil, the artifacts done in it are skipped, and the progress is recorded in it. If speed is greater than 0, the
+// downloads and uploads are replayed at their times in the folo record, speed times faster, see replayByTimestamps.
+// Otherwise all the downloads are done as fast as possible, then the uploads.
 func DoRun(originalIndy, replacement, targetIndy, buildType, newBuildName string, foloTrackContent common.TrackedContent,
 	additionalRepos []string,
-	processNum int, clearCache, dryRun bool) bool {
+	processNum int, clearCache, dryRun bool, upload UploadOptions, journal *Journal, speed float64) bool {
 
-	common.ValidateTargetIndyOrExit(originalIndy)
-	targetIndyHost, _ := common.ValidateTargetIndyOrExit(targetIndy)
+	if _, validated := common.ValidateTargetIndy(originalIndy); !validated {
+		return false
+	}
+	targetIndyBaseUrl, validated := common.ValidateTargetIndy(targetIndy)
+	if !validated {
+		return false
+	}
 
 	// Prepare the indy repos for the whole testing
 	buildMeta := decideMeta(buildType)
-	if !prepareIndyRepos("http://"+targetIndyHost, newBuildName, *buildMeta, additionalRepos, dryRun) {
-		os.Exit(1)
+	if !prepareIndyRepos(targetIndyBaseUrl, newBuildName, *buildMeta, additionalRepos, dryRun) {
+		return false
 	}
 
-	downloadDir, uploadDir := prepareDownUploadDirectories(foloTrackContent.TrackingKey.Id, clearCache)
+	downloadDir := prepareDownloadDirectory(newBuildName)
+	defer os.RemoveAll(downloadDir)
+	uploadCache := cache.Open(upload.CacheDir, upload.CacheMaxSize)
 
 	downloads := prepareDownloadEntriesByFolo(targetIndy, newBuildName, foloTrackContent, additionalRepos)
-	downloadFunc := func(md5str, originalArtiURL, targetArtiURL string) bool {
-		fileLoc := path.Join(downloadDir, path.Base(targetArtiURL))
+	downloadDigests := digestsByPath(foloTrackContent.Downloads)
+	downloadFunc := func(artiPath, originalArtiURL, targetArtiURL string) bool {
+		fileLoc := path.Join(downloadDir, localPath(artiPath))
 		if dryRun {
 			fmt.Printf("Dry run download, url: %s\n", targetArtiURL)
+			report.Record(report.Result{Kind: report.KIND_DOWNLOAD, Name: artiPath, URL: targetArtiURL, Status: report.STATUS_SKIPPED, Error: "dry run"})
 			return true
 		}
-		success := common.DownloadFile(targetArtiURL, fileLoc)
-		if success {
-			common.Md5Check(fileLoc, md5str)
+		if journal.Done(PHASE_DOWNLOAD, artiPath) {
+			report.Record(report.Result{Kind: report.KIND_DOWNLOAD, Name: artiPath, URL: targetArtiURL, Status: report.STATUS_SKIPPED, Error: "done in a previous run"})
+			return true
 		}
-		return success
-	}
-	broken := false
-	if len(downloads) > 0 {
-		fmt.Println("Start handling downloads artifacts.")
-		fmt.Printf("==========================================\n\n")
-		if processNum > 1 {
-			broken = !concurrentRun(processNum, downloads, downloadFunc)
-		} else {
-			for _, down := range downloads {
-				broken = !downloadFunc(down[0], down[1], down[2])
-				if broken {
-					break
-				}
-			}
+		result := common.DownloadAndVerify(targetArtiURL, fileLoc, downloadDigests[artiPath])
+		report.RecordTransfer(report.KIND_DOWNLOAD, artiPath, result)
+		if !result.Succeeded() {
+			return false
 		}
-		fmt.Println("==========================================")
-		if broken {
-			fmt.Printf("Build test failed due to some downloading errors. Please see above logs to see the details.\n\n")
-			os.Exit(1)
+		journal.Mark(PHASE_DOWNLOAD, artiPath, STATE_DOWNLOADED)
+		if common.IsRegularFile(artiPath) {
+			checkSidecars(artiPath, untrackedURL(targetArtiURL, newBuildName), result.Digests)
 		}
-		fmt.Printf("Downloads artifacts handling finished.\n\n")
+		journal.Mark(PHASE_DOWNLOAD, artiPath, STATE_VERIFIED)
+		return true
 	}
-
-	uploadFunc := func(md5str, originalArtiURL, targetArtiURL string) bool {
+	uploadDigests := digestsByPath(foloTrackContent.Uploads)
+	uploadFunc := func(artiPath, originalArtiURL, targetArtiURL string) bool {
 		if dryRun {
 			fmt.Printf("Dry run upload, originalArtiURL: %s, targetArtiURL: %s\n", originalArtiURL, targetArtiURL)
+			report.Record(report.Result{Kind: report.KIND_UPLOAD, Name: artiPath, URL: targetArtiURL, Status: report.STATUS_SKIPPED, Error: "dry run"})
+			return true
+		}
+		if journal.Done(PHASE_UPLOAD, artiPath) {
+			report.Record(report.Result{Kind: report.KIND_UPLOAD, Name: artiPath, URL: targetArtiURL, Status: report.STATUS_SKIPPED, Error: "done in a previous run"})
 			return true
 		}
 
-		cacheFile := path.Join(uploadDir, path.Base(originalArtiURL))
-		var downloaded bool
-		if common.FileOrDirExists(cacheFile) {
-			fmt.Printf("File already downloaded, reuse cacheFile: %s\n", cacheFile)
-			downloaded = true
+		var result common.TransferResult
+		alter := npmAlter(buildType, artiPath, newBuildName)
+		if upload.Stream {
+			result = common.StreamFileWithResult(originalArtiURL, targetArtiURL, uploadDigests[artiPath], upload.MemoryLimit, alter)
 		} else {
-			downloaded = common.DownloadUploadFileForCache(originalArtiURL, cacheFile)
+			result = uploadFromCache(uploadCache, originalArtiURL, targetArtiURL, uploadDigests[artiPath], alter, clearCache,
+				func() { journal.Mark(PHASE_UPLOAD, artiPath, STATE_DOWNLOADED) })
 		}
-		if downloaded {
-			common.Md5Check(cacheFile, md5str)
-			return common.UploadFile(targetArtiURL, cacheFile)
+		report.RecordTransfer(report.KIND_UPLOAD, artiPath, result)
+		if !result.Succeeded() {
+			return false
 		}
-		return false
+		journal.Mark(PHASE_UPLOAD, artiPath, STATE_UPLOADED)
+		if common.IsRegularFile(artiPath) {
+			checkSidecars(common.AlterUploadPath(artiPath, newBuildName[len(common.BUILD_TEST_):]), untrackedURL(targetArtiURL, newBuildName), result.Digests)
+		}
+		journal.Mark(PHASE_UPLOAD, artiPath, STATE_VERIFIED)
+		return true
 	}
 
 	uploads := prepareUploadEntriesByFolo(originalIndy, targetIndy, newBuildName, foloTrackContent)
-
-	if len(uploads) > 0 {
-		fmt.Println("Start handling uploads artifacts.")
-		fmt.Printf("==========================================\n\n")
-		if processNum > 1 {
-			broken = !concurrentRun(processNum, uploads, uploadFunc)
-		} else {
-			for _, up := range uploads {
-				broken = !uploadFunc(up[0], up[1], up[2])
-				if broken {
-					break
-				}
-			}
-		}
-		fmt.Println("==========================================")
-		if broken {
-			fmt.Printf("Build test failed due to some uploadig errors. Please see above logs to see the details.\n\n")
-			os.Exit(1)
-		}
-
-		fmt.Printf("Uploads artifacts handling finished.\n\n")
+	broken := false
+	if speed > 0 {
+		broken = !replayByTimestamps(processNum, speed, scheduleByTimestamps(foloTrackContent, downloads, uploads), downloadFunc, uploadFunc)
+	} else {
+		broken = !runPhase(PHASE_DOWNLOAD, processNum, downloads, downloadFunc) || !runPhase(PHASE_UPLOAD, processNum, uploads, uploadFunc)
 	}
-	if !broken && !dryRun {
-		targIndy := targetIndy
-		if !strings.HasPrefix(targIndy, "http://") {
-			targIndy = "http://" + targIndy
-		}
-		if common.SealFoloRecord(targIndy, newBuildName) {
+	if broken {
+		return false
+	}
+	if !dryRun {
+		start := time.Now()
+		if common.SealFoloRecord(targetIndyBaseUrl, newBuildName) {
 			fmt.Printf("Folo record sealing succeeded for %s", newBuildName)
+			report.RecordCheck(report.KIND_FOLO, "seal "+newBuildName, time.Since(start), nil)
 		} else {
 			fmt.Printf("Warning: folo record sealing failed for %s", newBuildName)
+			report.RecordCheck(report.KIND_FOLO, "seal "+newBuildName, time.Since(start), fmt.Errorf("folo record sealing failed"))
 		}
 	}
 
@@ -148,10 +192,10 @@ func prepareDownloadEntriesByFolo(targetIndyURL, newBuildId string, foloRecord c
 		} else if common.Contains(additionalRepos, down.StoreKey) {
 			p = path.Join("api/folo/track", newBuildId, repoPath, down.Path)
 		} else {
-			p = path.Join("api/folo/track", newBuildId, "maven/group", newBuildId, down.Path)
+			p = path.Join("api/folo/track", newBuildId, common.PackageTypeOf(down.StoreKey), "group", newBuildId, down.Path)
 		}
 		downUrl := fmt.Sprintf("%s%s", targetIndy, p)
-		result[down.Path] = []string{down.Md5, "", downUrl}
+		result[down.Path] = []string{"", downUrl}
 	}
 	return result
 }
@@ -164,7 +208,7 @@ func prepareUploadEntriesByFolo(originalIndyURL, targetIndyURL, newBuildId strin
 	result := make(map[string][]string)
 	for _, up := range foloRecord.Uploads {
 		orgiUpUrl, targUpUrl := createUploadUrls(originalIndy, targetIndy, newBuildId, up)
-		result[up.Path] = []string{up.Md5, orgiUpUrl, targUpUrl}
+		result[up.Path] = []string{orgiUpUrl, targUpUrl}
 	}
 	return result
 }
@@ -180,51 +224,190 @@ func createUploadUrls(originalIndy, targetIndy, newBuildId string, up common.Tra
 	return orgiUpUrl, targUpUrl
 }
 
-func normIndyURL(indyURL string) string {
-	indy := indyURL
-	if !strings.HasPrefix(indy, "http://") {
-		indy = "http://" + indy
+// digestsByPath returns the digests of the folo entries to verify the transfers. Only the regular files are
+// verified, since the metadata is generated by indy and differs from the one in the original build.
+func digestsByPath(entries []common.TrackedContentEntry) map[string]common.Digests {
+	digests := make(map[string]common.Digests)
+	for _, e := range entries {
+		if common.IsRegularFile(e.Path) {
+			digests[e.Path] = common.DigestsOf(e)
+		}
+	}
+	return digests
+}
+
+// checkSidecars gets the .md5, .sha1 and .sha256 files generated by indy for the artifact, and compares them
+// with the digests of its content. Each of them is recorded in the report, but a mismatch does not fail the
+// transfer, since the artifact itself is fine.
+func checkSidecars(artiPath, artiURL string, digests common.Digests) {
+	for _, ext := range []string{common.EXT_MD5, common.EXT_SHA1, common.EXT_SHA256} {
+		url := artiURL + ext
+		start := time.Now()
+		content, code, succeeded := common.HTTPRequest(url, common.MethodGet, nil, true, nil, nil, "", false)
+		r := report.Result{Kind: report.KIND_CHECKSUM, Name: artiPath + ext, URL: url, Status: report.STATUS_PASSED, Duration: time.Since(start)}
+		if code != common.StatusUnknown {
+			r.HTTPCode = code
+		}
+		if !succeeded {
+			r.Status, r.Error = report.STATUS_FAILED, fmt.Sprintf("cannot get %s file, code: %d", ext, code)
+		} else if checksum := common.ParseChecksum(content); !strings.EqualFold(checksum, digests.Checksum(ext)) {
+			r.Status, r.Error = report.STATUS_FAILED, fmt.Sprintf("%s not match, expected: %s, got: %s", ext[1:], digests.Checksum(ext), checksum)
+		}
+		if r.Status == report.STATUS_FAILED {
+			fmt.Printf("Check checksum FAILED, url: %s, error: %s\n", url, r.Error)
+		}
+		report.Record(r)
+	}
+}
+
+// untrackedURL returns the content url of a folo tracking url, so that getting the sidecar files does not add
+// entries to the folo record
+func untrackedURL(trackingURL, buildName string) string {
+	return strings.Replace(trackingURL, "api/folo/track/"+buildName+"/", "api/content/", 1)
+}
+
+// localPath returns the path of the downloaded file of an artifact path, relative to the download dir. The npm
+// package documents are at "<package>/package.json", since the package path "/@scope/foo" is also the dir of
+// the tarballs.
+func localPath(artiPath string) string {
+	if common.IsNpmMetadata(artiPath) {
+		return common.NpmMetadataPath(common.NpmPackageName(artiPath))
+	}
+	return artiPath
+}
+
+// npmAlter returns the function to rewrite the version in the npm tarball or package document, since indy reads
+// the version from the content rather than the path. It returns nil for other files.
+func npmAlter(buildType, artiPath, newBuildName string) func(io.Reader, io.Writer) error {
+	if buildType != TYPE_NPM {
+		return nil
 	}
-	if !strings.HasSuffix(indy, "/") {
-		indy = indy + "/"
+	newReleaseNumber := newBuildName[len(common.BUILD_TEST_):]
+	if common.IsNpmTarball(artiPath) {
+		return func(r io.Reader, w io.Writer) error {
+			return common.AlterNpmTarballStream(r, w, newReleaseNumber)
+		}
+	}
+	if common.IsNpmMetadata(artiPath) {
+		return func(r io.Reader, w io.Writer) error {
+			content, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			b, err := common.AlterNpmMetadata(content, newReleaseNumber)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		}
 	}
-	return indy
+	return nil
 }
 
-func prepareDownUploadDirectories(buildId string, clearCache bool) (string, string) {
-	// use "/tmp/download", which will be dropped after each run
-	downloadDir := TMP_DOWNLOAD_DIR
+// uploadFromCache gets the file from the cache, which downloads it from the original indy if it's not cached yet,
+// and uploads it to the target indy. If alter is not nil, the content is rewritten to a temporary file to upload.
+// If refresh is true, the cached file is dropped and downloaded again. fetched is called when the file is in the cache.
+func uploadFromCache(c *cache.Cache, originalArtiURL, targetArtiURL string, expected common.Digests, alter func(io.Reader, io.Writer) error,
+	refresh bool, fetched func()) common.TransferResult {
+	failed := func(url string, err error) common.TransferResult {
+		return common.TransferResult{URL: url, StatusCode: common.StatusUnknown, Err: err}
+	}
+	if refresh {
+		c.Remove(cache.KeyOf(expected))
+	}
+	cacheFile, release, err := c.Fetch(originalArtiURL, expected)
+	if err != nil {
+		fmt.Printf("Error: cannot download %s from original indy, %s\n", originalArtiURL, err)
+		return failed(originalArtiURL, fmt.Errorf("cannot download from original indy, %s", err))
+	}
+	defer release()
+	fetched()
+
+	uploadFile := cacheFile
+	if alter != nil {
+		altered, err := alterFile(cacheFile, c.TempDir(), alter)
+		if err != nil {
+			fmt.Printf("Error: cannot alter the version of %s, %s\n", cacheFile, err)
+			return failed(targetArtiURL, err)
+		}
+		defer os.Remove(altered)
+		uploadFile = altered
+	}
+	result := common.UploadFileWithResult(targetArtiURL, uploadFile)
+	if result.Succeeded() {
+		result.Digests, _ = common.DigestsOfFile(uploadFile)
+	}
+	return result
+}
+
+// alterFile writes the altered content of the file to a temporary file in the dir, and returns the temporary one
+func alterFile(fileLoc, dir string, alter func(io.Reader, io.Writer) error) (string, error) {
+	in, err := os.Open(fileLoc)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile(dir, path.Base(fileLoc)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if err := alter(in, out); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+func normIndyURL(indyURL string) string {
+	return common.NormIndyURL(indyURL) + "/"
+}
+
+// prepareDownloadDirectory creates the download dir of the build, i.e, "/tmp/download/<build>", which is removed
+// after the run. The downloads are at their full paths in it, so the files with the same name do not collide.
+func prepareDownloadDirectory(buildName string) string {
+	downloadDir := path.Join(TMP_DOWNLOAD_DIR, buildName)
 	if !common.FileOrDirExists(downloadDir) {
 		os.MkdirAll(downloadDir, os.FileMode(0755))
 	}
 	if !common.FileOrDirExists(downloadDir) {
 		fmt.Printf("Error: cannot create directory %s for file downloading.\n", downloadDir)
-		os.Exit(1)
+		report.Exit(1)
 	}
+	fmt.Printf("Prepared download dir: %s\n", downloadDir)
+	return downloadDir
+}
 
-	// use ENVAR_TEST_MOUNT_PATH + "bulidId/upload" if this envar is defined
-	uploadDir := TMP_UPLOAD_DIR
-	envarTestMountPath := os.Getenv(common.ENVAR_TEST_MOUNT_PATH)
-	if envarTestMountPath != "" {
-		uploadDir = path.Join(envarTestMountPath, buildId, "upload")
-		if clearCache {
-			os.RemoveAll(uploadDir)
-		}
+// runPhase runs the job for all the entries of the phase, concurrently if processNum > 1. It returns false if any
+// of them fails.
+func runPhase(phase string, processNum int, entries map[string][]string, job func(artiPath, originalURL, targetURL string) bool) bool {
+	if len(entries) == 0 {
+		return true
 	}
-
-	if !common.FileOrDirExists(uploadDir) {
-		os.MkdirAll(uploadDir, os.FileMode(0755))
+	fmt.Printf("Start handling %s artifacts.\n", phase)
+	fmt.Printf("==========================================\n\n")
+	broken := false
+	if processNum > 1 {
+		broken = !concurrentRun(processNum, entries, job)
+	} else {
+		for p, e := range entries {
+			broken = !job(p, e[0], e[1])
+			if broken {
+				break
+			}
+		}
 	}
-
-	if !common.FileOrDirExists(uploadDir) {
-		fmt.Printf("Error: cannot create directory %s for caching uploading files.\n", uploadDir)
-		os.Exit(1)
+	fmt.Println("==========================================")
+	if broken {
+		fmt.Printf("Build test failed due to some %s errors. Please see above logs to see the details.\n\n", phase)
+		return false
 	}
-	fmt.Printf("Prepared download dir: %s, upload dir: %s\n", downloadDir, uploadDir)
-	return downloadDir, uploadDir
+	fmt.Printf("%s artifacts handling finished.\n\n", strings.Title(phase))
+	return true
 }
 
-func concurrentRun(numWorkers int, artifacts map[string][]string, job func(md5, originalURL, targetURL string) bool) bool {
+func concurrentRun(numWorkers int, artifacts map[string][]string, job func(artiPath, originalURL, targetURL string) bool) bool {
 	fmt.Printf("Start to run job in concurrent mode with thread number %v\n", numWorkers)
 	ch := make(chan []string, numWorkers*5) // This buffered number of chan can be anything as long as it's larger than numWorkers
 	var wg sync.WaitGroup
@@ -241,16 +424,17 @@ func concurrentRun(numWorkers int, artifacts map[string][]string, job func(md5,
 					wg.Done()
 					return
 				}
+				result := job(a[0], a[1], a[2]) // not under the lock, so the jobs run concurrently
 				mu.Lock()
-				results = append(results, job(a[0], a[1], a[2]))
+				results = append(results, result)
 				mu.Unlock()
 			}
 		}()
 	}
 
 	// Now the jobs can be added to the channel, which is used as a queue
-	for _, artifact := range artifacts {
-		ch <- artifact // add artifact to the queue
+	for p, artifact := range artifacts {
+		ch <- append([]string{p}, artifact...) // add artifact to the queue
 	}
 
 	close(ch) // This tells the goroutines there's nothing else to do
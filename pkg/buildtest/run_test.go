@@ -1,9 +1,18 @@
 package buildtest
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/commonjava/indy-tests/pkg/cache"
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -15,3 +24,208 @@ func TestAlterUploadPath(t *testing.T) {
 		So(altered, ShouldEqual, expected)
 	})
 }
+
+// newOriginalBuild runs a build through the folo of the mock indy, which downloads a dependency and uploads a jar
+func newOriginalBuild(indy *mockindy.Server, buildName string) common.TrackedContent {
+	indy.Seed("maven:remote:central", "/org/dep/dep/1.0/dep-1.0.jar", []byte("dep-jar"))
+	indy.AddStore("maven:hosted:"+buildName, nil)
+	trackURL := indy.URL + "/api/folo/track/" + buildName
+	common.HTTPRequest(trackURL+"/maven/group/"+DEFAULT_SHARED_GROUP+"/org/dep/dep/1.0/dep-1.0.jar",
+		common.MethodGet, nil, false, nil, nil, "", false)
+	common.HTTPRequest(trackURL+"/maven/hosted/"+buildName+"/org/foo/bar/1.0.redhat-00001/bar-1.0.redhat-00001.jar",
+		common.MethodPut, nil, false, strings.NewReader("bar-jar"), nil, "", false)
+	common.SealFoloRecord(indy.URL, buildName)
+	return common.GetFoloRecord(indy.URL, buildName)
+}
+
+func TestDoRunVerify(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	mountPath, _ := ioutil.TempDir("", "buildtest")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalBuild(indy, "build-1")
+
+	report.Start("build", nil, "")
+	passed := DoRun(indy.URL, "", indy.URL, TYPE_MVN, common.GenerateRandomBuildName(), foloTrackContent, nil, 2, false, false, UploadOptions{}, nil, 0)
+	cached, _ := cache.Open("", 0).Stats()
+	checksums := make(map[string]string)
+	for _, r := range report.Current().Results {
+		if r.Kind == report.KIND_CHECKSUM {
+			checksums[r.Name] = r.Status
+		}
+	}
+
+	// Indy generates a wrong sidecar, which is reported but does not fail the build
+	indy.Seed("maven:remote:central", "/org/dep/dep/1.0/dep-1.0.jar.sha1", []byte("bad"))
+	report.Start("build", nil, "")
+	sidecarMismatched := DoRun(indy.URL, "", indy.URL, TYPE_MVN, common.GenerateRandomBuildName(), foloTrackContent, nil, 2, false, false, UploadOptions{}, nil, 0)
+	sidecarResults := report.Current()
+
+	// The downloaded content is not the one of the original build
+	corrupted := foloTrackContent
+	corrupted.Downloads = append([]common.TrackedContentEntry{}, foloTrackContent.Downloads...)
+	corrupted.Downloads[0].Sha256 = "bad"
+	report.Start("build", nil, "")
+	downloadMismatched := DoRun(indy.URL, "", indy.URL, TYPE_MVN, common.GenerateRandomBuildName(), corrupted, nil, 2, false, false, UploadOptions{}, nil, 0)
+	downloadResults := report.Current()
+
+	Convey("TestDoRunVerify", t, func() {
+		So(passed, ShouldBeTrue)
+		So(cached.Objects, ShouldEqual, 1)
+		// Both the downloaded and the uploaded jar
+		So(len(checksums), ShouldEqual, 6)
+		So(checksums["/org/dep/dep/1.0/dep-1.0.jar.sha256"], ShouldEqual, report.STATUS_PASSED)
+		for _, status := range checksums {
+			So(status, ShouldEqual, report.STATUS_PASSED)
+		}
+
+		So(sidecarMismatched, ShouldBeTrue)
+		So(sidecarResults.Summary.Failed, ShouldEqual, 1)
+		for _, r := range sidecarResults.Results {
+			if r.Status == report.STATUS_FAILED {
+				So(r.Name, ShouldEqual, "/org/dep/dep/1.0/dep-1.0.jar.sha1")
+				So(r.Error, ShouldStartWith, "sha1 not match")
+			}
+		}
+
+		So(downloadMismatched, ShouldBeFalse)
+		So(downloadResults.Summary.Failed, ShouldEqual, 1)
+		for _, r := range downloadResults.Results {
+			if r.Status == report.STATUS_FAILED {
+				So(r.Kind, ShouldEqual, report.KIND_DOWNLOAD)
+				So(r.Error, ShouldStartWith, "sha256 not match")
+			}
+		}
+	})
+}
+
+func TestDoRunStream(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	mountPath, _ := ioutil.TempDir("", "buildtest")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalBuild(indy, "build-1")
+
+	buildName := common.GenerateRandomBuildName()
+	report.Start("build", nil, "")
+	inMemory := DoRun(indy.URL, "", indy.URL, TYPE_MVN, buildName, foloTrackContent, nil, 2, false, false,
+		UploadOptions{Stream: true, MemoryLimit: DEFAULT_STREAM_MEMORY_LIMIT}, nil, 0)
+	uploaded, _ := indy.Content("maven:hosted:"+buildName,
+		common.AlterUploadPath("/org/foo/bar/1.0.redhat-00001/bar-1.0.redhat-00001.jar", buildName[len(common.BUILD_TEST_):]))
+
+	report.Start("build", nil, "")
+	piped := DoRun(indy.URL, "", indy.URL, TYPE_MVN, common.GenerateRandomBuildName(), foloTrackContent, nil, 2, false, false,
+		UploadOptions{Stream: true}, nil, 0)
+	pipedResults := report.Current()
+
+	// The uploaded content in the original indy is not the one of the original build
+	corrupted := foloTrackContent
+	corrupted.Uploads = append([]common.TrackedContentEntry{}, foloTrackContent.Uploads...)
+	corrupted.Uploads[0].Md5 = "bad"
+	report.Start("build", nil, "")
+	mismatched := DoRun(indy.URL, "", indy.URL, TYPE_MVN, common.GenerateRandomBuildName(), corrupted, nil, 2, false, false,
+		UploadOptions{Stream: true}, nil, 0)
+	mismatchedResults := report.Current()
+
+	Convey("TestDoRunStream", t, func() {
+		So(inMemory, ShouldBeTrue)
+		So(string(uploaded), ShouldEqual, "bar-jar")
+		// Nothing is cached for the uploads
+		So(common.FileOrDirExists(path.Join(mountPath, "cache")), ShouldBeFalse)
+
+		So(piped, ShouldBeTrue)
+		So(pipedResults.Summary.Failed, ShouldEqual, 0)
+
+		So(mismatched, ShouldBeFalse)
+		So(mismatchedResults.Summary.Failed, ShouldEqual, 1)
+		for _, r := range mismatchedResults.Results {
+			if r.Status == report.STATUS_FAILED {
+				So(r.Kind, ShouldEqual, report.KIND_UPLOAD)
+				So(r.Error, ShouldStartWith, "md5 not match")
+			}
+		}
+	})
+}
+
+func TestDoRunResume(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	mountPath, _ := ioutil.TempDir("", "buildtest")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalBuild(indy, "build-1")
+	buildName := common.GenerateRandomBuildName()
+	journalFile := DefaultJournalFile(buildName)
+
+	// The uploads fail after the downloads are done
+	corrupted := foloTrackContent
+	corrupted.Uploads = append([]common.TrackedContentEntry{}, foloTrackContent.Uploads...)
+	corrupted.Uploads[0].Md5 = "bad"
+	journal, _ := CreateJournal(journalFile, JournalHeader{BuildName: buildName, FoloId: "build-1", OriginalIndy: indy.URL,
+		TargetIndy: indy.URL, BuildType: TYPE_MVN})
+	report.Start("build", nil, "")
+	failed := DoRun(indy.URL, "", indy.URL, TYPE_MVN, buildName, corrupted, nil, 2, false, false, UploadOptions{}, journal, 0)
+	journal.Close()
+
+	resumed, err := OpenJournal(journalFile)
+	report.Start("build", nil, "")
+	passed := DoRun(resumed.OriginalIndy, "", resumed.TargetIndy, resumed.BuildType, resumed.BuildName, foloTrackContent, nil, 2, false, false,
+		UploadOptions{}, resumed, 0)
+	resumed.Close()
+	results := report.Current()
+
+	Convey("TestDoRunResume", t, func() {
+		So(failed, ShouldBeFalse)
+		So(err, ShouldBeNil)
+		So(resumed.BuildName, ShouldEqual, buildName)
+		So(resumed.Count(PHASE_DOWNLOAD), ShouldResemble, map[string]int{STATE_VERIFIED: 1})
+		So(resumed.Count(PHASE_UPLOAD), ShouldResemble, map[string]int{STATE_VERIFIED: 1})
+
+		So(passed, ShouldBeTrue)
+		So(results.Summary.Failed, ShouldEqual, 0)
+		for _, r := range results.Results {
+			if r.Kind == report.KIND_DOWNLOAD {
+				So(r.Status, ShouldEqual, report.STATUS_SKIPPED)
+			}
+			if r.Kind == report.KIND_UPLOAD {
+				So(r.Status, ShouldEqual, report.STATUS_PASSED)
+			}
+		}
+		_, uploaded := indy.Content("maven:hosted:"+buildName,
+			common.AlterUploadPath("/org/foo/bar/1.0.redhat-00001/bar-1.0.redhat-00001.jar", buildName[len(common.BUILD_TEST_):]))
+		So(uploaded, ShouldBeTrue)
+	})
+}
+
+func TestConcurrentRun(t *testing.T) {
+	Convey("The jobs of concurrentRun run at the same time", t, func() {
+		// Each job waits for all the others to start, which times out if the jobs are serialized
+		var started sync.WaitGroup
+		started.Add(3)
+		job := func(artiPath, originalURL, targetURL string) bool {
+			started.Done()
+			all := make(chan struct{})
+			go func() {
+				started.Wait()
+				close(all)
+			}()
+			select {
+			case <-all:
+				return true
+			case <-time.After(2 * time.Second):
+				return false
+			}
+		}
+		artifacts := map[string][]string{"/a": {"o/a", "t/a"}, "/b": {"o/b", "t/b"}, "/c": {"o/c", "t/c"}}
+		So(concurrentRun(3, artifacts, job), ShouldBeTrue)
+		So(concurrentRun(3, map[string][]string{"/d": {"o/d", "t/d"}}, func(string, string, string) bool { return false }), ShouldBeFalse)
+	})
+}
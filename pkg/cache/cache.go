@@ -0,0 +1,339 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	TMP_CACHE_DIR    = "/tmp/cache"
+	DEFAULT_MAX_SIZE = 10 << 30 // 10 GB
+
+	tmpDir = "tmp" // partial downloads and altered files, which are not objects
+)
+
+// The checksum algorithms of the keys, from the strongest
+var algorithms = []string{common.EXT_SHA256, common.EXT_SHA1, common.EXT_MD5}
+
+// Cache stores the artifacts by the checksums in the folo record, so that the same content is downloaded from the
+// original indy only once and shared by the runs and the builds. An object is at <dir>/<algorithm>/<xx>/<checksum>,
+// where xx is the first 2 chars of the checksum. The modification time of an object is the last time it's used,
+// and the least recently used objects are evicted when the total size exceeds the max size.
+type Cache struct {
+	Dir     string
+	MaxSize int64 // no limit if 0
+
+	mu    sync.Mutex
+	inUse map[string]int // the keys of the objects being uploaded, which are not evicted
+}
+
+// Object is a cached content
+type Object struct {
+	Key      string
+	File     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// Stats of the objects in the cache
+type Stats struct {
+	Objects int
+	Size    int64
+	Oldest  time.Time // the least recently used
+	Newest  time.Time // the most recently used
+}
+
+var (
+	caches   = make(map[string]*Cache)
+	cachesMu sync.Mutex
+)
+
+// Open returns the cache in the dir, or the default dir if empty. The cache of a dir is shared in the process, so
+// that the objects used by a build are not evicted by the others.
+func Open(dir string, maxSize int64) *Cache {
+	if common.IsEmptyString(dir) {
+		dir = DefaultDir()
+	}
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	c, ok := caches[dir]
+	if !ok {
+		c = &Cache{Dir: dir, inUse: make(map[string]int)}
+		caches[dir] = c
+	}
+	c.mu.Lock()
+	c.MaxSize = maxSize
+	c.mu.Unlock()
+	return c
+}
+
+// DefaultDir is <ENVAR_TEST_MOUNT_PATH>/cache if the envar is defined, otherwise TMP_CACHE_DIR
+func DefaultDir() string {
+	if mountPath := os.Getenv(common.ENVAR_TEST_MOUNT_PATH); mountPath != "" {
+		return path.Join(mountPath, "cache")
+	}
+	return TMP_CACHE_DIR
+}
+
+// KeyOf returns the key of the content by its strongest checksum, e.g, "sha256/<checksum>". It's empty if there
+// is no checksum.
+func KeyOf(d common.Digests) string {
+	for _, ext := range algorithms {
+		if sum := d.Checksum(ext); sum != "" {
+			return ext[1:] + "/" + strings.ToLower(sum)
+		}
+	}
+	return ""
+}
+
+// digestsOfKey returns the expected digests of an object by its key
+func digestsOfKey(key string) (common.Digests, bool) {
+	toks := strings.Split(key, "/")
+	if len(toks) != 2 || len(toks[1]) < 2 {
+		return common.Digests{}, false
+	}
+	switch "." + toks[0] {
+	case common.EXT_MD5:
+		return common.Digests{Md5: toks[1]}, true
+	case common.EXT_SHA1:
+		return common.Digests{Sha1: toks[1]}, true
+	case common.EXT_SHA256:
+		return common.Digests{Sha256: toks[1]}, true
+	}
+	return common.Digests{}, false
+}
+
+// Path returns the file of an object
+func (c *Cache) Path(key string) string {
+	toks := strings.SplitN(key, "/", 2)
+	return path.Join(c.Dir, toks[0], toks[1][:2], toks[1])
+}
+
+// TempDir returns the dir for the temporary files, e.g, the altered uploads, so that they are on the same disk
+func (c *Cache) TempDir() string {
+	dir := path.Join(c.Dir, tmpDir)
+	os.MkdirAll(dir, 0755)
+	return dir
+}
+
+// Fetch returns the cached file of the content with the expected digests, which is downloaded from the url if it's
+// not cached yet or the cached one is corrupted. The file is not evicted until release is called. Content without
+// any checksum is not cached, it's downloaded to a temporary file which is removed by release.
+func (c *Cache) Fetch(url string, expected common.Digests) (file string, release func(), err error) {
+	key := KeyOf(expected)
+	if key == "" {
+		tmp, err := c.download(url, expected)
+		if err != nil {
+			return "", nil, err
+		}
+		return tmp, func() { os.Remove(tmp) }, nil
+	}
+
+	c.acquire(key)
+	release = func() { c.release(key) }
+	file = c.Path(key)
+	if c.valid(file, expected) {
+		fmt.Printf("File already downloaded, reuse cacheFile: %s\n", file)
+		now := time.Now()
+		os.Chtimes(file, now, now)
+		return file, release, nil
+	}
+	tmp, err := c.download(url, expected)
+	if err == nil {
+		os.MkdirAll(path.Dir(file), 0755)
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		release()
+		return "", nil, err
+	}
+	c.evict()
+	return file, release, nil
+}
+
+// Remove removes the object of the key if it's cached
+func (c *Cache) Remove(key string) {
+	if key != "" {
+		os.Remove(c.Path(key))
+	}
+}
+
+// download stores the content to a temporary file, which is removed if the content is not the expected one
+func (c *Cache) download(url string, expected common.Digests) (string, error) {
+	f, err := ioutil.TempFile(c.TempDir(), "download-*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if err := common.DownloadUploadFileForCache(url, f.Name(), expected); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// valid checks the cached file against the expected digests, and removes it if it's corrupted
+func (c *Cache) valid(file string, expected common.Digests) bool {
+	if !common.FileOrDirExists(file) {
+		return false
+	}
+	calculated, err := common.DigestsOfFile(file)
+	if err == nil {
+		err = expected.Verify(calculated)
+	}
+	if err != nil {
+		fmt.Printf("Warning: cached file %s is corrupted, will download again, %s\n", file, err)
+		os.Remove(file)
+		return false
+	}
+	return true
+}
+
+func (c *Cache) acquire(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inUse[key]++
+}
+
+func (c *Cache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inUse[key]--; c.inUse[key] <= 0 {
+		delete(c.inUse, key)
+	}
+}
+
+// evict removes the least recently used objects until the total size is within the max size
+func (c *Cache) evict() {
+	c.mu.Lock()
+	maxSize := c.MaxSize
+	c.mu.Unlock()
+	if maxSize <= 0 {
+		return
+	}
+	if removed, freed, err := c.Prune(maxSize); err != nil {
+		fmt.Printf("Warning: cannot evict cached files in %s, %s\n", c.Dir, err)
+	} else if removed > 0 {
+		fmt.Printf("Evicted %d cached files (%s) in %s\n", removed, common.ByteCountSI(freed), c.Dir)
+	}
+}
+
+// Objects returns all the objects in the cache, the least recently used first
+func (c *Cache) Objects() ([]Object, error) {
+	var objects []Object
+	for _, ext := range algorithms {
+		root := path.Join(c.Dir, ext[1:])
+		if !common.FileOrDirExists(root) {
+			continue
+		}
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				objects = append(objects, Object{Key: ext[1:] + "/" + info.Name(), File: p, Size: info.Size(), LastUsed: info.ModTime()})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool { return objects[i].LastUsed.Before(objects[j].LastUsed) })
+	return objects, nil
+}
+
+// Stats returns the number, total size and the last used time range of the objects
+func (c *Cache) Stats() (Stats, error) {
+	objects, err := c.Objects()
+	if err != nil {
+		return Stats{}, err
+	}
+	s := Stats{Objects: len(objects)}
+	for _, o := range objects {
+		s.Size += o.Size
+	}
+	if len(objects) > 0 {
+		s.Oldest, s.Newest = objects[0].LastUsed, objects[len(objects)-1].LastUsed
+	}
+	return s, nil
+}
+
+// Verify checks the content of all the objects against their keys. The corrupted objects are removed and returned.
+func (c *Cache) Verify() (checked int, corrupted []string, err error) {
+	objects, err := c.Objects()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, o := range objects {
+		checked++
+		if expected, ok := digestsOfKey(o.Key); ok && o.File == c.Path(o.Key) {
+			calculated, e := common.DigestsOfFile(o.File)
+			if e == nil && expected.Verify(calculated) == nil {
+				continue
+			}
+		}
+		corrupted = append(corrupted, o.Key)
+		os.Remove(o.File)
+	}
+	return checked, corrupted, nil
+}
+
+// Prune removes the least recently used objects, except those in use, until the total size is within maxSize.
+// It also removes the temporary files left by interrupted runs if maxSize is 0.
+func (c *Cache) Prune(maxSize int64) (removed int, freed int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	objects, err := c.Objects()
+	if err != nil {
+		return 0, 0, err
+	}
+	var total int64
+	for _, o := range objects {
+		total += o.Size
+	}
+	for _, o := range objects {
+		if total <= maxSize {
+			break
+		}
+		if c.inUse[o.Key] > 0 {
+			continue
+		}
+		if err := os.Remove(o.File); err != nil {
+			return removed, freed, err
+		}
+		total -= o.Size
+		removed++
+		freed += o.Size
+	}
+	if maxSize == 0 && len(c.inUse) == 0 {
+		os.RemoveAll(path.Join(c.Dir, tmpDir))
+	}
+	return removed, freed, nil
+}
@@ -0,0 +1,166 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// The digests of "hello", "world" and "foo"
+var (
+	hello = common.Digests{Sha1: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", Size: 5}
+	world = common.Digests{Sha256: "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7", Size: 5}
+	foo   = common.Digests{Md5: "acbd18db4cc2f85cedef654fccc4a4d8", Size: 3}
+)
+
+func newServer(hits map[string]int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte(r.URL.Path[1:]))
+	}))
+}
+
+func TestFetch(t *testing.T) {
+	hits := make(map[string]int)
+	server := newServer(hits)
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+	c := Open(dir, 0)
+
+	Convey("TestFetch", t, func() {
+		So(KeyOf(hello), ShouldEqual, "sha1/"+hello.Sha1)
+		So(KeyOf(common.Digests{Md5: "ABC", Sha256: "DEF"}), ShouldEqual, "sha256/def")
+		So(KeyOf(common.Digests{Size: 5}), ShouldEqual, "")
+		So(Open(dir, 100), ShouldEqual, c)
+
+		file, release, err := c.Fetch(server.URL+"/hello", hello)
+		So(err, ShouldBeNil)
+		So(file, ShouldEqual, dir+"/sha1/aa/"+hello.Sha1)
+		release()
+		// Reused by another path with the same content
+		file, release, err = c.Fetch(server.URL+"/hello", hello)
+		So(err, ShouldBeNil)
+		release()
+		So(hits["/hello"], ShouldEqual, 1)
+
+		// Downloaded again if corrupted
+		ioutil.WriteFile(file, []byte("hellO"), 0644)
+		_, release, err = c.Fetch(server.URL+"/hello", hello)
+		So(err, ShouldBeNil)
+		release()
+		So(hits["/hello"], ShouldEqual, 2)
+		content, _ := ioutil.ReadFile(file)
+		So(string(content), ShouldEqual, "hello")
+
+		// Not cached if the content is not the expected one
+		c.Remove(KeyOf(hello))
+		_, _, err = c.Fetch(server.URL+"/hellO", hello)
+		So(err, ShouldNotBeNil)
+		So(common.FileOrDirExists(c.Path(KeyOf(hello))), ShouldBeFalse)
+		_, release, _ = c.Fetch(server.URL+"/hello", hello)
+		release()
+
+		// Not cached without checksum
+		file, release, err = c.Fetch(server.URL+"/foo", common.Digests{})
+		So(err, ShouldBeNil)
+		So(common.FileOrDirExists(file), ShouldBeTrue)
+		release()
+		So(common.FileOrDirExists(file), ShouldBeFalse)
+
+		s, _ := c.Stats()
+		So(s.Objects, ShouldEqual, 1)
+		So(s.Size, ShouldEqual, 5)
+	})
+}
+
+func TestEvict(t *testing.T) {
+	hits := make(map[string]int)
+	server := newServer(hits)
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+	c := Open(dir, 10)
+
+	Convey("TestEvict", t, func() {
+		_, release, _ := c.Fetch(server.URL+"/hello", hello)
+		release()
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(c.Path(KeyOf(hello)), old, old)
+
+		inUse, releaseWorld, _ := c.Fetch(server.URL+"/world", world)
+		os.Chtimes(inUse, old.Add(-time.Hour), old.Add(-time.Hour))
+		// "world" is the least recently used but in use, so "hello" is evicted
+		_, release, _ = c.Fetch(server.URL+"/foo", foo)
+		release()
+		releaseWorld()
+		So(common.FileOrDirExists(c.Path(KeyOf(hello))), ShouldBeFalse)
+		So(common.FileOrDirExists(inUse), ShouldBeTrue)
+
+		objects, _ := c.Objects()
+		So(len(objects), ShouldEqual, 2)
+		So(objects[0].Key, ShouldEqual, KeyOf(world))
+		So(objects[1].Key, ShouldEqual, KeyOf(foo))
+
+		removed, freed, err := c.Prune(3)
+		So(err, ShouldBeNil)
+		So(removed, ShouldEqual, 1)
+		So(freed, ShouldEqual, 5)
+		So(common.FileOrDirExists(c.Path(KeyOf(foo))), ShouldBeTrue)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	hits := make(map[string]int)
+	server := newServer(hits)
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+	c := Open(dir, 0)
+
+	Convey("TestVerify", t, func() {
+		for p, d := range map[string]common.Digests{"/hello": hello, "/world": world, "/foo": foo} {
+			_, release, err := c.Fetch(server.URL+p, d)
+			So(err, ShouldBeNil)
+			release()
+		}
+		ioutil.WriteFile(c.Path(KeyOf(world)), []byte("World"), 0644)
+
+		checked, corrupted, err := c.Verify()
+		So(err, ShouldBeNil)
+		So(checked, ShouldEqual, 3)
+		So(corrupted, ShouldResemble, []string{KeyOf(world)})
+		So(common.FileOrDirExists(c.Path(KeyOf(world))), ShouldBeFalse)
+
+		removed, _, _ := c.Prune(0)
+		So(removed, ShouldEqual, 2)
+		s, _ := c.Stats()
+		So(s.Objects, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,318 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+const (
+	AUTH_BASIC  = "basic"
+	AUTH_BEARER = "bearer"
+	AUTH_OIDC   = "oidc"
+
+	ENVAR_AUTH_CONFIG = "INDY_TEST_AUTH_CONFIG"
+	AUTH_CONFIG_FILE  = ".indy-test/auth.json"
+
+	// Refresh the OIDC token a bit earlier than it expires
+	tokenExpirySkew = 30 * time.Second
+)
+
+// AuthEntry is the credential of one endpoint, e.g, an indy or a pnc server. It applies to all the urls starting
+// with BaseURL.
+type AuthEntry struct {
+	BaseURL      string `json:"baseUrl"`
+	Type         string `json:"type"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	Token        string `json:"token,omitempty"`
+	TokenURL     string `json:"tokenUrl,omitempty"`
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+func (entry AuthEntry) Validate() error {
+	if IsEmptyString(entry.BaseURL) {
+		return fmt.Errorf("base url is not specified")
+	}
+	switch entry.Type {
+	case AUTH_BASIC:
+		if IsEmptyString(entry.Username) {
+			return fmt.Errorf("username is not specified for basic auth")
+		}
+	case AUTH_BEARER:
+		if IsEmptyString(entry.Token) {
+			return fmt.Errorf("token is not specified for bearer auth")
+		}
+	case AUTH_OIDC:
+		if IsEmptyString(entry.TokenURL) || IsEmptyString(entry.ClientID) {
+			return fmt.Errorf("token url and client id are mandatory for oidc auth")
+		}
+	default:
+		return fmt.Errorf("unknown auth type %s, should be one of %s, %s, %s", entry.Type, AUTH_BASIC, AUTH_BEARER, AUTH_OIDC)
+	}
+	return nil
+}
+
+// authenticator applies the credential of an AuthEntry to requests, and caches the OIDC access token
+type authenticator struct {
+	entry  AuthEntry
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (a *authenticator) authenticate(req *http.Request) error {
+	switch a.entry.Type {
+	case AUTH_BASIC:
+		req.SetBasicAuth(a.entry.Username, a.entry.Password)
+	case AUTH_BEARER:
+		req.Header.Set("Authorization", "Bearer "+a.entry.Token)
+	case AUTH_OIDC:
+		token, err := a.accessToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// invalidate drops the cached token so the next request gets a new one, e.g, after a 401 response
+func (a *authenticator) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+}
+
+func (a *authenticator) accessToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expiry) {
+		return a.token, nil
+	}
+	token, expiresIn, err := fetchClientCredentialsToken(a.entry)
+	if err != nil {
+		return "", err
+	}
+	a.token = token
+	a.expiry = time.Now().Add(expiresIn - tokenExpirySkew)
+	return a.token, nil
+}
+
+// fetchClientCredentialsToken gets an access token by the OIDC client credentials grant
+func fetchClientCredentialsToken(entry AuthEntry) (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if !IsEmptyString(entry.Scope) {
+		form.Set("scope", entry.Scope)
+	}
+	req, err := http.NewRequest(MethodPost, entry.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(entry.ClientID), url.QueryEscape(entry.ClientSecret))
+
+	resp, err := HTTPClient().Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot get token from %s: %s", entry.TokenURL, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != StatusOK {
+		return "", 0, fmt.Errorf("cannot get token from %s, status: %s, response: %s", entry.TokenURL, resp.Status, string(b))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &tokenResp); err != nil {
+		return "", 0, err
+	}
+	if tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("no access_token in response of %s", entry.TokenURL)
+	}
+	return tokenResp.AccessToken, time.Duration(tokenResp.ExpiresIn) * time.Second, nil
+}
+
+// VerifyAuthEntry checks the credential works as far as it can be checked locally, i.e, the oidc client
+// credentials can get a token.
+func VerifyAuthEntry(entry AuthEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	if entry.Type == AUTH_OIDC {
+		_, _, err := fetchClientCredentialsToken(entry)
+		return err
+	}
+	return nil
+}
+
+var (
+	authenticators []*authenticator
+	authMu         sync.RWMutex
+)
+
+// SetAuthEntries replaces the credentials used by all the requests
+func SetAuthEntries(entries []AuthEntry) {
+	var auths []*authenticator
+	for _, entry := range entries {
+		entry.BaseURL = NormIndyURL(entry.BaseURL)
+		auths = append(auths, &authenticator{entry: entry})
+	}
+	authMu.Lock()
+	defer authMu.Unlock()
+	authenticators = auths
+}
+
+// findAuthenticator returns the authenticator with the longest base url matching the request url, or nil
+func findAuthenticator(reqURL string) *authenticator {
+	authMu.RLock()
+	defer authMu.RUnlock()
+	var found *authenticator
+	for _, a := range authenticators {
+		base := a.entry.BaseURL
+		if reqURL == base || strings.HasPrefix(reqURL, base+"/") {
+			if found == nil || len(base) > len(found.entry.BaseURL) {
+				found = a
+			}
+		}
+	}
+	return found
+}
+
+// AuthFor returns the Authenticate of the configured credential for the url, or nil if none is configured
+func AuthFor(reqURL string) Authenticate {
+	a := findAuthenticator(reqURL)
+	if a == nil {
+		return nil
+	}
+	return a.authenticate
+}
+
+// GitAuthFor returns the go-git auth method of the configured credential for the git url, or nil
+func GitAuthFor(gitURL string) gittransport.AuthMethod {
+	a := findAuthenticator(gitURL)
+	if a == nil {
+		return nil
+	}
+	switch a.entry.Type {
+	case AUTH_BASIC:
+		return &githttp.BasicAuth{Username: a.entry.Username, Password: a.entry.Password}
+	case AUTH_BEARER:
+		return &githttp.TokenAuth{Token: a.entry.Token}
+	case AUTH_OIDC:
+		token, err := a.accessToken()
+		if err != nil {
+			fmt.Printf("Warning: cannot get token for %s, error: %s\n", gitURL, err)
+			return nil
+		}
+		return &githttp.TokenAuth{Token: token}
+	}
+	return nil
+}
+
+// DefaultAuthConfigFile returns the auth config file from env INDY_TEST_AUTH_CONFIG or $HOME/.indy-test/auth.json
+func DefaultAuthConfigFile() string {
+	if f := os.Getenv(ENVAR_AUTH_CONFIG); !IsEmptyString(f) {
+		return f
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(home, AUTH_CONFIG_FILE)
+}
+
+// LoadAuthConfig reads the credentials from the config file. A missing file means no credentials.
+func LoadAuthConfig(fileLoc string) ([]AuthEntry, error) {
+	var entries []AuthEntry
+	if IsEmptyString(fileLoc) || !FileOrDirExists(fileLoc) {
+		return entries, nil
+	}
+	b, err := ioutil.ReadFile(fileLoc)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("invalid auth config %s: %s", fileLoc, err)
+	}
+	return entries, nil
+}
+
+// SaveAuthEntry adds or replaces (by base url) the credential in the config file, which is only readable by the owner
+func SaveAuthEntry(fileLoc string, entry AuthEntry) error {
+	entry.BaseURL = NormIndyURL(entry.BaseURL)
+	entries, err := LoadAuthConfig(fileLoc)
+	if err != nil {
+		return err
+	}
+	var updated []AuthEntry
+	for _, e := range entries {
+		if NormIndyURL(e.BaseURL) != entry.BaseURL {
+			updated = append(updated, e)
+		}
+	}
+	return writeAuthConfig(fileLoc, append(updated, entry))
+}
+
+// RemoveAuthEntry removes the credential of the base url from the config file. Returns false if not found.
+func RemoveAuthEntry(fileLoc, baseURL string) (bool, error) {
+	entries, err := LoadAuthConfig(fileLoc)
+	if err != nil {
+		return false, err
+	}
+	var updated []AuthEntry
+	for _, e := range entries {
+		if NormIndyURL(e.BaseURL) != NormIndyURL(baseURL) {
+			updated = append(updated, e)
+		}
+	}
+	if len(updated) == len(entries) {
+		return false, nil
+	}
+	return true, writeAuthConfig(fileLoc, updated)
+}
+
+func writeAuthConfig(fileLoc string, entries []AuthEntry) error {
+	if entries == nil {
+		entries = []AuthEntry{}
+	}
+	if err := os.MkdirAll(path.Dir(fileLoc), 0700); err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(entries, "", "  ")
+	return ioutil.WriteFile(fileLoc, b, 0600)
+}
@@ -0,0 +1,118 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuth(t *testing.T) {
+	var tokens int32
+	revoked := ""
+	sso := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "indy-test" || secret != "secret" || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&tokens, 1)
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 300}`, n)
+	}))
+	defer sso.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth == "" || auth == "Bearer "+revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(auth))
+	}))
+	defer server.Close()
+	defer SetAuthEntries(nil)
+
+	Convey("TestAuth", t, func() {
+		Convey("No credential configured", func() {
+			SetAuthEntries(nil)
+			_, code, _ := HTTPRequest(server.URL+"/api/x", MethodGet, nil, true, nil, nil, "", false)
+			So(code, ShouldEqual, StatusUnauthorized)
+		})
+		Convey("Basic auth is applied by base url", func() {
+			SetAuthEntries([]AuthEntry{{BaseURL: server.URL, Type: AUTH_BASIC, Username: "jdoe", Password: "pwd"}})
+			content, _, _ := HTTPRequest(server.URL+"/api/x", MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldStartWith, "Basic ")
+			So(AuthFor("http://other.host/api/x"), ShouldBeNil)
+		})
+		Convey("Bearer token", func() {
+			SetAuthEntries([]AuthEntry{{BaseURL: server.URL, Type: AUTH_BEARER, Token: "static"}})
+			content, _, _ := HTTPRequest(server.URL+"/api/x", MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldEqual, "Bearer static")
+		})
+		Convey("OIDC token is cached, and refreshed after 401", func() {
+			atomic.StoreInt32(&tokens, 0)
+			SetAuthEntries([]AuthEntry{{BaseURL: server.URL, Type: AUTH_OIDC, TokenURL: sso.URL, ClientID: "indy-test", ClientSecret: "secret"}})
+			content, _, _ := HTTPRequest(server.URL+"/api/x", MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldEqual, "Bearer token-1")
+			content, _, _ = HTTPRequest(server.URL+"/api/y", MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldEqual, "Bearer token-1")
+			So(atomic.LoadInt32(&tokens), ShouldEqual, 1)
+
+			revoked = "token-1"
+			content, _, _ = HTTPRequest(server.URL+"/api/z", MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldEqual, "Bearer token-2")
+		})
+		Convey("Wrong client secret fails to login", func() {
+			err := VerifyAuthEntry(AuthEntry{BaseURL: server.URL, Type: AUTH_OIDC, TokenURL: sso.URL, ClientID: "indy-test", ClientSecret: "wrong"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAuthConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+	configFile := path.Join(dir, AUTH_CONFIG_FILE)
+
+	Convey("TestAuthConfig", t, func() {
+		So(SaveAuthEntry(configFile, AuthEntry{BaseURL: "indy.xyz.com/", Type: AUTH_BASIC, Username: "a"}), ShouldBeNil)
+		So(SaveAuthEntry(configFile, AuthEntry{BaseURL: "https://orch.xyz.com", Type: AUTH_BEARER, Token: "t"}), ShouldBeNil)
+		So(SaveAuthEntry(configFile, AuthEntry{BaseURL: "http://indy.xyz.com", Type: AUTH_BASIC, Username: "b"}), ShouldBeNil)
+
+		entries, err := LoadAuthConfig(configFile)
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 2)
+		So(entries[1].Username, ShouldEqual, "b")
+
+		info, _ := os.Stat(configFile)
+		So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+		removed, _ := RemoveAuthEntry(configFile, "https://orch.xyz.com")
+		So(removed, ShouldBeTrue)
+		entries, _ = LoadAuthConfig(configFile)
+		So(len(entries), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,146 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Sidecar files of the checksums, which are generated by indy for each artifact
+const (
+	EXT_MD5    = ".md5"
+	EXT_SHA1   = ".sha1"
+	EXT_SHA256 = ".sha256"
+)
+
+// Digests are the checksums and the size of a content, e.g, recorded by folo. Empty checksums and a zero size
+// are not checked.
+type Digests struct {
+	Md5    string
+	Sha1   string
+	Sha256 string
+	Size   int64
+}
+
+// DigestsOf returns the digests recorded in a folo entry
+func DigestsOf(entry TrackedContentEntry) Digests {
+	return Digests{Md5: entry.Md5, Sha1: entry.Sha1, Sha256: entry.Sha256, Size: entry.Size}
+}
+
+// Checksum returns the checksum of a sidecar extension, e.g, Sha1 for ".sha1"
+func (d Digests) Checksum(ext string) string {
+	switch ext {
+	case EXT_MD5:
+		return d.Md5
+	case EXT_SHA1:
+		return d.Sha1
+	case EXT_SHA256:
+		return d.Sha256
+	}
+	return ""
+}
+
+// Verify checks the calculated digests against the expected ones. All the mismatches are in the error.
+func (d Digests) Verify(calculated Digests) error {
+	var e MultiError
+	for _, ext := range []string{EXT_MD5, EXT_SHA1, EXT_SHA256} {
+		expected := d.Checksum(ext)
+		if expected != "" && !strings.EqualFold(expected, calculated.Checksum(ext)) {
+			e.Append(fmt.Sprintf("%s not match, expected: %s, calculated: %s", ext[1:], expected, calculated.Checksum(ext)))
+		}
+	}
+	if d.Size > 0 && d.Size != calculated.Size {
+		e.Append(fmt.Sprintf("size not match, expected: %d, calculated: %d", d.Size, calculated.Size))
+	}
+	if e.Error() != "" {
+		return &e
+	}
+	return nil
+}
+
+// DigestWriter calculates the digests of the content written to it, so that a download is verified in the same
+// pass as it is stored
+type DigestWriter struct {
+	md5    hash.Hash
+	sha1   hash.Hash
+	sha256 hash.Hash
+	size   int64
+}
+
+func NewDigestWriter() *DigestWriter {
+	return &DigestWriter{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+}
+
+func (w *DigestWriter) Write(p []byte) (int, error) {
+	w.md5.Write(p)
+	w.sha1.Write(p)
+	w.sha256.Write(p)
+	w.size += int64(len(p))
+	return len(p), nil
+}
+
+// Digests returns the digests of the content written so far
+func (w *DigestWriter) Digests() Digests {
+	return Digests{
+		Md5:    fmt.Sprintf("%x", w.md5.Sum(nil)),
+		Sha1:   fmt.Sprintf("%x", w.sha1.Sum(nil)),
+		Sha256: fmt.Sprintf("%x", w.sha256.Sum(nil)),
+		Size:   w.size,
+	}
+}
+
+// DigestsOfFile calculates the digests of the file
+func DigestsOfFile(fileLoc string) (Digests, error) {
+	f, err := os.Open(fileLoc)
+	if err != nil {
+		return Digests{}, err
+	}
+	defer f.Close()
+	w := NewDigestWriter()
+	if _, err := io.Copy(w, f); err != nil {
+		return Digests{}, err
+	}
+	return w.Digests(), nil
+}
+
+// VerifyFile checks the digests of the file. Non-regular (i.e, metadata) files are skipped.
+func VerifyFile(fileLoc string, expected Digests) error {
+	if !IsRegularFile(fileLoc) {
+		return nil
+	}
+	calculated, err := DigestsOfFile(fileLoc)
+	if err != nil {
+		return err
+	}
+	return expected.Verify(calculated)
+}
+
+// ParseChecksum returns the checksum in the content of a sidecar file, which may be followed by the file name
+func ParseChecksum(content string) string {
+	toks := strings.Fields(content)
+	if len(toks) == 0 {
+		return ""
+	}
+	return toks[0]
+}
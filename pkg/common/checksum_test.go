@@ -0,0 +1,82 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// The digests of "hello"
+var helloDigests = Digests{
+	Md5:    "5d41402abc4b2a76b9719d911017c592",
+	Sha1:   "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+	Sha256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	Size:   5,
+}
+
+func TestDigests(t *testing.T) {
+	Convey("TestDigests", t, func() {
+		w := NewDigestWriter()
+		w.Write([]byte("hel"))
+		w.Write([]byte("lo"))
+		So(w.Digests(), ShouldResemble, helloDigests)
+
+		So(helloDigests.Verify(w.Digests()), ShouldBeNil)
+		So(Digests{}.Verify(w.Digests()), ShouldBeNil)
+		So(Digests{Sha1: "AAF4C61DDCC5E8A2DABEDE0F3B482CD9AEA9434D"}.Verify(w.Digests()), ShouldBeNil)
+
+		err := Digests{Md5: helloDigests.Md5, Sha256: "bad", Size: 6}.Verify(w.Digests())
+		So(err.Error(), ShouldEqual, "sha256 not match, expected: bad, calculated: "+helloDigests.Sha256+
+			", size not match, expected: 6, calculated: 5")
+
+		So(ParseChecksum(helloDigests.Sha1+"  hello.txt\n"), ShouldEqual, helloDigests.Sha1)
+		So(ParseChecksum(""), ShouldEqual, "")
+	})
+}
+
+func TestDownloadAndVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "checksum")
+	defer os.RemoveAll(dir)
+
+	matched := DownloadAndVerify(server.URL+"/foo.jar", path.Join(dir, "foo.jar"), helloDigests)
+	mismatched := DownloadAndVerify(server.URL+"/bar.jar", path.Join(dir, "bar.jar"), Digests{Sha1: "bad"})
+	cacheErr := DownloadUploadFileForCache(server.URL+"/baz.jar", path.Join(dir, "baz.jar"), Digests{Size: 4})
+
+	Convey("TestDownloadAndVerify", t, func() {
+		So(matched.Err, ShouldBeNil)
+		So(matched.Digests, ShouldResemble, helloDigests)
+		So(VerifyFile(path.Join(dir, "foo.jar"), helloDigests), ShouldBeNil)
+		So(VerifyFile(path.Join(dir, "foo.jar"), Digests{Md5: "bad"}), ShouldNotBeNil)
+
+		So(mismatched.Err.Error(), ShouldStartWith, "sha1 not match")
+		So(mismatched.StatusCode, ShouldEqual, http.StatusOK)
+
+		So(cacheErr.Error(), ShouldStartWith, "size not match")
+		So(FileOrDirExists(path.Join(dir, "baz.jar")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,176 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TLSOptions configures https for all the indy and pnc traffic
+type TLSOptions struct {
+	CACert             string // PEM bundle of extra CAs, appended to the system pool
+	ClientCert         string // PEM client certificate for mutual TLS
+	ClientKey          string // PEM private key of the client certificate
+	InsecureSkipVerify bool
+}
+
+// TransportOptions tunes the connection pooling and timeouts of the shared http client. Zero timeout means no limit.
+type TransportOptions struct {
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int // 0 means no limit
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	Timeout               time.Duration // overall timeout of a request, including reading the response body
+	TCPKeepAlive          time.Duration
+	DisableKeepAlives     bool
+	DisableHTTP2          bool
+}
+
+// DefaultTransportOptions are close to the maven http wagon defaults, i.e, up to 20 connections per host
+var DefaultTransportOptions = TransportOptions{
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   20,
+	DialTimeout:           30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 5 * time.Minute,
+	IdleConnTimeout:       90 * time.Second,
+	Timeout:               30 * time.Minute,
+	TCPKeepAlive:          30 * time.Second,
+}
+
+var (
+	tlsConfig        = &tls.Config{}
+	caBundle         []byte
+	transportOptions = DefaultTransportOptions
+	httpClient       = newHTTPClient(tlsConfig, transportOptions)
+	clientMu         sync.RWMutex
+)
+
+// HTTPClient returns the http client shared by all the requests
+func HTTPClient() *http.Client {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return httpClient
+}
+
+// ConfigureTLS rebuilds the shared http client with the TLS options
+func ConfigureTLS(opts TLSOptions) error {
+	config, bundle, err := opts.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	tlsConfig, caBundle = config, bundle
+	replaceHTTPClient()
+	return nil
+}
+
+// ConfigureTransport rebuilds the shared http client with the transport options
+func ConfigureTransport(opts TransportOptions) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	transportOptions = opts
+	replaceHTTPClient()
+}
+
+// Should be called with write lock held
+func replaceHTTPClient() {
+	httpClient.CloseIdleConnections()
+	httpClient = newHTTPClient(tlsConfig, transportOptions)
+}
+
+func newHTTPClient(config *tls.Config, opts TransportOptions) *http.Client {
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: opts.TCPKeepAlive}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       config,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     opts.DisableKeepAlives,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+	}
+	if opts.DisableHTTP2 {
+		// A non-nil empty map disables the automatic HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
+
+// GetCABundle returns the extra CA bundle configured, which is also used by git operations
+func GetCABundle() []byte {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return caBundle
+}
+
+// GetInsecureSkipVerify tells if the server certificates are not verified, which is also used by git operations
+func GetInsecureSkipVerify() bool {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return tlsConfig.InsecureSkipVerify
+}
+
+func (opts TLSOptions) tlsConfig() (*tls.Config, []byte, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+
+	var bundle []byte
+	if !IsEmptyString(opts.CACert) {
+		b, err := ioutil.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read CA cert %s: %s", opts.CACert, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, nil, fmt.Errorf("no valid PEM certificate found in %s", opts.CACert)
+		}
+		tlsConfig.RootCAs = pool
+		bundle = b
+	}
+
+	if IsEmptyString(opts.ClientCert) != IsEmptyString(opts.ClientKey) {
+		return nil, nil, fmt.Errorf("client cert and client key must be specified together")
+	}
+	if !IsEmptyString(opts.ClientCert) {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot load client cert %s: %s", opts.ClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, bundle, nil
+}
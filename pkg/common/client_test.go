@@ -0,0 +1,72 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransport(t *testing.T) {
+	stall := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stalled" {
+			<-stall
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	defer close(stall)
+
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	defer SetRetryPolicy(DefaultRetryPolicy)
+	defer ConfigureTransport(DefaultTransportOptions)
+
+	Convey("TestTransport", t, func() {
+		Convey("The shared client is reused until reconfigured", func() {
+			ConfigureTransport(DefaultTransportOptions)
+			client := HTTPClient()
+			So(HTTPClient(), ShouldEqual, client)
+			So(client.Timeout, ShouldEqual, DefaultTransportOptions.Timeout)
+
+			opts := DefaultTransportOptions
+			opts.DisableHTTP2 = true
+			ConfigureTransport(opts)
+			So(HTTPClient(), ShouldNotEqual, client)
+			So(HTTPClient().Transport.(*http.Transport).TLSNextProto, ShouldNotBeNil)
+		})
+		Convey("Stalled server fails by response header timeout", func() {
+			opts := DefaultTransportOptions
+			opts.ResponseHeaderTimeout = 200 * time.Millisecond
+			ConfigureTransport(opts)
+
+			start := time.Now()
+			_, err := DoRequest(MethodGet, server.URL+"/stalled", nil, nil, nil)
+			So(err, ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+			resp, err := DoRequest(MethodGet, server.URL+"/ok", nil, nil, nil)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, StatusOK)
+		})
+	})
+}
@@ -47,7 +47,9 @@ func getRepo(gitURL, directory string, clone bool) (r *git.Repository, err error
 			URL:               gitURL,
 			Progress:          os.Stdout,
 			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-			InsecureSkipTLS:   true,
+			InsecureSkipTLS:   GetInsecureSkipVerify(),
+			CABundle:          GetCABundle(),
+			Auth:              GitAuthFor(gitURL),
 		})
 	} else {
 		fmt.Printf("Open existed repo %s\n", directory)
@@ -69,7 +71,7 @@ func goGit(gitURL, directory string) string {
 	}
 
 	// Updating heads
-	fetchUpdates(r)
+	fetchUpdates(r, gitURL)
 
 	showHEAD(r)
 
@@ -93,11 +95,14 @@ func showHEAD(r *git.Repository) {
 }
 
 // Fetching updates...
-func fetchUpdates(r *git.Repository) {
+func fetchUpdates(r *git.Repository, gitURL string) {
 	fmt.Printf("Fetching Refs....\n")
 	err := r.Fetch(&git.FetchOptions{
-		RefSpecs: []config.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
-		Progress: os.Stdout,
+		RefSpecs:        []config.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
+		Progress:        os.Stdout,
+		InsecureSkipTLS: GetInsecureSkipVerify(),
+		CABundle:        GetCABundle(),
+		Auth:            GitAuthFor(gitURL),
 	})
 	if err != git.NoErrAlreadyUpToDate {
 		checkIfError(err)
@@ -0,0 +1,231 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Values below 2^histSubBucketBits microseconds are recorded exactly, larger ones with a relative error < 1%
+const (
+	histSubBucketBits  = 8
+	histSubBucketCount = 1 << histSubBucketBits
+	histSubBucketHalf  = histSubBucketCount / 2
+)
+
+// Histogram is a HDR-style latency histogram with log-linear buckets in microseconds. It has a fixed relative
+// precision and a small memory footprint regardless of the number of values. It's safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	counts []int64
+	total  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// HistogramBucket is a range of latency and the number of values in it
+type HistogramBucket struct {
+	From  time.Duration `json:"from"`
+	To    time.Duration `json:"to"`
+	Count int64         `json:"count"`
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func histIndex(us int64) int {
+	if us < histSubBucketCount {
+		return int(us)
+	}
+	shift := bits.Len64(uint64(us)) - histSubBucketBits
+	sub := us >> uint(shift)
+	return histSubBucketCount + (shift-1)*histSubBucketHalf + int(sub-histSubBucketHalf)
+}
+
+// histRange returns the lowest and the highest value (in microseconds) of the bucket
+func histRange(index int) (int64, int64) {
+	if index < histSubBucketCount {
+		return int64(index), int64(index)
+	}
+	shift := uint((index-histSubBucketCount)/histSubBucketHalf + 1)
+	sub := int64((index-histSubBucketCount)%histSubBucketHalf + histSubBucketHalf)
+	return sub << shift, ((sub + 1) << shift) - 1
+}
+
+// Record adds a latency value
+func (h *Histogram) Record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.record(d)
+}
+
+// RecordCorrected adds a latency value, and corrects the coordinated omission: if the value is larger than the
+// expected interval between requests, the requests which should have been sent while waiting are recorded too,
+// with linearly decreasing latencies.
+func (h *Histogram) RecordCorrected(d, expectedInterval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.record(d)
+	if expectedInterval <= 0 {
+		return
+	}
+	for missing := d - expectedInterval; missing >= expectedInterval; missing -= expectedInterval {
+		h.record(missing)
+	}
+}
+
+func (h *Histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	index := histIndex(d.Microseconds())
+	if index >= len(h.counts) {
+		counts := make([]int64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+}
+
+// Merge adds all the values of the other histogram
+func (h *Histogram) Merge(other *Histogram) {
+	other.mu.Lock()
+	counts := append([]int64{}, other.counts...)
+	total, sum, min, max := other.total, other.sum, other.min, other.max
+	other.mu.Unlock()
+	if total == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(counts) > len(h.counts) {
+		grown := make([]int64, len(counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || min < h.min {
+		h.min = min
+	}
+	if max > h.max {
+		h.max = max
+	}
+	h.total += total
+	h.sum += sum
+}
+
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+func (h *Histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// ValueAtPercentile returns the latency which the given percentage (0 to 100) of the values are less than or
+// equal to. The result is the highest value of the bucket, or the max recorded value if it is in the bucket.
+func (h *Histogram) ValueAtPercentile(percentile float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	threshold := int64(math.Ceil(percentile / 100 * float64(h.total)))
+	if threshold < 1 {
+		threshold = 1
+	}
+	var count int64
+	for i, c := range h.counts {
+		count += c
+		if count >= threshold {
+			if i == histIndex(h.max.Microseconds()) {
+				return h.max
+			}
+			_, high := histRange(i)
+			d := time.Duration(high) * time.Microsecond
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+// Buckets returns the distribution in power-of-2 ranges starting from 1ms, e.g, [0, 1ms), [1ms, 2ms), [2ms, 4ms).
+// Empty leading and trailing ranges are omitted.
+func (h *Histogram) Buckets() []HistogramBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var buckets []HistogramBucket
+	if h.total == 0 {
+		return buckets
+	}
+	from, to := time.Duration(0), time.Millisecond
+	buckets = append(buckets, HistogramBucket{From: from, To: to})
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		low, _ := histRange(i)
+		d := time.Duration(low) * time.Microsecond
+		for d >= to {
+			from, to = to, to*2
+			buckets = append(buckets, HistogramBucket{From: from, To: to})
+		}
+		buckets[len(buckets)-1].Count += c
+	}
+	for len(buckets) > 0 && buckets[0].Count == 0 {
+		buckets = buckets[1:]
+	}
+	return buckets
+}
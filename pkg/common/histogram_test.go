@@ -0,0 +1,70 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHistogram(t *testing.T) {
+	Convey("TestHistogram", t, func() {
+		Convey("Bucket ranges cover all the values", func() {
+			for _, us := range []int64{0, 1, 255, 256, 257, 511, 512, 1000, 123456, 98765432} {
+				low, high := histRange(histIndex(us))
+				So(low <= us && us <= high, ShouldBeTrue)
+				So(float64(high-low), ShouldBeLessThanOrEqualTo, float64(us)/100+1)
+			}
+		})
+		Convey("Percentiles", func() {
+			h := NewHistogram()
+			for i := 1; i <= 1000; i++ {
+				h.Record(time.Duration(i) * time.Millisecond)
+			}
+			So(h.Count(), ShouldEqual, 1000)
+			So(h.Min(), ShouldEqual, time.Millisecond)
+			So(h.Max(), ShouldEqual, time.Second)
+			So(h.Mean(), ShouldEqual, 500500*time.Microsecond)
+			So(h.ValueAtPercentile(50), ShouldAlmostEqual, 500*time.Millisecond, 5*time.Millisecond)
+			So(h.ValueAtPercentile(99), ShouldAlmostEqual, 990*time.Millisecond, 10*time.Millisecond)
+			So(h.ValueAtPercentile(100), ShouldEqual, time.Second)
+
+			buckets := h.Buckets()
+			So(buckets[0].From, ShouldEqual, time.Millisecond)
+			So(buckets[len(buckets)-1].To, ShouldEqual, 1024*time.Millisecond)
+			var total int64
+			for _, b := range buckets {
+				total += b.Count
+			}
+			So(total, ShouldEqual, 1000)
+		})
+		Convey("Coordinated omission correction and merge", func() {
+			h := NewHistogram()
+			h.RecordCorrected(100*time.Millisecond, 10*time.Millisecond)
+			So(h.Count(), ShouldEqual, 10) // 100ms, 90ms, ..., 10ms
+
+			other := NewHistogram()
+			other.Record(time.Second)
+			h.Merge(other)
+			So(h.Count(), ShouldEqual, 11)
+			So(h.Max(), ShouldEqual, time.Second)
+			So(h.Min(), ShouldEqual, 10*time.Millisecond)
+		})
+	})
+}
@@ -115,7 +115,7 @@ func GetPort(URLString string) string {
 }
 
 func GetRespAsPlaintext(url string) (string, error) {
-	resp, err := http.Get(url)
+	resp, err := DoRequest(MethodGet, url, nil, nil, nil)
 	if err != nil {
 		return "", newHTTPError(err.Error(), 0)
 	}
@@ -124,7 +124,7 @@ func GetRespAsPlaintext(url string) (string, error) {
 	status, statusCode := resp.Status, resp.StatusCode
 
 	if statusCode == StatusUnauthorized {
-		fmt.Print("This API needs authorization, seems you need to get accesss token first. Please have a look at login command.\n\n")
+		fmt.Printf("This API needs authorization, seems you need to get access token first. Please run 'indy-test login' for %s.\n\n", url)
 		return "", newHTTPError(status, statusCode)
 	}
 
@@ -145,7 +145,7 @@ func GetRespAsPlaintext(url string) (string, error) {
 }
 
 func GetRespAsJSONType(url string, jsonType interface{}) error {
-	resp, err := http.Get(url)
+	resp, err := DoRequest(MethodGet, url, nil, nil, nil)
 	if err != nil {
 		return newHTTPError(err.Error(), 0)
 	}
@@ -154,7 +154,7 @@ func GetRespAsJSONType(url string, jsonType interface{}) error {
 	status, statusCode := resp.Status, resp.StatusCode
 
 	if statusCode == StatusUnauthorized {
-		fmt.Print("This API needs authorization, seems you need to get accesss token first. Please have a look at login command.\n\n")
+		fmt.Printf("This API needs authorization, seems you need to get access token first. Please run 'indy-test login' for %s.\n\n", url)
 		return newHTTPError(status, statusCode)
 	}
 
@@ -183,30 +183,13 @@ func GetRespAsJSONType(url string, jsonType interface{}) error {
 // Parameters: request url; request method; authentication method; if need response content; data payload to send(POST or PUT); headers to send; the file location to store if response is a binary download; if print verbose log message for debugging
 // Returns: content as string, response status code as int, if succeeded as bool
 func HTTPRequest(url, method string, auth Authenticate, needResult bool, dataPayload io.Reader, headers map[string]string, filename string, verbose bool) (string, int, bool) {
-	client := &http.Client{}
 	respText := ""
-	req, err := http.NewRequest(method, url, dataPayload)
-	if err != nil {
-		fmt.Println(err)
-		return respText, StatusUnknown, false
-	}
-	if len(headers) > 0 {
-		for key, val := range headers {
-			req.Header.Add(key, val)
-		}
-	}
-	if auth != nil {
-		err := auth(req)
-		if err != nil {
-			fmt.Println(err)
-			return "", StatusUnknown, false
-		}
-	}
-	resp, err := client.Do(req)
+	resp, err := DoRequest(method, url, dataPayload, headers, auth)
 	if err != nil {
 		fmt.Println(err)
 		return respText, StatusUnknown, false
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		fmt.Printf("%s request not success for %s, status: %s, return code: %v\n", method, url, resp.Status, resp.StatusCode)
@@ -220,8 +203,6 @@ func HTTPRequest(url, method string, auth Authenticate, needResult bool, dataPay
 			panic(err)
 		}
 
-		resp.Body.Close()
-
 		return string(content), resp.StatusCode, true
 	}
 
@@ -243,63 +224,112 @@ func (err HTTPError) Error() string {
 }
 
 func HttpExists(url string) bool {
-	client := &http.Client{}
-	req, _ := http.NewRequest(MethodGet, url, nil)
-	resp, err := client.Do(req)
+	resp, err := DoRequest(MethodGet, url, nil, nil, nil)
 	if err != nil {
 		fmt.Printf("Can not get %s, err: %s\n", url, err)
 		return false
 	}
+	resp.Body.Close()
 	if resp.StatusCode == 200 {
 		return true
 	}
 	return false
 }
 
+// TransferResult is the outcome of a download or an upload
+type TransferResult struct {
+	URL        string
+	StatusCode int // StatusUnknown if no response is received
+	Size       int64
+	Duration   time.Duration
+	Timing     *RequestTiming
+	Digests    Digests // of the content, only calculated by DownloadAndVerify and StreamFileWithResult
+	Err        error
+}
+
+func (r TransferResult) Succeeded() bool {
+	return r.Err == nil
+}
+
 func DownloadFile(url, storeFileName string) bool {
+	return DownloadFileWithResult(url, storeFileName).Succeeded()
+}
+
+// DownloadFileWithResult is the same as DownloadFile but returns the details of the transfer
+func DownloadFileWithResult(url, storeFileName string) TransferResult {
 	fmt.Printf("[%s] Downloading %s\n", time.Now().Format(DATA_TIME), url)
 	start := time.Now()
-	if download(url, storeFileName) {
-		end := time.Now()
-		diff := end.Sub(start)
-		milliSecs := diff.Milliseconds()
-		size := FileSize(storeFileName)
-		fmt.Printf("[%s] Downloaded %s (%s at %s)\n", time.Now().Format(DATA_TIME), url, ByteCountSI(size), calculateSpeed(size, int64(milliSecs)))
-		return true
+	result := download(url, storeFileName, nil)
+	result.Duration = time.Since(start)
+	if result.Succeeded() {
+		fmt.Printf("[%s] Downloaded %s (%s at %s) [%s]\n", time.Now().Format(DATA_TIME), url, ByteCountSI(result.Size), calculateSpeed(result.Size, result.Duration), result.Timing)
 	}
-	return false
+	return result
+}
+
+// DownloadAndVerify is the same as DownloadFileWithResult, but also calculates the digests while storing the file
+// and checks them against the expected ones. A mismatch is the error of the result.
+func DownloadAndVerify(url, storeFileName string, expected Digests) TransferResult {
+	fmt.Printf("[%s] Downloading %s\n", time.Now().Format(DATA_TIME), url)
+	start := time.Now()
+	w := NewDigestWriter()
+	result := download(url, storeFileName, w)
+	result.Duration = time.Since(start)
+	if !result.Succeeded() {
+		return result
+	}
+	result.Digests = w.Digests()
+	if err := expected.Verify(result.Digests); err != nil {
+		fmt.Printf("Error: %s, url: %s\n", err, url)
+		result.Err = err
+		return result
+	}
+	fmt.Printf("[%s] Downloaded %s (%s at %s) [%s]\n", time.Now().Format(DATA_TIME), url, ByteCountSI(result.Size), calculateSpeed(result.Size, result.Duration), result.Timing)
+	return result
 }
 
-func calculateSpeed(size, duration int64) string {
-	speed := (size * 1000) / duration
+func calculateSpeed(size int64, duration time.Duration) string {
+	if duration <= 0 {
+		duration = time.Nanosecond
+	}
+	speed := int64(float64(size) / duration.Seconds())
 	return fmt.Sprintf("%s/s", ByteCountSI(speed))
 }
 
-func DownloadUploadFileForCache(url, cacheFileName string) bool {
+// DownloadUploadFileForCache downloads the file to upload and checks its digests. The file is removed if they
+// do not match, so that it is not reused.
+func DownloadUploadFileForCache(url, cacheFileName string, expected Digests) error {
 	fmt.Printf("[%s] Downloading %s before uploading it. \n", time.Now().Format(DATA_TIME), url)
-	if download(url, cacheFileName) {
-		fmt.Printf("[%s] Downloaded %s before uploading it. \n", time.Now().Format(DATA_TIME), url)
-		return true
+	w := NewDigestWriter()
+	result := download(url, cacheFileName, w)
+	if !result.Succeeded() {
+		return result.Err
 	}
-	return false
+	if err := expected.Verify(w.Digests()); err != nil {
+		os.Remove(cacheFileName)
+		return err
+	}
+	fmt.Printf("[%s] Downloaded %s before uploading it. \n", time.Now().Format(DATA_TIME), url)
+	return nil
 }
 
-func download(url, storeFileName string) bool {
-	client := &http.Client{}
-	req, err := http.NewRequest(MethodGet, url, nil)
+// download stores the content of the url to the file. The content is also written to w if not nil.
+func download(url, storeFileName string, w io.Writer) TransferResult {
+	result := TransferResult{URL: url, StatusCode: StatusUnknown}
+	resp, err := DoRequest(MethodGet, url, nil, nil, nil)
 	if err != nil {
 		fmt.Printf("Can not download file %s, err: %s\n", url, err)
-		return false
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Can not download file %s, err: %s\n", url, err)
-		return false
+		result.Err = err
+		return result
 	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Timing = ResponseTiming(resp)
 
 	if resp.StatusCode >= 400 {
 		fmt.Printf("Can not download file %s because of error response, status: %s, return code: %v\n", url, resp.Status, resp.StatusCode)
-		return false
+		result.Err = fmt.Errorf("error response, status: %s", resp.Status)
+		return result
 	}
 
 	conDispo := resp.Header.Get("Content-Disposition")
@@ -328,25 +358,41 @@ func download(url, storeFileName string) bool {
 	out, err := os.Create(filePath)
 	if err != nil {
 		fmt.Printf("Warning: cannot download file due to io error! error is %s\n", err.Error())
-		return false
+		result.Err = err
+		return result
 	} else {
 		defer out.Close()
-		_, err = io.Copy(out, resp.Body)
+		var dst io.Writer = out
+		if w != nil {
+			dst = io.MultiWriter(out, w)
+		}
+		result.Size, err = io.Copy(dst, resp.Body)
 		if err != nil {
 			fmt.Printf("Warning: cannot download file due to io error! error is %s\n", err.Error())
-			return false
+			result.Err = err
+			return result
 		}
 	}
-	return true
+	resp.Body.Close() // finishes the timing
+	return result
 }
 
 func UploadFile(uploadUrl, cacheFile string) bool {
+	return UploadFileWithResult(uploadUrl, cacheFile).Succeeded()
+}
+
+// UploadFileWithResult is the same as UploadFile but returns the details of the transfer
+func UploadFileWithResult(uploadUrl, cacheFile string) (result TransferResult) {
 	fmt.Printf("[%s] Uploading %s\n", time.Now().Format(DATA_TIME), uploadUrl)
 	start := time.Now()
+	result = TransferResult{URL: uploadUrl, StatusCode: StatusUnknown}
+	defer func() { result.Duration = time.Since(start) }()
+
 	data, err := os.Open(cacheFile)
 	if err != nil {
 		fmt.Printf("Warning: Upload failed for %s, error: %s", uploadUrl, err.Error())
-		return false
+		result.Err = err
+		return result
 	}
 	defer data.Close()
 
@@ -356,14 +402,22 @@ func UploadFile(uploadUrl, cacheFile string) bool {
 	// 	mimeType = "text/plain"
 	// }
 	// headers := map[string]string{"Content-Type": mimeType}
-	_, _, succeeded := HTTPRequest(uploadUrl, MethodPut, nil, false, data, nil, "", false)
-	if succeeded {
-		end := time.Now()
-		diff := end.Sub(start)
-		milliSecs := diff.Milliseconds()
-		size := FileSize(cacheFile)
-		fmt.Printf("[%s] Uploaded %s (%s at %s)\n", time.Now().Format(DATA_TIME), uploadUrl, ByteCountSI(size), calculateSpeed(size, int64(milliSecs)))
-		return true
+	resp, err := DoRequest(MethodPut, uploadUrl, data, nil, nil)
+	if err != nil {
+		fmt.Printf("Warning: Upload failed for %s, error: %s\n", uploadUrl, err.Error())
+		result.Err = err
+		return result
 	}
-	return false
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Timing = ResponseTiming(resp)
+	if resp.StatusCode >= 400 {
+		fmt.Printf("%s request not success for %s, status: %s, return code: %v\n", MethodPut, uploadUrl, resp.Status, resp.StatusCode)
+		result.Err = fmt.Errorf("error response, status: %s", resp.Status)
+		return result
+	}
+	result.Size = FileSize(cacheFile)
+	fmt.Printf("[%s] Uploaded %s (%s at %s) [%s]\n", time.Now().Format(DATA_TIME), uploadUrl, ByteCountSI(result.Size), calculateSpeed(result.Size, time.Since(start)), result.Timing)
+	return result
 }
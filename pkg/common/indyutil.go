@@ -2,68 +2,50 @@ package common
 
 import (
 	"fmt"
-	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"strings"
 )
 
-func ValidateTargetIndyOrExit(targetIndy string) (string, bool) {
-	targetIndyHost, validated := ValidateTargetIndy(targetIndy)
-	if !validated {
-		os.Exit(1)
-	}
-	return targetIndyHost, validated
-}
-
+// ValidateTargetIndy checks the indy server is reachable, and returns its base url with scheme, e.g,
+// "https://indy.xyz.com". The scheme is preserved if specified, otherwise "http://" is used.
 func ValidateTargetIndy(targetIndy string) (string, bool) {
-	indyHost := targetIndy
-	if strings.HasPrefix(targetIndy, "http") {
-		host := GetHost(targetIndy)
-		port := GetPort(targetIndy)
-		if IsEmptyString(port) || port == "80" {
-			indyHost = host
-		} else {
-			indyHost = fmt.Sprintf("%s:%s", host, port)
-		}
-	} else {
-		indyHost = strings.Split(targetIndy, "/")[0]
+	indyBaseUrl := NormIndyURL(targetIndy)
+	u, err := url.ParseRequestURI(indyBaseUrl)
+	if err != nil || IsEmptyString(u.Host) {
+		fmt.Printf("Error: not a valid indy server: %s\n", targetIndy)
+		return "", false
 	}
-
-	indyTest := ""
-	var indyAPIBase string
-	if strings.HasPrefix(indyHost, "http") {
-		indyAPIBase = indyHost + "/api"
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		indyBaseUrl = u.Scheme + "://" + u.Hostname()
 	} else {
-		indyAPIBase = "http://" + indyHost + "/api"
+		indyBaseUrl = u.Scheme + "://" + u.Host
 	}
 
-	fmt.Printf("Start testing target indy server %s\n", indyHost)
-	_, err := url.ParseRequestURI(indyAPIBase)
-	if err == nil {
-		testPath := "/admin/stores/maven/remote/central"
-		indyTest = indyAPIBase + testPath
-		_, err = url.ParseRequestURI(indyTest)
-		if err != nil {
-			fmt.Printf("Error: not a valid indy server: %s because %s does not exist\n", targetIndy, testPath)
-			return "", false
-		}
-	} else {
-		fmt.Printf("Error: not a valid indy server: %s\n", targetIndy)
-		return "", false
-	}
-	resp, err2 := http.Get(indyTest)
+	fmt.Printf("Start testing target indy server %s\n", indyBaseUrl)
+	testPath := "/admin/stores/maven/remote/central"
+	indyTest := indyBaseUrl + "/api" + testPath
+	resp, err2 := DoRequest(MethodGet, indyTest, nil, nil, nil)
 	if err2 != nil {
 		fmt.Printf("Error: %s is not a valid indy server. Cause: %s\n", targetIndy, err2)
 		return "", false
 	}
+	resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
 		fmt.Printf("Error: %s returned bad status. Cause: %s\n", targetIndy, resp.Status)
 		return "", false
 	}
-	resp.Body.Close()
-	return indyHost, true
+	return indyBaseUrl, true
+}
+
+// NormIndyURL adds "http://" if the url has no scheme, and removes the trailing "/"
+func NormIndyURL(indyURL string) string {
+	indy := strings.TrimSpace(indyURL)
+	if !strings.HasPrefix(indy, "http://") && !strings.HasPrefix(indy, "https://") {
+		indy = "http://" + indy
+	}
+	return strings.TrimRight(indy, "/")
 }
 
 func StoreKeyToPath(storeKey string) string {
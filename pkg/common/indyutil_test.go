@@ -1,6 +1,12 @@
 package common
 
 import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -11,3 +17,54 @@ func TestStoreKeyToPath(t *testing.T) {
 		So(StoreKeyToPath("maven:hosted:shared-imports"), ShouldEqual, "maven/hosted/shared-imports")
 	})
 }
+
+func TestNormIndyURL(t *testing.T) {
+	Convey("TestNormIndyURL", t, func() {
+		So(NormIndyURL("indy.xyz.com"), ShouldEqual, "http://indy.xyz.com")
+		So(NormIndyURL("http://indy.xyz.com/"), ShouldEqual, "http://indy.xyz.com")
+		So(NormIndyURL("https://indy.xyz.com:8443"), ShouldEqual, "https://indy.xyz.com:8443")
+	})
+}
+
+func TestValidateTargetIndyTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/maven/remote/central") {
+			w.Write([]byte("{}"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	defer ConfigureTLS(TLSOptions{})
+
+	caFile, _ := ioutil.TempFile("", "ca")
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile.Close()
+
+	Convey("TestValidateTargetIndyTLS", t, func() {
+		Convey("Untrusted server should fail", func() {
+			ConfigureTLS(TLSOptions{})
+			_, validated := ValidateTargetIndy(server.URL)
+			So(validated, ShouldBeFalse)
+		})
+		Convey("Trusted by CA cert, https should be preserved", func() {
+			So(ConfigureTLS(TLSOptions{CACert: caFile.Name()}), ShouldBeNil)
+			// Also trusted by git operations, which still verify the certificates
+			So(GetCABundle(), ShouldNotBeEmpty)
+			So(GetInsecureSkipVerify(), ShouldBeFalse)
+			baseUrl, validated := ValidateTargetIndy(server.URL)
+			So(validated, ShouldBeTrue)
+			So(baseUrl, ShouldEqual, server.URL)
+		})
+		Convey("Insecure skip verify", func() {
+			So(ConfigureTLS(TLSOptions{InsecureSkipVerify: true}), ShouldBeNil)
+			So(GetInsecureSkipVerify(), ShouldBeTrue)
+			_, validated := ValidateTargetIndy(server.URL)
+			So(validated, ShouldBeTrue)
+		})
+		Convey("Client cert without key is invalid", func() {
+			So(ConfigureTLS(TLSOptions{ClientCert: caFile.Name()}), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,245 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	PACKAGE_TYPE_MAVEN = "maven"
+	PACKAGE_TYPE_NPM   = "npm"
+	NPM_PACKAGE_JSON   = "package.json"
+)
+
+// PackageTypeOf returns the package type of a store key, e.g, "npm" of "npm:hosted:build-1234"
+func PackageTypeOf(storeKey string) string {
+	return strings.SplitN(storeKey, ":", 2)[0]
+}
+
+// IsNpmTarball checks if the path is an npm tarball, e.g, "/@scope/foo/-/foo-1.0.0-redhat-00001.tgz"
+func IsNpmTarball(aPath string) bool {
+	return strings.Contains(aPath, "/-/") && strings.HasSuffix(aPath, ".tgz")
+}
+
+// IsNpmMetadata checks if the path is an npm package document, i.e, "/foo", "/@scope/foo" or their "package.json"
+func IsNpmMetadata(aPath string) bool {
+	p := strings.TrimSuffix(strings.Trim(aPath, "/"), "/"+NPM_PACKAGE_JSON)
+	toks := strings.Split(p, "/")
+	return p != "" && (len(toks) == 1 || (len(toks) == 2 && strings.HasPrefix(toks[0], "@")))
+}
+
+// IsPackageMetadata checks if the path is metadata of the package type, which is generated by indy rather than
+// promoted, i.e, maven-metadata.xml for maven and the package document for npm
+func IsPackageMetadata(packageType, aPath string) bool {
+	if packageType == PACKAGE_TYPE_NPM {
+		return IsNpmMetadata(aPath)
+	}
+	return IsMetadata(aPath)
+}
+
+// NpmPackageName returns the package name of an npm path, e.g, "@scope/foo" of "/@scope/foo/-/foo-1.0.0.tgz",
+// "/@scope/foo/package.json" or "/@scope/foo"
+func NpmPackageName(aPath string) string {
+	p := strings.Trim(aPath, "/")
+	if i := strings.Index(p, "/-/"); i >= 0 {
+		return p[:i]
+	}
+	return strings.TrimSuffix(p, "/"+NPM_PACKAGE_JSON)
+}
+
+// NpmMetadataPath returns the path of the package document of an npm package, e.g, "/@scope/foo/package.json"
+func NpmMetadataPath(packageName string) string {
+	return path.Join("/", packageName, NPM_PACKAGE_JSON)
+}
+
+// NpmMetadataVersions returns the versions in an npm package document, sorted
+func NpmMetadataVersions(content []byte) ([]string, error) {
+	var doc struct {
+		Versions map[string]interface{} `json:"versions"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("invalid npm package document, %s", err)
+	}
+	var versions []string
+	for v := range doc.Versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// AlterNpmPackageJSON replaces the release number in the version of a package.json, e.g, 1.0.0-redhat-00001 to
+// 1.0.0-redhat-<newReleaseNumber>. Only the top-level "version" is altered, not the ones nested in other fields,
+// and the other fields, e.g, the versions of the dependencies, are kept as is.
+func AlterNpmPackageJSON(content []byte, newReleaseNumber string) []byte {
+	start, end, version := npmPackageVersion(content)
+	if start < 0 {
+		return content
+	}
+	encoded, _ := json.Marshal(AlterUploadPath(version, newReleaseNumber))
+	altered := append([]byte{}, content[:start]...)
+	altered = append(altered, encoded...)
+	return append(altered, content[end:]...)
+}
+
+// npmPackageVersion finds the top-level "version" of a package.json, and returns the offsets of the value in the
+// content, with the quotes. The start is -1 if not found.
+func npmPackageVersion(content []byte) (int, int, string) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return -1, -1, ""
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		var value json.RawMessage // skips the nested objects as a whole
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+		var version string
+		if key == "version" && json.Unmarshal(value, &version) == nil {
+			end := int(decoder.InputOffset())
+			return end - len(value), end, version
+		}
+	}
+	return -1, -1, ""
+}
+
+// AlterNpmMetadata replaces the release number of the versions in an npm package document, i.e, the keys of
+// "versions", the version and tarball of each, and "dist-tags". The checksums of the tarballs are dropped since
+// the tarballs are altered too.
+func AlterNpmMetadata(content []byte, newReleaseNumber string) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("invalid npm package document, %s", err)
+	}
+	if versions, ok := doc["versions"].(map[string]interface{}); ok {
+		altered := make(map[string]interface{})
+		for v, meta := range versions {
+			if m, ok := meta.(map[string]interface{}); ok {
+				if version, ok := m["version"].(string); ok {
+					m["version"] = AlterUploadPath(version, newReleaseNumber)
+				}
+				if dist, ok := m["dist"].(map[string]interface{}); ok {
+					if tarball, ok := dist["tarball"].(string); ok {
+						dist["tarball"] = AlterUploadPath(tarball, newReleaseNumber)
+					}
+					delete(dist, "shasum")
+					delete(dist, "integrity")
+				}
+			}
+			altered[AlterUploadPath(v, newReleaseNumber)] = meta
+		}
+		doc["versions"] = altered
+	}
+	if tags, ok := doc["dist-tags"].(map[string]interface{}); ok {
+		for tag, v := range tags {
+			if version, ok := v.(string); ok {
+				tags[tag] = AlterUploadPath(version, newReleaseNumber)
+			}
+		}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// AlterNpmTarball copies the npm tarball from src to dst, with the version in its package.json replaced by
+// AlterNpmPackageJSON
+func AlterNpmTarball(src, dst, newReleaseNumber string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := AlterNpmTarballStream(in, out, newReleaseNumber); err != nil {
+		return fmt.Errorf("invalid npm tarball %s, %s", src, err)
+	}
+	return nil
+}
+
+// AlterNpmTarballStream is AlterNpmTarball from a reader to a writer. Only the package.json at the top directory
+// of the tarball, e.g, "package/package.json", is altered.
+func AlterNpmTarballStream(r io.Reader, w io.Writer, newReleaseNumber string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if toks := strings.Split(strings.TrimPrefix(hdr.Name, "./"), "/"); len(toks) == 2 && toks[1] == NPM_PACKAGE_JSON {
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			altered := AlterNpmPackageJSON(content, newReleaseNumber)
+			hdr.Size = int64(len(altered))
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(altered); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	// Drain the rest, e.g, the padding of the tar and the trailer of the gzip, so that a verifying reader gets
+	// the whole content
+	if _, err := io.Copy(ioutil.Discard, gr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
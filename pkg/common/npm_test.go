@@ -0,0 +1,171 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const packageJSON = `{
+  "name": "@redhat/foo",
+  "version": "1.0.0-redhat-00001",
+  "dependencies": {
+    "bar": "2.0.0-redhat-00003"
+  }
+}`
+
+// newTarball creates an npm tarball with the files, e.g, "package/package.json"
+func newTarball(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func readTarball(b []byte) map[string]string {
+	files := make(map[string]string)
+	gr, _ := gzip.NewReader(bytes.NewReader(b))
+	tr := tar.NewReader(gr)
+	for hdr, err := tr.Next(); err == nil; hdr, err = tr.Next() {
+		content, _ := ioutil.ReadAll(tr)
+		files[hdr.Name] = string(content)
+	}
+	return files
+}
+
+func TestNpmPaths(t *testing.T) {
+	Convey("TestNpmPaths", t, func() {
+		So(PackageTypeOf("npm:hosted:build-1234"), ShouldEqual, PACKAGE_TYPE_NPM)
+		So(IsNpmTarball("/@redhat/foo/-/foo-1.0.0-redhat-00001.tgz"), ShouldBeTrue)
+		So(IsNpmTarball("/org/foo/bar/1.0/bar-1.0.tgz"), ShouldBeFalse)
+		for _, p := range []string{"/foo", "/foo/package.json", "/@redhat/foo", "/@redhat/foo/package.json"} {
+			So(IsNpmMetadata(p), ShouldBeTrue)
+		}
+		for _, p := range []string{"/", "/foo/-/foo-1.0.0.tgz", "/foo/bar", "/org/foo/bar/maven-metadata.xml"} {
+			So(IsNpmMetadata(p), ShouldBeFalse)
+		}
+		So(IsPackageMetadata(PACKAGE_TYPE_NPM, "/@redhat/foo"), ShouldBeTrue)
+		So(IsPackageMetadata(PACKAGE_TYPE_MAVEN, "/org/foo/bar/maven-metadata.xml"), ShouldBeTrue)
+		So(IsPackageMetadata(PACKAGE_TYPE_MAVEN, "/foo"), ShouldBeFalse)
+
+		So(NpmPackageName("/@redhat/foo/-/foo-1.0.0-redhat-00001.tgz"), ShouldEqual, "@redhat/foo")
+		So(NpmPackageName("/@redhat/foo/package.json"), ShouldEqual, "@redhat/foo")
+		So(NpmPackageName("/foo"), ShouldEqual, "foo")
+		So(NpmMetadataPath("@redhat/foo"), ShouldEqual, "/@redhat/foo/package.json")
+	})
+}
+
+func TestAlterNpm(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "npm")
+	defer os.RemoveAll(dir)
+	src, dst := path.Join(dir, "foo.tgz"), path.Join(dir, "foo.tgz.99999")
+	ioutil.WriteFile(src, newTarball(map[string]string{
+		"package/package.json":     packageJSON,
+		"package/index.js":         "module.exports = {}",
+		"package/lib/package.json": `{"version": "1.0.0-redhat-00001"}`,
+	}), 0644)
+	tarballErr := AlterNpmTarball(src, dst, "99999")
+	altered, _ := ioutil.ReadFile(dst)
+
+	metadata := []byte(`{
+  "name": "@redhat/foo",
+  "dist-tags": {"latest": "1.0.0-redhat-00001"},
+  "versions": {
+    "1.0.0-redhat-00001": {
+      "name": "@redhat/foo",
+      "version": "1.0.0-redhat-00001",
+      "dist": {
+        "tarball": "http://indy/api/content/npm/hosted/build-1/@redhat/foo/-/foo-1.0.0-redhat-00001.tgz",
+        "shasum": "abc"
+      }
+    }
+  }
+}`)
+	alteredMetadata, metadataErr := AlterNpmMetadata(metadata, "99999")
+
+	Convey("TestAlterNpm", t, func() {
+		So(string(AlterNpmPackageJSON([]byte(packageJSON), "99999")), ShouldContainSubstring, `"version": "1.0.0-redhat-99999"`)
+		So(string(AlterNpmPackageJSON([]byte(packageJSON), "99999")), ShouldContainSubstring, `"bar": "2.0.0-redhat-00003"`)
+
+		So(tarballErr, ShouldBeNil)
+		files := readTarball(altered)
+		So(len(files), ShouldEqual, 3)
+		So(files["package/package.json"], ShouldEqual, string(AlterNpmPackageJSON([]byte(packageJSON), "99999")))
+		So(files["package/index.js"], ShouldEqual, "module.exports = {}")
+		So(files["package/lib/package.json"], ShouldEqual, `{"version": "1.0.0-redhat-00001"}`)
+
+		So(metadataErr, ShouldBeNil)
+		versions, _ := NpmMetadataVersions(alteredMetadata)
+		So(versions, ShouldResemble, []string{"1.0.0-redhat-99999"})
+		var doc struct {
+			DistTags map[string]string `json:"dist-tags"`
+			Versions map[string]struct {
+				Version string            `json:"version"`
+				Dist    map[string]string `json:"dist"`
+			} `json:"versions"`
+		}
+		json.Unmarshal(alteredMetadata, &doc)
+		So(doc.DistTags["latest"], ShouldEqual, "1.0.0-redhat-99999")
+		v := doc.Versions["1.0.0-redhat-99999"]
+		So(v.Version, ShouldEqual, "1.0.0-redhat-99999")
+		So(v.Dist["tarball"], ShouldEndWith, "/@redhat/foo/-/foo-1.0.0-redhat-99999.tgz")
+		So(v.Dist["shasum"], ShouldBeEmpty)
+
+		_, err := AlterNpmMetadata([]byte("not json"), "99999")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAlterNpmPackageJSONNested(t *testing.T) {
+	Convey("Only the top-level version is altered, even if a nested one comes first", t, func() {
+		content := `{
+  "name": "@redhat/foo",
+  "publishConfig": {"registry": "http://registry", "version": "0.9.0-redhat-00001"},
+  "engines": {"node": ">=10"},
+  "version": "1.0.0-redhat-00001",
+  "config": {"version": "1.0.0-redhat-00001"}
+}`
+		altered := string(AlterNpmPackageJSON([]byte(content), "99999"))
+		So(altered, ShouldEqual, strings.Replace(content, `"version": "1.0.0-redhat-00001",`, `"version": "1.0.0-redhat-99999",`, 1))
+
+		var doc struct {
+			Version string `json:"version"`
+		}
+		So(json.Unmarshal([]byte(altered), &doc), ShouldBeNil)
+		So(doc.Version, ShouldEqual, "1.0.0-redhat-99999")
+
+		So(string(AlterNpmPackageJSON([]byte(`{"config": {"version": "1.0.0-redhat-00001"}}`), "99999")), ShouldEqual,
+			`{"config": {"version": "1.0.0-redhat-00001"}}`)
+		So(string(AlterNpmPackageJSON([]byte("not json"), "99999")), ShouldEqual, "not json")
+	})
+}
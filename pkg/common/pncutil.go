@@ -18,19 +18,11 @@ package common
 
 import (
 	"io/ioutil"
-	"net/http"
 )
 
 func GetAlignLog(pncBaseUrl, buildId string) string {
 	alignUrl := pncBaseUrl + "/pnc-rest/v2/builds/" + buildId + "/logs/align"
-	req, err := http.NewRequest(http.MethodGet, alignUrl, nil)
-	if err != nil {
-		panic(err)
-	}
-	req.Header.Set("Accept", "text/plain")
-
-	var c http.Client
-	resp, err := c.Do(req)
+	resp, err := DoRequest(MethodGet, alignUrl, nil, map[string]string{"Accept": ContentTypePlain}, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,234 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy decides how a failed request is retried. A request is retried on connection errors and on the
+// retryable status codes, with exponential backoff (base * 2^n, capped) and random jitter.
+type RetryPolicy struct {
+	// Total attempts including the first one. 1 means no retry.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Fraction (0 to 1) of the backoff delay which is randomized, e.g, 0.5 means delay * [0.5, 1.0)
+	Jitter          float64
+	RetryableStatus []int
+	// Retry non-idempotent methods (POST, PATCH) too. Should be used with care, e.g, promotion is not idempotent.
+	RetryNonIdempotent bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	BaseDelay:       500 * time.Millisecond,
+	MaxDelay:        10 * time.Second,
+	Jitter:          0.5,
+	RetryableStatus: []int{http.StatusTooManyRequests, StatusBadGateway, StatusServiceUnavailable, StatusGatewayTimeout},
+}
+
+var (
+	retryPolicy   = DefaultRetryPolicy
+	retryPolicyMu sync.RWMutex
+)
+
+func SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	retryPolicyMu.Lock()
+	defer retryPolicyMu.Unlock()
+	retryPolicy = policy
+}
+
+func GetRetryPolicy() RetryPolicy {
+	retryPolicyMu.RLock()
+	defer retryPolicyMu.RUnlock()
+	return retryPolicy
+}
+
+// Backoff returns the delay before the n-th retry (starting from 1)
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(n-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay = delay * (1 - jitter*rand.Float64())
+	}
+	return time.Duration(delay)
+}
+
+func (p RetryPolicy) isRetryableStatus(statusCode int) bool {
+	for _, code := range p.RetryableStatus {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case MethodGet, MethodHead, MethodPut, MethodDelete, MethodOptions:
+		return true
+	}
+	return false
+}
+
+// RetryStats counts the logical requests, the extra attempts (retries) and the final failures separately,
+// so flakiness of the server is visible even if all the requests finally succeeded.
+type RetryStats struct {
+	Requests  int64
+	Retries   int64
+	Recovered int64 // requests succeeded after at least one retry
+	Failures  int64 // requests finally failed, by error or by status code >= 400
+}
+
+var retryStats RetryStats
+
+func GetRetryStats() RetryStats {
+	return RetryStats{
+		Requests:  atomic.LoadInt64(&retryStats.Requests),
+		Retries:   atomic.LoadInt64(&retryStats.Retries),
+		Recovered: atomic.LoadInt64(&retryStats.Recovered),
+		Failures:  atomic.LoadInt64(&retryStats.Failures),
+	}
+}
+
+func PrintRetryStats() {
+	stats := GetRetryStats()
+	if stats.Requests == 0 {
+		return
+	}
+	fmt.Printf("HTTP requests: %d, retries: %d (recovered requests: %d), failed requests: %d\n",
+		stats.Requests, stats.Retries, stats.Recovered, stats.Failures)
+}
+
+// DoRequest sends a request and retries it per the retry policy. The body is re-sent on retries only if it is
+// an io.Seeker (e.g, *os.File, *strings.Reader); otherwise the request is sent once. If auth is nil, the credential
+// configured for the url (see SetAuthEntries) is used. The caller must close the response body when err is nil.
+func DoRequest(method, url string, body io.Reader, headers map[string]string, auth Authenticate) (*http.Response, error) {
+	policy := GetRetryPolicy()
+	atomic.AddInt64(&retryStats.Requests, 1)
+
+	var authn *authenticator
+	if auth == nil {
+		if authn = findAuthenticator(url); authn != nil {
+			auth = authn.authenticate
+		}
+	}
+	reauthenticated := false
+
+	seeker, seekable := body.(io.Seeker)
+	var offset int64
+	if seekable {
+		offset, _ = seeker.Seek(0, io.SeekCurrent)
+	}
+	maxAttempts := policy.MaxAttempts
+	if (body != nil && !seekable) || (!isIdempotent(method) && !policy.RetryNonIdempotent) {
+		maxAttempts = 1
+	}
+
+	// The body is consumed by each send, including the one rejected with 401 for the reauthentication
+	resend := false
+	for attempt := 1; ; attempt++ {
+		if resend && seekable {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				atomic.AddInt64(&retryStats.Failures, 1)
+				return nil, err
+			}
+		}
+		resp, err := sendOnce(method, url, body, headers, auth)
+		resend = true
+
+		// The cached OIDC token may be revoked before it expires, get a new one and try again
+		if err == nil && resp.StatusCode == StatusUnauthorized && authn != nil && authn.entry.Type == AUTH_OIDC &&
+			!reauthenticated && (body == nil || seekable) {
+			reauthenticated = true
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			authn.invalidate()
+			attempt--
+			continue
+		}
+
+		var cause string
+		if err != nil {
+			cause = err.Error()
+		} else if policy.isRetryableStatus(resp.StatusCode) {
+			cause = resp.Status
+		} else {
+			if attempt > 1 && resp.StatusCode < 400 {
+				atomic.AddInt64(&retryStats.Recovered, 1)
+			}
+			if resp.StatusCode >= 400 {
+				atomic.AddInt64(&retryStats.Failures, 1)
+			}
+			return resp, nil
+		}
+
+		if attempt >= maxAttempts {
+			atomic.AddInt64(&retryStats.Failures, 1)
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		delay := policy.Backoff(attempt)
+		atomic.AddInt64(&retryStats.Retries, 1)
+		fmt.Printf("Retry #%d of %s %s in %v, cause: %s\n", attempt, method, url, delay, cause)
+		time.Sleep(delay)
+	}
+}
+
+func sendOnce(method, url string, body io.Reader, headers map[string]string, auth Authenticate) (*http.Response, error) {
+	// The transport closes the request body if it's a Closer, e.g, *os.File, which prevents it from being re-sent
+	if closer, ok := body.(io.ReadCloser); ok {
+		body = ioutil.NopCloser(closer)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range headers {
+		req.Header.Add(key, val)
+	}
+	if auth != nil {
+		if err := auth(req); err != nil {
+			return nil, err
+		}
+	}
+	req, timing := traceRequest(req)
+	resp, err := HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &tracedBody{ReadCloser: resp.Body, timing: timing}
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flakyServer fails the first n requests with 503, and records the bodies it received
+func flakyServer(n int32, bodies *[]string) *httptest.Server {
+	var count int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		*bodies = append(*bodies, string(b))
+		if atomic.AddInt32(&count, 1) <= n {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestRetry(t *testing.T) {
+	defer SetRetryPolicy(GetRetryPolicy())
+	policy := DefaultRetryPolicy
+	policy.BaseDelay = time.Millisecond
+	SetRetryPolicy(policy)
+
+	Convey("TestRetry", t, func() {
+		Convey("GET should be retried on 503", func() {
+			var bodies []string
+			server := flakyServer(2, &bodies)
+			defer server.Close()
+			before := GetRetryStats()
+			content, code, ok := HTTPRequest(server.URL, MethodGet, nil, true, nil, nil, "", false)
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, StatusOK)
+			So(content, ShouldEqual, "ok")
+			after := GetRetryStats()
+			So(after.Retries-before.Retries, ShouldEqual, 2)
+			So(after.Recovered-before.Recovered, ShouldEqual, 1)
+			So(after.Failures-before.Failures, ShouldEqual, 0)
+		})
+		Convey("Upload body should be re-sent on retry", func() {
+			var bodies []string
+			server := flakyServer(1, &bodies)
+			defer server.Close()
+			f, _ := ioutil.TempFile("", "retry")
+			defer os.Remove(f.Name())
+			f.WriteString("content")
+			f.Close()
+			So(UploadFile(server.URL, f.Name()), ShouldBeTrue)
+			So(bodies, ShouldResemble, []string{"content", "content"})
+		})
+		Convey("Upload body should be re-sent after the OIDC token is refreshed", func() {
+			var tokens int32
+			sso := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 300}`, atomic.AddInt32(&tokens, 1))
+			}))
+			defer sso.Close()
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+				if r.Header.Get("Authorization") == "Bearer token-1" { // revoked
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+			defer SetAuthEntries(nil)
+			SetAuthEntries([]AuthEntry{{BaseURL: server.URL, Type: AUTH_OIDC, TokenURL: sso.URL, ClientID: "indy-test", ClientSecret: "secret"}})
+
+			_, code, ok := HTTPRequest(server.URL+"/foo.jar", MethodPut, nil, false, strings.NewReader("content"), nil, "", false)
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, StatusCreated)
+			So(bodies, ShouldResemble, []string{"content", "content"})
+		})
+		Convey("POST should not be retried by default", func() {
+			var bodies []string
+			server := flakyServer(1, &bodies)
+			defer server.Close()
+			_, code, ok := HTTPRequest(server.URL, MethodPost, nil, true, strings.NewReader("promote"), nil, "", false)
+			So(ok, ShouldBeFalse)
+			So(code, ShouldEqual, StatusServiceUnavailable)
+			So(len(bodies), ShouldEqual, 1)
+		})
+		Convey("Give up after max attempts", func() {
+			var bodies []string
+			server := flakyServer(10, &bodies)
+			defer server.Close()
+			before := GetRetryStats()
+			_, _, ok := HTTPRequest(server.URL, MethodGet, nil, false, nil, nil, "", false)
+			So(ok, ShouldBeFalse)
+			So(len(bodies), ShouldEqual, policy.MaxAttempts)
+			So(GetRetryStats().Failures-before.Failures, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	Convey("TestBackoff", t, func() {
+		So(policy.Backoff(1), ShouldEqual, 100*time.Millisecond)
+		So(policy.Backoff(3), ShouldEqual, 400*time.Millisecond)
+		So(policy.Backoff(10), ShouldEqual, time.Second)
+		policy.Jitter = 0.5
+		for i := 0; i < 10; i++ {
+			So(policy.Backoff(2), ShouldBeBetweenOrEqual, 100*time.Millisecond, 200*time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// VerifyingReader calculates the digests of the content read through it. At the end of the content, a mismatch
+// with the expected digests is returned as the error instead of io.EOF, so that a streamed upload is aborted
+// rather than completed with a wrong content.
+type VerifyingReader struct {
+	r        io.Reader
+	w        *DigestWriter
+	expected Digests
+	mismatch error
+}
+
+func NewVerifyingReader(r io.Reader, expected Digests) *VerifyingReader {
+	return &VerifyingReader{r: r, w: NewDigestWriter(), expected: expected}
+}
+
+func (v *VerifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.w.Write(p[:n])
+	if err == io.EOF {
+		if v.mismatch = v.expected.Verify(v.w.Digests()); v.mismatch != nil {
+			return n, v.mismatch
+		}
+	}
+	return n, err
+}
+
+// Mismatch returns the mismatch of the digests if the whole content is read, otherwise nil
+func (v *VerifyingReader) Mismatch() error {
+	return v.mismatch
+}
+
+// StreamFileWithResult gets the content of srcURL and puts it to dstURL without storing it in a file, verifying
+// the expected digests on the fly. Content up to memLimit bytes is read into memory first, so that it is verified
+// before the upload, and the upload can be retried. Larger content, or content of unknown length, is piped from
+// the GET to the PUT, which is aborted if the digests do not match. If alter is not nil, it rewrites the content
+// on the way, e.g, the version of an npm package. The size and digests of the result are of the uploaded content.
+func StreamFileWithResult(srcURL, dstURL string, expected Digests, memLimit int64, alter func(io.Reader, io.Writer) error) (result TransferResult) {
+	fmt.Printf("[%s] Streaming %s to %s\n", time.Now().Format(DATA_TIME), srcURL, dstURL)
+	start := time.Now()
+	result = TransferResult{URL: dstURL, StatusCode: StatusUnknown}
+	defer func() { result.Duration = time.Since(start) }()
+
+	resp, err := DoRequest(MethodGet, srcURL, nil, nil, nil)
+	if err != nil {
+		fmt.Printf("Can not get %s, err: %s\n", srcURL, err)
+		result.Err = fmt.Errorf("cannot get %s, %s", srcURL, err)
+		return result
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		fmt.Printf("Can not get %s because of error response, status: %s\n", srcURL, resp.Status)
+		result.Err = fmt.Errorf("cannot get %s, status: %s", srcURL, resp.Status)
+		return result
+	}
+
+	src := NewVerifyingReader(resp.Body, expected)
+	uploaded := NewDigestWriter()
+	var body io.Reader
+	if resp.ContentLength >= 0 && resp.ContentLength <= memLimit {
+		b, err := ioutil.ReadAll(src)
+		if err == nil && alter != nil {
+			var buf bytes.Buffer
+			err = alter(bytes.NewReader(b), &buf)
+			b = buf.Bytes()
+		}
+		if err != nil {
+			fmt.Printf("Error: %s, url: %s\n", err, srcURL)
+			result.Err = err
+			return result
+		}
+		uploaded.Write(b)
+		body = bytes.NewReader(b)
+	} else {
+		var r io.Reader = src
+		if alter != nil {
+			pr, pw := io.Pipe()
+			defer pr.Close() // stops the altering if the upload fails
+			go func() { pw.CloseWithError(alter(src, pw)) }()
+			r = pr
+		}
+		body = io.TeeReader(r, uploaded)
+	}
+
+	putResp, err := DoRequest(MethodPut, dstURL, body, nil, nil)
+	if src.Mismatch() != nil {
+		err = src.Mismatch()
+	}
+	if err != nil {
+		fmt.Printf("Warning: Upload failed for %s, error: %s\n", dstURL, err)
+		result.Err = err
+		return result
+	}
+	io.Copy(ioutil.Discard, putResp.Body)
+	putResp.Body.Close()
+	result.StatusCode = putResp.StatusCode
+	result.Timing = ResponseTiming(putResp)
+	if putResp.StatusCode >= 400 {
+		fmt.Printf("%s request not success for %s, status: %s, return code: %v\n", MethodPut, dstURL, putResp.Status, putResp.StatusCode)
+		result.Err = fmt.Errorf("error response, status: %s", putResp.Status)
+		return result
+	}
+	result.Digests = uploaded.Digests()
+	result.Size = result.Digests.Size
+	fmt.Printf("[%s] Streamed %s (%s at %s) [%s]\n", time.Now().Format(DATA_TIME), dstURL, ByteCountSI(result.Size), calculateSpeed(result.Size, time.Since(start)), result.Timing)
+	return result
+}
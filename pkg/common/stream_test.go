@@ -0,0 +1,91 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreamFileWithResult(t *testing.T) {
+	var mu sync.Mutex
+	stored := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			stored[r.URL.Path] = string(b)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.URL.Path == "/chunked" {
+			// unknown length, so it's always piped
+			w.Write([]byte("hel"))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("lo"))
+	}))
+	defer server.Close()
+	upper := func(r io.Reader, w io.Writer) error {
+		b, err := ioutil.ReadAll(r)
+		if err == nil {
+			_, err = w.Write(bytes.ToUpper(b))
+		}
+		return err
+	}
+
+	inMemory := StreamFileWithResult(server.URL+"/lo", server.URL+"/a", Digests{Size: 2}, 1024, nil)
+	piped := StreamFileWithResult(server.URL+"/chunked", server.URL+"/b", helloDigests, 1024, nil)
+	altered := StreamFileWithResult(server.URL+"/chunked", server.URL+"/c", helloDigests, 0, upper)
+	mismatched := StreamFileWithResult(server.URL+"/chunked", server.URL+"/d", Digests{Sha1: "bad"}, 1024, nil)
+	mismatchedInMemory := StreamFileWithResult(server.URL+"/lo", server.URL+"/e", Digests{Size: 3}, 1024, nil)
+
+	Convey("TestStreamFileWithResult", t, func() {
+		So(inMemory.Err, ShouldBeNil)
+		So(inMemory.StatusCode, ShouldEqual, http.StatusCreated)
+		So(inMemory.Size, ShouldEqual, 2)
+		So(stored["/a"], ShouldEqual, "lo")
+
+		So(piped.Err, ShouldBeNil)
+		So(piped.Digests, ShouldResemble, helloDigests)
+		So(stored["/b"], ShouldEqual, "hello")
+
+		So(altered.Err, ShouldBeNil)
+		So(altered.Size, ShouldEqual, 5)
+		So(altered.Digests.Md5, ShouldNotEqual, helloDigests.Md5)
+		So(stored["/c"], ShouldEqual, "HELLO")
+
+		So(mismatched.Err.Error(), ShouldStartWith, "sha1 not match")
+		So(stored, ShouldNotContainKey, "/d")
+
+		So(mismatchedInMemory.Err.Error(), ShouldStartWith, "size not match")
+		So(mismatchedInMemory.StatusCode, ShouldEqual, StatusUnknown)
+		So(stored, ShouldNotContainKey, "/e")
+	})
+}
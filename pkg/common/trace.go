@@ -0,0 +1,320 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of a http request. DNS, connect and TLS only happen when a new connection is established.
+const (
+	PHASE_DNS      = "dns"
+	PHASE_CONNECT  = "connect"
+	PHASE_TLS      = "tls"
+	PHASE_SEND     = "send"     // writing the request, including the body of an upload
+	PHASE_TTFB     = "ttfb"     // from the request written to the first response byte, i.e, the server processing time
+	PHASE_TRANSFER = "transfer" // from the first response byte to the end of the response body
+	PHASE_TOTAL    = "total"
+)
+
+var phases = []string{PHASE_DNS, PHASE_CONNECT, PHASE_TLS, PHASE_SEND, PHASE_TTFB, PHASE_TRANSFER, PHASE_TOTAL}
+
+// RequestTiming is the latency breakdown of one http request. It's complete after the response body is closed.
+type RequestTiming struct {
+	Method string
+	URL    string
+	Reused bool // the connection was reused from the pool
+
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	Send     time.Duration
+	TTFB     time.Duration
+	Transfer time.Duration
+	Total    time.Duration
+
+	start, dnsStart, connectStart, tlsStart, gotConn, wroteRequest, firstByte time.Time
+
+	mu   sync.Mutex
+	done bool
+}
+
+// clientTrace records the phase times under the lock, as some callbacks, e.g, ConnectDone, run on the dialer
+// goroutine, which may even outlive the request
+func (t *RequestTiming) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.locked(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.locked(func() { t.DNS = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			t.locked(func() {
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.locked(func() {
+				if err == nil {
+					t.Connect = time.Since(t.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			t.locked(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.locked(func() { t.TLS = time.Since(t.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.locked(func() {
+				t.gotConn = time.Now()
+				t.Reused = info.Reused
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.locked(func() {
+				t.wroteRequest = time.Now()
+				t.Send = t.wroteRequest.Sub(t.gotConn)
+			})
+		},
+		GotFirstResponseByte: func() {
+			t.locked(func() {
+				t.firstByte = time.Now()
+				t.TTFB = t.firstByte.Sub(t.wroteRequest)
+			})
+		},
+	}
+}
+
+func (t *RequestTiming) locked(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f()
+}
+
+// finish is called when the response body is read to the end or closed
+func (t *RequestTiming) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	now := time.Now()
+	if !t.firstByte.IsZero() {
+		t.Transfer = now.Sub(t.firstByte)
+	}
+	t.Total = now.Sub(t.start)
+	timingStats.add(t)
+}
+
+func (t *RequestTiming) String() string {
+	if t == nil {
+		return "no timing"
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn := "new conn"
+	if t.Reused {
+		conn = "reused conn"
+	}
+	return fmt.Sprintf("%s, dns: %v, connect: %v, tls: %v, send: %v, ttfb: %v, transfer: %v, total: %v", conn,
+		roundDuration(t.DNS), roundDuration(t.Connect), roundDuration(t.TLS), roundDuration(t.Send),
+		roundDuration(t.TTFB), roundDuration(t.Transfer), roundDuration(t.Total))
+}
+
+func (t *RequestTiming) phase(name string) time.Duration {
+	switch name {
+	case PHASE_DNS:
+		return t.DNS
+	case PHASE_CONNECT:
+		return t.Connect
+	case PHASE_TLS:
+		return t.TLS
+	case PHASE_SEND:
+		return t.Send
+	case PHASE_TTFB:
+		return t.TTFB
+	case PHASE_TRANSFER:
+		return t.Transfer
+	}
+	return t.Total
+}
+
+// tracedBody finishes the timing of the request when the body is consumed
+type tracedBody struct {
+	io.ReadCloser
+	timing *RequestTiming
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.timing.finish()
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.timing.finish()
+	return err
+}
+
+// traceRequest attaches a new RequestTiming to the request
+func traceRequest(req *http.Request) (*http.Request, *RequestTiming) {
+	timing := &RequestTiming{Method: req.Method, URL: req.URL.String(), start: time.Now()}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), timing.clientTrace())), timing
+}
+
+// ResponseTiming returns the latency breakdown of the response got by DoRequest, or nil if it's not traced.
+// The transfer and total phases are only available after the body is closed.
+func ResponseTiming(resp *http.Response) *RequestTiming {
+	if resp == nil {
+		return nil
+	}
+	if body, ok := resp.Body.(*tracedBody); ok {
+		return body.timing
+	}
+	return nil
+}
+
+// PhaseStats aggregates one phase across all the requests
+type PhaseStats struct {
+	Phase string
+	Count int
+	Avg   time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	Max   time.Duration
+}
+
+type timingRecorder struct {
+	mu          sync.Mutex
+	requests    int
+	newConns    int
+	samples     map[string][]time.Duration
+	connectOnly map[string]bool
+}
+
+var timingStats = newTimingRecorder()
+
+func newTimingRecorder() *timingRecorder {
+	return &timingRecorder{
+		samples: make(map[string][]time.Duration),
+		// These phases are only measured on new connections, so they are not averaged over the reused ones
+		connectOnly: map[string]bool{PHASE_DNS: true, PHASE_CONNECT: true, PHASE_TLS: true},
+	}
+}
+
+func (r *timingRecorder) add(t *RequestTiming) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if !t.Reused {
+		r.newConns++
+	}
+	for _, p := range phases {
+		d := t.phase(p)
+		if r.connectOnly[p] && d == 0 {
+			continue
+		}
+		r.samples[p] = append(r.samples[p], d)
+	}
+}
+
+// GetTimingStats returns the aggregated latency of each phase of all the finished requests
+func GetTimingStats() []PhaseStats {
+	timingStats.mu.Lock()
+	defer timingStats.mu.Unlock()
+	var stats []PhaseStats
+	for _, p := range phases {
+		samples := append([]time.Duration{}, timingStats.samples[p]...)
+		if len(samples) == 0 {
+			continue
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		var sum time.Duration
+		for _, d := range samples {
+			sum += d
+		}
+		stats = append(stats, PhaseStats{
+			Phase: p,
+			Count: len(samples),
+			Avg:   sum / time.Duration(len(samples)),
+			P50:   percentile(samples, 50),
+			P95:   percentile(samples, 95),
+			Max:   samples[len(samples)-1],
+		})
+	}
+	return stats
+}
+
+// ResetTimingStats drops all the aggregated latency
+func ResetTimingStats() {
+	timingStats.mu.Lock()
+	defer timingStats.mu.Unlock()
+	timingStats.requests, timingStats.newConns = 0, 0
+	timingStats.samples = make(map[string][]time.Duration)
+}
+
+func PrintTimingStats() {
+	stats := GetTimingStats()
+	if len(stats) == 0 {
+		return
+	}
+	timingStats.mu.Lock()
+	requests, newConns := timingStats.requests, timingStats.newConns
+	timingStats.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "HTTP latency of %d requests (%d new connections):\n", requests, newConns)
+	fmt.Fprintf(&sb, "  %-10s %8s %12s %12s %12s %12s\n", "phase", "count", "avg", "p50", "p95", "max")
+	for _, s := range stats {
+		fmt.Fprintf(&sb, "  %-10s %8d %12v %12v %12v %12v\n", s.Phase, s.Count,
+			roundDuration(s.Avg), roundDuration(s.P50), roundDuration(s.P95), roundDuration(s.Max))
+	}
+	fmt.Print(sb.String())
+}
+
+// percentile of the sorted samples by the nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,72 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "trace")
+	defer os.RemoveAll(dir)
+
+	ResetTimingStats()
+	defer ResetTimingStats()
+
+	Convey("TestTrace", t, func() {
+		Convey("Timing of a request is complete after the body is closed", func() {
+			resp, err := DoRequest(MethodGet, server.URL, nil, nil, nil)
+			So(err, ShouldBeNil)
+			timing := ResponseTiming(resp)
+			So(timing, ShouldNotBeNil)
+			So(timing.TTFB, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(timing.Total, ShouldEqual, 0)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			So(timing.Total, ShouldBeGreaterThanOrEqualTo, timing.TTFB)
+		})
+		Convey("Phases are aggregated across requests", func() {
+			ResetTimingStats()
+			So(DownloadFile(server.URL+"/a", path.Join(dir, "a")), ShouldBeTrue)
+			So(DownloadFile(server.URL+"/b", path.Join(dir, "b")), ShouldBeTrue)
+			stats := map[string]PhaseStats{}
+			for _, s := range GetTimingStats() {
+				stats[s.Phase] = s
+			}
+			So(stats[PHASE_TOTAL].Count, ShouldEqual, 2)
+			So(stats[PHASE_TTFB].P50, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(stats[PHASE_CONNECT].Count, ShouldBeLessThanOrEqualTo, 2)
+		})
+		Convey("Speed of sub-millisecond transfers", func() {
+			So(calculateSpeed(1000, 0), ShouldNotBeEmpty)
+			So(calculateSpeed(1000, time.Millisecond), ShouldEqual, "1.0 MB/s")
+		})
+	})
+}
@@ -17,12 +17,9 @@
 package common
 
 import (
-	"crypto/md5"
+	"encoding/xml"
 	"fmt"
-	"io"
-	"log"
 	"math/rand"
-	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -74,26 +71,17 @@ func IsMetadata(path string) bool {
 	return strings.Index(path, MAVEN_METADATA_XML) > 0
 }
 
-func IsRegularFile(fileLoc string) bool {
-	return regularFileRegexp.MatchString(fileLoc)
+// MavenMetadataVersions returns the versions in a maven-metadata.xml, in the order of the file with duplicates kept
+func MavenMetadataVersions(content []byte) ([]string, error) {
+	var meta struct {
+		Versions []string `xml:"versioning>versions>version"`
+	}
+	if err := xml.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("invalid maven metadata, %s", err)
+	}
+	return meta.Versions, nil
 }
 
-func Md5Check(fileLoc, md5str string) {
-	// Skip non-regular (i.e, metadata) files
-	if IsRegularFile(fileLoc) {
-		f, err := os.Open(fileLoc)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer f.Close()
-		h := md5.New()
-		if _, err := io.Copy(h, f); err != nil {
-			log.Fatal(err)
-		}
-		calculated := fmt.Sprintf("%x", h.Sum(nil))
-		match := strings.EqualFold(md5str, calculated)
-		if !match {
-			log.Fatal(fmt.Sprintf("Md5 not match, expected: %s, calculated: %s", md5str, calculated))
-		}
-	}
+func IsRegularFile(fileLoc string) bool {
+	return regularFileRegexp.MatchString(fileLoc)
 }
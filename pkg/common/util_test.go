@@ -16,7 +16,10 @@
 
 package common
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestIsRegularFile(t *testing.T) {
 	type args struct {
@@ -44,3 +47,27 @@ func TestIsRegularFile(t *testing.T) {
 		})
 	}
 }
+
+func TestMavenMetadataVersions(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<metadata>
+  <groupId>org.foo</groupId>
+  <artifactId>bar</artifactId>
+  <versioning>
+    <latest>1.0.0.redhat-00002</latest>
+    <versions>
+      <version>1.0.0.redhat-00001</version>
+      <version>1.0.0.redhat-00002</version>
+      <version>1.0.0.redhat-00001</version>
+    </versions>
+  </versioning>
+</metadata>`
+	got, err := MavenMetadataVersions([]byte(content))
+	want := []string{"1.0.0.redhat-00001", "1.0.0.redhat-00002", "1.0.0.redhat-00001"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("MavenMetadataVersions() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := MavenMetadataVersions([]byte("not xml")); err == nil {
+		t.Errorf("MavenMetadataVersions() of invalid content, want error")
+	}
+}
@@ -68,6 +68,8 @@ const (
  *     |-- tracking.json => same as above
  */
 func Run(pncBaseUrl, indyBaseUrl, buildId string) {
+	pncBaseUrl, indyBaseUrl = common.NormIndyURL(pncBaseUrl), common.NormIndyURL(indyBaseUrl)
+
 	//Create folder, e.g, 'dataset/2836'
 	dirLoc := path.Join(DATASET_DIR, buildId)
 	err := os.MkdirAll(dirLoc, 0755)
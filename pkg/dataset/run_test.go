@@ -0,0 +1,99 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockpnc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const PNC_FIXTURES = "testdata/pnc"
+
+func TestGetMetadataPaths(t *testing.T) {
+	alignLog := string(common.ReadByteFromFile(path.Join(PNC_FIXTURES, "builds/AMJMVSDA5EAAF/logs/align.log")))
+	Convey("TestGetMetadataPaths", t, func() {
+		So(getMetadataPaths(alignLog), ShouldResemble, []string{
+			"org/apache/kafka/connect-api/maven-metadata.xml",
+			"org/jboss/jboss-parent/maven-metadata.xml",
+		})
+	})
+}
+
+func TestParseBuildJson(t *testing.T) {
+	Convey("TestParseBuildJson", t, func() {
+		temporaryBuild, buildType := parseBuildJson(path.Join(PNC_FIXTURES, "builds/AMJMVSDA5EAAE.json"))
+		So(temporaryBuild, ShouldBeFalse)
+		So(buildType, ShouldEqual, "MVN")
+	})
+}
+
+func TestParseDependency(t *testing.T) {
+	pnc := mockpnc.NewServer(PNC_FIXTURES)
+	defer pnc.Close()
+	buildsDir, _ := ioutil.TempDir("", "dataset-builds")
+	defer os.RemoveAll(buildsDir)
+
+	parseDependency(pnc.URL, pnc.URL, buildsDir, path.Join(PNC_FIXTURES, "group-builds/2836/dependency-graph.json"))
+
+	Convey("TestParseDependency", t, func() {
+		for _, buildId := range []string{"AMJMVSDA5EAAE", "AMJMVSDA5EAAF"} {
+			buildDir := path.Join(buildsDir, buildId)
+			So(common.FileOrDirExists(path.Join(buildDir, "align.log")), ShouldBeTrue)
+			So(common.FileOrDirExists(path.Join(buildDir, DA_JSON)), ShouldBeTrue)
+			tracking := common.GetFoloRecordFromFile(path.Join(buildDir, TRACKING_JSON))
+			So(tracking.TrackingKey.Id, ShouldEqual, "build-"+buildId)
+		}
+		var paths []string
+		json.Unmarshal(common.ReadByteFromFile(path.Join(buildsDir, "AMJMVSDA5EAAE", DA_JSON)), &paths)
+		So(paths, ShouldResemble, []string{
+			"org/jboss/jboss-parent/maven-metadata.xml",
+			"io/netty/netty-all/maven-metadata.xml",
+		})
+	})
+}
+
+func TestRunGroupBuild(t *testing.T) {
+	fixtures, _ := filepath.Abs(PNC_FIXTURES)
+	pnc := mockpnc.NewServer(fixtures)
+	defer pnc.Close()
+
+	workDir, _ := ioutil.TempDir("", "dataset")
+	defer os.RemoveAll(workDir)
+	cwd, _ := os.Getwd()
+	os.Chdir(workDir)
+	defer os.Chdir(cwd)
+
+	Run(pnc.URL, pnc.URL, "2836")
+
+	Convey("TestRunGroupBuild", t, func() {
+		dirLoc := path.Join(workDir, DATASET_DIR, "2836")
+		var info Info
+		json.Unmarshal(common.ReadByteFromFile(path.Join(dirLoc, INFO_JSON)), &info)
+		So(info.BuildId, ShouldEqual, "2836")
+		So(common.FileOrDirExists(path.Join(dirLoc, "group-build.json")), ShouldBeTrue)
+		So(common.FileOrDirExists(path.Join(dirLoc, "dependency-graph.json")), ShouldBeTrue)
+		So(common.FileOrDirExists(path.Join(dirLoc, "builds", "AMJMVSDA5EAAF", TRACKING_JSON)), ShouldBeTrue)
+	})
+}
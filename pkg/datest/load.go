@@ -0,0 +1,213 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URL selection of the open-model load
+const (
+	SELECTION_REPLAY   = "replay"   // in the order of the alignment reports, from the beginning again when exhausted
+	SELECTION_WEIGHTED = "weighted" // random, weighted by the times a GA appears in the alignment reports
+)
+
+// When the target rate is 0 (e.g, at the beginning of a ramp-up), check the rate again after this
+const idleTick = 10 * time.Millisecond
+
+// Stage ramps the request rate linearly from the target of the previous stage (0 for the first one) to Target
+// in Duration
+type Stage struct {
+	Duration time.Duration
+	Target   float64 // requests per second
+}
+
+// LoadOptions enables the open-model load if RPS or Stages is specified: requests are sent at the target rate
+// regardless of how fast the server responds, like the production DA traffic.
+type LoadOptions struct {
+	RPS       float64       // constant rate, used with Duration
+	Duration  time.Duration // duration of the constant rate
+	Stages    []Stage       // ramp-up/ramp-down stages, used instead of RPS and Duration if specified
+	Selection string        // SELECTION_REPLAY or SELECTION_WEIGHTED
+	Window    time.Duration // interval of the timeline statistics
+	Seed      int64         // random seed of the weighted selection, 0 means the current time
+}
+
+func (opts LoadOptions) Enabled() bool {
+	return opts.RPS > 0 || len(opts.Stages) > 0
+}
+
+func (opts LoadOptions) Validate() error {
+	if len(opts.Stages) == 0 && opts.RPS > 0 && opts.Duration <= 0 {
+		return fmt.Errorf("duration must be specified with rps")
+	}
+	for _, s := range opts.Stages {
+		if s.Duration <= 0 || s.Target < 0 {
+			return fmt.Errorf("invalid stage %v:%v, duration must be positive and target must not be negative", s.Duration, s.Target)
+		}
+	}
+	switch opts.Selection {
+	case "", SELECTION_REPLAY, SELECTION_WEIGHTED:
+	default:
+		return fmt.Errorf("unknown selection %s, should be %s or %s", opts.Selection, SELECTION_REPLAY, SELECTION_WEIGHTED)
+	}
+	return nil
+}
+
+func (opts LoadOptions) stages() []Stage {
+	if len(opts.Stages) > 0 {
+		return opts.Stages
+	}
+	// The constant rate starts at the target immediately
+	return []Stage{{Duration: 0, Target: opts.RPS}, {Duration: opts.Duration, Target: opts.RPS}}
+}
+
+// ParseStages parses the stages like "30s:10,2m:50,30s:0", i.e, ramp up to 10 rps in 30s, then to 50 rps in 2m,
+// then down to 0 in 30s
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	if strings.TrimSpace(s) == "" {
+		return stages, nil
+	}
+	for _, tok := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(tok), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid stage %s, should be duration:rps, e.g, 30s:10", tok)
+		}
+		d, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid stage %s, %s", tok, err)
+		}
+		target, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stage %s, %s", tok, err)
+		}
+		stages = append(stages, Stage{Duration: d, Target: target})
+	}
+	return stages, nil
+}
+
+// rateAt returns the target rate at the elapsed time since the load starts, and false if all stages are done
+func rateAt(stages []Stage, elapsed time.Duration) (float64, bool) {
+	from := 0.0
+	for _, s := range stages {
+		if elapsed < s.Duration {
+			return from + (s.Target-from)*float64(elapsed)/float64(s.Duration), true
+		}
+		elapsed -= s.Duration
+		from = s.Target
+	}
+	return 0, false
+}
+
+// urlSelector picks the next url to look up
+type urlSelector func() string
+
+func newURLSelector(urls []string, selection string, seed int64) urlSelector {
+	if selection == SELECTION_WEIGHTED {
+		counts := make(map[string]int)
+		var unique []string
+		for _, u := range urls {
+			if counts[u] == 0 {
+				unique = append(unique, u)
+			}
+			counts[u]++
+		}
+		cumulative := make([]int, len(unique))
+		total := 0
+		for i, u := range unique {
+			total += counts[u]
+			cumulative[i] = total
+		}
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		random := rand.New(rand.NewSource(seed))
+		return func() string {
+			n := random.Intn(total)
+			return unique[sort.SearchInts(cumulative, n+1)]
+		}
+	}
+
+	next := 0
+	return func() string {
+		u := urls[next]
+		next = (next + 1) % len(urls)
+		return u
+	}
+}
+
+// LookupMetadataByRate runs the open-model load. The latency of a request is measured from the time it is
+// scheduled rather than sent, so the waiting for a free routine (i.e, the server falls behind) is counted too and
+// the coordinated omission is avoided. maxInFlight limits the concurrent requests.
+func LookupMetadataByRate(urls []string, maxInFlight int, opts LoadOptions) *Stats {
+	stats := NewStats()
+	stats.window = opts.Window
+	if len(urls) == 0 {
+		stats.Finish()
+		return stats
+	}
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	stages := opts.stages()
+	selectURL := newURLSelector(urls, opts.Selection, opts.Seed)
+	fmt.Printf("Start open-model load, urls: %d, selection: %s, max in flight: %d, stages: %v\n", len(urls), opts.Selection, maxInFlight, stages)
+
+	inFlight := make(chan struct{}, maxInFlight)
+	var wg sync.WaitGroup
+	start := time.Now()
+	scheduled := start
+	for n := 0; ; n++ {
+		rate, running := rateAt(stages, scheduled.Sub(start))
+		if !running {
+			break
+		}
+		if rate <= 0 {
+			scheduled = scheduled.Add(idleTick)
+			continue
+		}
+		stats.setTarget(scheduled, rate)
+		if wait := time.Until(scheduled); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		wg.Add(1)
+		go func(n int, url string, scheduled time.Time) {
+			defer wg.Done()
+			inFlight <- struct{}{}
+			result := lookupMetadata(url)
+			<-inFlight
+			latency := time.Since(scheduled)
+			stats.RecordAt(result, latency, scheduled)
+			if result.IsFailure() {
+				fmt.Printf("Lookup FAILED #%d %s, outcome: %s, error: %s\n", n, result.URL, result.Outcome, result.Err)
+			}
+		}(n, selectURL(), scheduled)
+
+		scheduled = scheduled.Add(time.Duration(float64(time.Second) / rate))
+	}
+	wg.Wait()
+	stats.Finish()
+	return stats
+}
@@ -0,0 +1,103 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStages(t *testing.T) {
+	Convey("TestStages", t, func() {
+		stages, err := ParseStages("10s:10, 20s:50,10s:0")
+		So(err, ShouldBeNil)
+		So(stages, ShouldResemble, []Stage{{10 * time.Second, 10}, {20 * time.Second, 50}, {10 * time.Second, 0}})
+		_, err = ParseStages("10s")
+		So(err, ShouldNotBeNil)
+		_, err = ParseStages("ten:10")
+		So(err, ShouldNotBeNil)
+
+		rate, running := rateAt(stages, 5*time.Second)
+		So(rate, ShouldEqual, 5)
+		So(running, ShouldBeTrue)
+		rate, _ = rateAt(stages, 20*time.Second)
+		So(rate, ShouldEqual, 30)
+		rate, _ = rateAt(stages, 35*time.Second)
+		So(rate, ShouldEqual, 25)
+		_, running = rateAt(stages, 40*time.Second)
+		So(running, ShouldBeFalse)
+
+		constant := LoadOptions{RPS: 20, Duration: time.Minute}.stages()
+		rate, _ = rateAt(constant, 0)
+		So(rate, ShouldEqual, 20)
+
+		So(LoadOptions{RPS: 20}.Validate(), ShouldNotBeNil)
+		So(LoadOptions{Stages: stages, Selection: "random"}.Validate(), ShouldNotBeNil)
+		So(LoadOptions{Stages: stages, Selection: SELECTION_WEIGHTED}.Validate(), ShouldBeNil)
+	})
+}
+
+func TestURLSelector(t *testing.T) {
+	Convey("TestURLSelector", t, func() {
+		replay := newURLSelector([]string{"a", "b", "c"}, SELECTION_REPLAY, 0)
+		var got []string
+		for i := 0; i < 4; i++ {
+			got = append(got, replay())
+		}
+		So(got, ShouldResemble, []string{"a", "b", "c", "a"})
+
+		weighted := newURLSelector([]string{"a", "b", "a", "a"}, SELECTION_WEIGHTED, 1)
+		counts := map[string]int{}
+		for i := 0; i < 4000; i++ {
+			counts[weighted()]++
+		}
+		So(counts["a"], ShouldBeBetween, 2700, 3300)
+		So(counts["b"], ShouldBeBetween, 700, 1300)
+	})
+}
+
+func TestLookupMetadataByRate(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stalls for a while in the middle, the following requests should wait and count it into the latency
+		if atomic.AddInt32(&count, 1) == 5 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte(validMetadata))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a/maven-metadata.xml", server.URL + "/b/maven-metadata.xml"}
+	opts := LoadOptions{RPS: 50, Duration: time.Second, Window: 500 * time.Millisecond}
+	summary := LookupMetadataByRate(urls, 1, opts).Summary()
+
+	Convey("TestLookupMetadataByRate", t, func() {
+		So(summary.Requests, ShouldBeBetweenOrEqual, 48, 51)
+		So(summary.Failures, ShouldEqual, 0)
+		// With 1 request in flight, the requests scheduled during the stall are delayed
+		So(summary.Percentiles["p90"], ShouldBeGreaterThan, 50*time.Millisecond)
+		So(summary.Max, ShouldBeGreaterThanOrEqualTo, 300*time.Millisecond)
+		So(len(summary.Timeline), ShouldBeGreaterThanOrEqualTo, 2)
+		So(summary.Timeline[0].TargetRPS, ShouldEqual, 50)
+		So(summary.Render(), ShouldContainSubstring, "Timeline")
+	})
+}
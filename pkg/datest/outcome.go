@@ -0,0 +1,116 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datest
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+// Outcomes of a metadata lookup
+const (
+	OUTCOME_OK             = "ok"             // 2xx with a valid maven-metadata.xml which has versions
+	OUTCOME_NOT_FOUND      = "not-found"      // 404, the artifact is not in the group, which is a valid answer for DA
+	OUTCOME_CLIENT_ERROR   = "client-error"   // other 4xx, e.g, 401
+	OUTCOME_SERVER_ERROR   = "server-error"   // 5xx
+	OUTCOME_TIMEOUT        = "timeout"        // no response in time
+	OUTCOME_NETWORK_ERROR  = "network-error"  // no response, e.g, connection refused
+	OUTCOME_MALFORMED      = "malformed"      // 2xx but the body is not a valid maven-metadata.xml
+	OUTCOME_EMPTY_VERSIONS = "empty-versions" // 2xx but no versions in the maven-metadata.xml
+)
+
+// LookupResult is the classified outcome of a metadata lookup
+type LookupResult struct {
+	URL        string
+	StatusCode int // common.StatusUnknown if no response is received
+	Outcome    string
+	Versions   int
+	Err        error
+}
+
+// IsFailure returns false for the valid answers, i.e, ok and not-found
+func (r LookupResult) IsFailure() bool {
+	return r.Outcome != OUTCOME_OK && r.Outcome != OUTCOME_NOT_FOUND
+}
+
+type mavenMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupID    string   `xml:"groupId"`
+	ArtifactID string   `xml:"artifactId"`
+	Versioning struct {
+		Versions []string `xml:"versions>version"`
+	} `xml:"versioning"`
+}
+
+// classifyError classifies a request which gets no response
+func classifyError(url string, err error) LookupResult {
+	result := LookupResult{URL: url, StatusCode: common.StatusUnknown, Outcome: OUTCOME_NETWORK_ERROR, Err: err}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		result.Outcome = OUTCOME_TIMEOUT
+	}
+	return result
+}
+
+// classifyResponse classifies a response by the status code and the body
+func classifyResponse(url string, statusCode int, body []byte) LookupResult {
+	result := LookupResult{URL: url, StatusCode: statusCode}
+	switch {
+	case statusCode == common.StatusNotFound:
+		result.Outcome = OUTCOME_NOT_FOUND
+		return result
+	case statusCode >= 500:
+		result.Outcome = OUTCOME_SERVER_ERROR
+	case statusCode >= 400:
+		result.Outcome = OUTCOME_CLIENT_ERROR
+	case statusCode < 200 || statusCode >= 300:
+		result.Outcome = OUTCOME_CLIENT_ERROR // redirects are followed, so any other status is unexpected
+	}
+	if result.Outcome != "" {
+		result.Err = fmt.Errorf("status: %d, response: %s", statusCode, abbreviate(string(body), 200))
+		return result
+	}
+
+	var metadata mavenMetadata
+	if err := xml.Unmarshal(body, &metadata); err != nil {
+		result.Outcome = OUTCOME_MALFORMED
+		result.Err = fmt.Errorf("invalid maven-metadata.xml: %s", err)
+		return result
+	}
+	result.Versions = len(metadata.Versioning.Versions)
+	if result.Versions == 0 {
+		result.Outcome = OUTCOME_EMPTY_VERSIONS
+		result.Err = fmt.Errorf("no versions in maven-metadata.xml")
+		return result
+	}
+	result.Outcome = OUTCOME_OK
+	return result
+}
+
+func abbreviate(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
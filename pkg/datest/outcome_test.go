@@ -0,0 +1,91 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const validMetadata = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata>
+  <groupId>org.foo</groupId>
+  <artifactId>bar</artifactId>
+  <versioning>
+    <versions>
+      <version>1.0</version>
+      <version>1.1</version>
+    </versions>
+  </versioning>
+</metadata>`
+
+func TestClassifyResponse(t *testing.T) {
+	Convey("TestClassifyResponse", t, func() {
+		cases := []struct {
+			code    int
+			body    string
+			outcome string
+			failure bool
+		}{
+			{200, validMetadata, OUTCOME_OK, false},
+			{404, "Not found", OUTCOME_NOT_FOUND, false},
+			{500, "Message: NPE", OUTCOME_SERVER_ERROR, true},
+			{502, "", OUTCOME_SERVER_ERROR, true},
+			{401, "", OUTCOME_CLIENT_ERROR, true},
+			{200, "<html>proxy login</html>", OUTCOME_MALFORMED, true},
+			{200, "<metadata><versioning>", OUTCOME_MALFORMED, true},
+			{200, "<metadata><groupId>org.foo</groupId></metadata>", OUTCOME_EMPTY_VERSIONS, true},
+		}
+		for _, c := range cases {
+			r := classifyResponse("http://indy/x", c.code, []byte(c.body))
+			So(r.Outcome, ShouldEqual, c.outcome)
+			So(r.IsFailure(), ShouldEqual, c.failure)
+		}
+		So(classifyResponse("http://indy/x", 200, []byte(validMetadata)).Versions, ShouldEqual, 2)
+	})
+}
+
+func TestLookupMetadataErrors(t *testing.T) {
+	stall := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	defer server.Close()
+	defer close(stall)
+
+	common.SetRetryPolicy(common.RetryPolicy{MaxAttempts: 1})
+	defer common.SetRetryPolicy(common.DefaultRetryPolicy)
+	opts := common.DefaultTransportOptions
+	opts.ResponseHeaderTimeout = 100 * time.Millisecond
+	common.ConfigureTransport(opts)
+	defer common.ConfigureTransport(common.DefaultTransportOptions)
+
+	Convey("Lookup failures are classified without panic", t, func() {
+		r := lookupMetadata(server.URL + "/org/foo/bar/maven-metadata.xml")
+		So(r.Outcome, ShouldEqual, OUTCOME_TIMEOUT)
+		So(r.StatusCode, ShouldEqual, common.StatusUnknown)
+
+		r = lookupMetadata("http://127.0.0.1:1/org/foo/bar/maven-metadata.xml")
+		So(r.Outcome, ShouldEqual, OUTCOME_NETWORK_ERROR)
+		So(r.IsFailure(), ShouldBeTrue)
+	})
+}
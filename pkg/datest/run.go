@@ -4,13 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 type Report struct {
@@ -40,43 +40,70 @@ type Report struct {
 	} `json:"modules"`
 }
 
-func lookupMetadata(url string) {
-	fmt.Println(url)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		panic(err)
-	}
-	req.Header.Set("Accept", "application/xml")
+// Options of a datest run
+type Options struct {
+	StatsFile string // the file to write the statistics as JSON, optional
+	// Max percentage (0 to 100) of failed lookups, above which the run exits with 1
+	FailureThreshold float64
+	Load             LoadOptions
+}
 
-	var c http.Client
-	resp, err := c.Do(req)
+// lookupMetadata gets the metadata and classifies the outcome. It never panics, a failure is in the result.
+func lookupMetadata(url string) LookupResult {
+	fmt.Println(url)
+	resp, err := common.DoRequest(common.MethodGet, url, nil, map[string]string{"Accept": common.ContentTypeXML}, nil)
 	if err != nil {
-		panic(err)
+		return classifyError(url, err)
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		panic(err)
-	}
-	bodyString := string(bodyBytes)
-
-	if strings.Contains(bodyString, "Message:") {
-		fmt.Print(bodyString)
+		result := classifyError(url, err)
+		result.StatusCode = resp.StatusCode
+		return result
 	}
+	return classifyResponse(url, resp.StatusCode, bodyBytes)
 }
 
-func Run(targetIndy, daGroup string, dataDir string, processNum int) {
+// Run looks up the metadata of all the managed dependencies in the alignment reports under dataDir, and prints
+// the statistics. It exits with 1 if the percentage of failed lookups is above the threshold.
+func Run(targetIndy, daGroup string, dataDir string, processNum int, opts Options) {
 
-	indyHost, validated := common.ValidateTargetIndy(targetIndy)
+	indyURL, validated := common.ValidateTargetIndy(targetIndy)
 	if !validated {
-		os.Exit(1)
+		report.Exit(1)
 	}
 
-	indyURL := "http://" + indyHost
-
 	routines := processNum
 
+	urls := MetadataURLs(indyURL, daGroup, dataDir)
+
+	var stats *Stats
+	if opts.Load.Enabled() {
+		stats = LookupMetadataByRate(urls, routines, opts.Load)
+	} else {
+		stats = LookupMetadataByRoutines(urls, routines)
+	}
+	summary := stats.Summary()
+	fmt.Print(summary.Render())
+	if !common.IsEmptyString(opts.StatsFile) {
+		if err := summary.WriteJSON(opts.StatsFile); err != nil {
+			fmt.Printf("Error: cannot write statistics to %s, %s\n", opts.StatsFile, err)
+			report.Exit(1)
+		}
+		fmt.Printf("Statistics written to %s\n", opts.StatsFile)
+	}
+	if summary.FailureRate() > opts.FailureThreshold {
+		fmt.Printf("DA test FAILED, failed lookups: %d (%.2f%%), threshold: %.2f%%\n", summary.Failures, summary.FailureRate(), opts.FailureThreshold)
+		report.Exit(1)
+	}
+	fmt.Printf("DA test SUCCESS, failed lookups: %d (%.2f%%), threshold: %.2f%%\n", summary.Failures, summary.FailureRate(), opts.FailureThreshold)
+}
+
+// MetadataURLs returns the urls of the metadata of all the managed dependencies in the alignment reports under
+// dataDir, through the DA group of the indy
+func MetadataURLs(indyURL, daGroup string, dataDir string) []string {
 	var urls []string
 
 	files, err := ioutil.ReadDir(dataDir)
@@ -117,14 +144,14 @@ func Run(targetIndy, daGroup string, dataDir string, processNum int) {
 			}
 		}
 	}
-
-	LookupMetadataByRoutines(urls, routines)
+	return urls
 }
 
-func LookupMetadataByRoutines(urls []string, routines int) {
+func LookupMetadataByRoutines(urls []string, routines int) *Stats {
 	fmt.Println("Total requests: ", len(urls), "with routines:", routines)
 	concurrentGoroutines := make(chan struct{}, routines)
 	var wg sync.WaitGroup
+	stats := NewStats()
 
 	for i := 0; i < len(urls); i++ {
 		concurrentGoroutines <- struct{}{}
@@ -133,12 +160,18 @@ func LookupMetadataByRoutines(urls []string, routines int) {
 			defer wg.Done()
 			fmt.Println("Doing", i)
 			start := time.Now()
-			lookupMetadata(urls[i])
+			result := lookupMetadata(urls[i])
 			elapsed := time.Since(start)
+			stats.Record(result, elapsed)
+			if result.IsFailure() {
+				fmt.Printf("Lookup FAILED #%d %s, outcome: %s, error: %s\n", i, result.URL, result.Outcome, result.Err)
+			}
 			fmt.Println("Finished #", i, " in ", elapsed)
 			<-concurrentGoroutines
 		}(i)
 	}
 
 	wg.Wait()
+	stats.Finish()
+	return stats
 }
@@ -0,0 +1,337 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/jedib0t/go-pretty/table"
+)
+
+const STATUS_ERROR = "error" // no response, e.g, connection refused
+
+var percentiles = []float64{50, 90, 95, 99}
+
+// Stats aggregates the latency and the response status of all the metadata lookups in a run
+type Stats struct {
+	mu       sync.Mutex
+	start    time.Time
+	end      time.Time
+	statuses map[string]int64
+	outcomes map[string]int64
+	failures int64
+	latency  *common.Histogram
+
+	window  time.Duration // interval of the timeline, no timeline if 0
+	windows map[int]*windowStats
+}
+
+type windowStats struct {
+	targetSum float64
+	targetN   int64
+	completed int64
+	failures  int64
+	latency   *common.Histogram
+}
+
+// WindowSummary is the statistics of an interval of the run, to see at which rate the latency goes up
+type WindowSummary struct {
+	Offset     time.Duration `json:"offset"`     // since the start of the run
+	TargetRPS  float64       `json:"targetRps"`  // average target rate of the open-model load
+	Throughput float64       `json:"throughput"` // completed requests per second
+	Requests   int64         `json:"requests"`   // requests scheduled in the interval
+	Failures   int64         `json:"failures"`
+	P50        time.Duration `json:"p50"`
+	P95        time.Duration `json:"p95"`
+	Max        time.Duration `json:"max"`
+}
+
+// StatsSummary is the JSON form of the Stats, for tracking the trend across runs
+type StatsSummary struct {
+	Start       time.Time                `json:"start"`
+	End         time.Time                `json:"end"`
+	Requests    int64                    `json:"requests"`
+	Errors      int64                    `json:"errors"`     // no response or status code >= 400
+	Failures    int64                    `json:"failures"`   // see LookupResult.IsFailure
+	Throughput  float64                  `json:"throughput"` // requests per second
+	Min         time.Duration            `json:"min"`
+	Mean        time.Duration            `json:"mean"`
+	Percentiles map[string]time.Duration `json:"percentiles"`
+	Max         time.Duration            `json:"max"`
+	Statuses    map[string]int64         `json:"statuses"`
+	Outcomes    map[string]int64         `json:"outcomes"`
+	Histogram   []common.HistogramBucket `json:"histogram"`
+	Timeline    []WindowSummary          `json:"timeline,omitempty"`
+}
+
+func NewStats() *Stats {
+	return &Stats{start: time.Now(), statuses: make(map[string]int64), outcomes: make(map[string]int64), latency: common.NewHistogram(),
+		windows: make(map[int]*windowStats)}
+}
+
+// Record adds the result of a lookup
+func (s *Stats) Record(result LookupResult, latency time.Duration) {
+	s.RecordAt(result, latency, time.Now().Add(-latency))
+}
+
+// RecordAt adds the result of a lookup which is scheduled at the time
+func (s *Stats) RecordAt(result LookupResult, latency time.Duration, scheduled time.Time) {
+	s.latency.Record(latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[statusLabel(result.StatusCode)]++
+	s.outcomes[result.Outcome]++
+	if result.IsFailure() {
+		s.failures++
+	}
+	if s.window > 0 {
+		w := s.windowAt(scheduled)
+		w.latency.Record(latency)
+		if result.IsFailure() {
+			w.failures++
+		}
+		s.windowAt(scheduled.Add(latency)).completed++
+	}
+}
+
+// setTarget records the target rate of the open-model load at the time
+func (s *Stats) setTarget(at time.Time, rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.window > 0 {
+		w := s.windowAt(at)
+		w.targetSum += rate
+		w.targetN++
+	}
+}
+
+// Should be called with lock held
+func (s *Stats) windowAt(t time.Time) *windowStats {
+	i := int(t.Sub(s.start) / s.window)
+	if i < 0 {
+		i = 0
+	}
+	w, ok := s.windows[i]
+	if !ok {
+		w = &windowStats{latency: common.NewHistogram()}
+		s.windows[i] = w
+	}
+	return w
+}
+
+// Should be called with lock held
+func (s *Stats) timeline() []WindowSummary {
+	var indexes []int
+	for i := range s.windows {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	var timeline []WindowSummary
+	for _, i := range indexes {
+		w := s.windows[i]
+		sum := WindowSummary{
+			Offset:     time.Duration(i) * s.window,
+			Throughput: float64(w.completed) / s.window.Seconds(),
+			Requests:   w.latency.Count(),
+			Failures:   w.failures,
+			P50:        w.latency.ValueAtPercentile(50),
+			P95:        w.latency.ValueAtPercentile(95),
+			Max:        w.latency.Max(),
+		}
+		if w.targetN > 0 {
+			sum.TargetRPS = w.targetSum / float64(w.targetN)
+		}
+		timeline = append(timeline, sum)
+	}
+	return timeline
+}
+
+// Finish marks the end of the run, which is used to calculate the throughput
+func (s *Stats) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.end = time.Now()
+}
+
+func statusLabel(statusCode int) string {
+	if statusCode == common.StatusUnknown {
+		return STATUS_ERROR
+	}
+	return strconv.Itoa(statusCode)
+}
+
+// isErrorStatus returns true for no response or status code >= 400
+func isErrorStatus(label string) bool {
+	code, err := strconv.Atoi(label)
+	return err != nil || code >= 400
+}
+
+func (s *Stats) Summary() StatsSummary {
+	s.mu.Lock()
+	end := s.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	sum := StatsSummary{Start: s.start, End: end, Failures: s.failures, Statuses: make(map[string]int64),
+		Outcomes: make(map[string]int64), Percentiles: make(map[string]time.Duration)}
+	for k, v := range s.statuses {
+		sum.Statuses[k] = v
+		if isErrorStatus(k) {
+			sum.Errors += v
+		}
+	}
+	for k, v := range s.outcomes {
+		sum.Outcomes[k] = v
+	}
+	sum.Timeline = s.timeline()
+	s.mu.Unlock()
+
+	sum.Requests = s.latency.Count()
+	if elapsed := end.Sub(s.start).Seconds(); elapsed > 0 {
+		sum.Throughput = float64(sum.Requests) / elapsed
+	}
+	sum.Min, sum.Mean, sum.Max = s.latency.Min(), s.latency.Mean(), s.latency.Max()
+	for _, p := range percentiles {
+		sum.Percentiles[percentileLabel(p)] = s.latency.ValueAtPercentile(p)
+	}
+	sum.Histogram = s.latency.Buckets()
+	return sum
+}
+
+// FailureRate returns the percentage (0 to 100) of the failed lookups
+func (sum StatsSummary) FailureRate() float64 {
+	if sum.Requests == 0 {
+		return 0
+	}
+	return float64(sum.Failures) * 100 / float64(sum.Requests)
+}
+
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// Render returns the statistics as tables
+func (sum StatsSummary) Render() string {
+	var sb strings.Builder
+
+	t := table.NewWriter()
+	t.SetTitle("Metadata lookup latency")
+	header := table.Row{"Requests", "Errors", "Failures", "Elapsed", "Throughput", "Min", "Mean"}
+	row := table.Row{sum.Requests, sum.Errors, sum.Failures, roundDuration(sum.End.Sub(sum.Start)), fmt.Sprintf("%.1f/s", sum.Throughput),
+		roundDuration(sum.Min), roundDuration(sum.Mean)}
+	for _, p := range percentiles {
+		header = append(header, percentileLabel(p))
+		row = append(row, roundDuration(sum.Percentiles[percentileLabel(p)]))
+	}
+	t.AppendHeader(append(header, "Max"))
+	t.AppendRow(append(row, roundDuration(sum.Max)))
+	sb.WriteString(t.Render() + "\n")
+
+	t = table.NewWriter()
+	t.SetTitle("Responses by status")
+	t.AppendHeader(table.Row{"Status", "Count", "Percent"})
+	var labels []string
+	for k := range sum.Statuses {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		t.AppendRow(table.Row{k, sum.Statuses[k], percent(sum.Statuses[k], sum.Requests)})
+	}
+	sb.WriteString(t.Render() + "\n")
+
+	t = table.NewWriter()
+	t.SetTitle("Lookups by outcome")
+	t.AppendHeader(table.Row{"Outcome", "Count", "Percent"})
+	labels = labels[:0]
+	for k := range sum.Outcomes {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		t.AppendRow(table.Row{k, sum.Outcomes[k], percent(sum.Outcomes[k], sum.Requests)})
+	}
+	sb.WriteString(t.Render() + "\n")
+
+	if len(sum.Timeline) > 0 {
+		t = table.NewWriter()
+		t.SetTitle("Timeline")
+		t.AppendHeader(table.Row{"Offset", "Target", "Throughput", "Requests", "Failures", "p50", "p95", "Max"})
+		for _, w := range sum.Timeline {
+			t.AppendRow(table.Row{w.Offset, fmt.Sprintf("%.1f/s", w.TargetRPS), fmt.Sprintf("%.1f/s", w.Throughput), w.Requests, w.Failures,
+				roundDuration(w.P50), roundDuration(w.P95), roundDuration(w.Max)})
+		}
+		sb.WriteString(t.Render() + "\n")
+	}
+
+	t = table.NewWriter()
+	t.SetTitle("Latency histogram")
+	t.AppendHeader(table.Row{"Latency", "Count", "Percent", ""})
+	var maxCount int64
+	for _, b := range sum.Histogram {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	for _, b := range sum.Histogram {
+		bar := ""
+		if maxCount > 0 {
+			bar = strings.Repeat("#", int(b.Count*40/maxCount))
+		}
+		t.AppendRow(table.Row{fmt.Sprintf("%v - %v", b.From, b.To), b.Count, percent(b.Count, sum.Requests), bar})
+	}
+	sb.WriteString(t.Render() + "\n")
+	return sb.String()
+}
+
+// WriteJSON writes the statistics to the file
+func (sum StatsSummary) WriteJSON(fileLoc string) error {
+	if dir := path.Dir(fileLoc); !common.FileOrDirExists(dir) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileLoc, b, 0644)
+}
+
+func percent(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", float64(n)*100/float64(total))
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,74 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.Contains(r.URL.Path, "broken") {
+			w.Write([]byte("<metadata>"))
+			return
+		}
+		w.Write([]byte(validMetadata))
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "datest")
+	defer os.RemoveAll(dir)
+
+	urls := []string{server.URL + "/a/maven-metadata.xml", server.URL + "/b/maven-metadata.xml",
+		server.URL + "/missing/maven-metadata.xml", server.URL + "/broken/maven-metadata.xml"}
+	summary := LookupMetadataByRoutines(urls, 2).Summary()
+
+	Convey("TestLookupStats", t, func() {
+		So(summary.Requests, ShouldEqual, 4)
+		So(summary.Errors, ShouldEqual, 1)
+		So(summary.Failures, ShouldEqual, 1)
+		So(summary.FailureRate(), ShouldEqual, 25)
+		So(summary.Statuses, ShouldResemble, map[string]int64{"200": 3, "404": 1})
+		So(summary.Outcomes, ShouldResemble, map[string]int64{OUTCOME_OK: 2, OUTCOME_NOT_FOUND: 1, OUTCOME_MALFORMED: 1})
+		So(summary.Throughput, ShouldBeGreaterThan, 0)
+		So(summary.Percentiles["p99"], ShouldEqual, summary.Max)
+
+		rendered := summary.Render()
+		So(rendered, ShouldContainSubstring, "P95")
+		So(rendered, ShouldContainSubstring, "404")
+
+		fileLoc := path.Join(dir, "stats", "datest.json")
+		So(summary.WriteJSON(fileLoc), ShouldBeNil)
+		var fromJSON StatsSummary
+		So(json.Unmarshal(common.ReadByteFromFile(fileLoc), &fromJSON), ShouldBeNil)
+		So(fromJSON.Requests, ShouldEqual, 4)
+		So(len(fromJSON.Histogram), ShouldBeGreaterThan, 0)
+	})
+}
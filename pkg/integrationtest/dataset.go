@@ -0,0 +1,53 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/dataset"
+)
+
+// Dataset is a build in the dataset repo, see dataset.Run for the layout
+type Dataset struct {
+	RepoDir          string // the local dir of the dataset repo
+	BuildId          string // e.g, "AMJMVSDA5EAAA", or "2836/builds/AMJMVSDA5EAAE" for a build in a group build
+	Info             dataset.Info
+	AdditionalRepos  []string
+	FoloTrackContent common.TrackedContent
+}
+
+// LoadDataset reads the info.json, additional-repos.json and tracking.json of the build
+func LoadDataset(datasetRepoDir, buildId string) Dataset {
+	ds := Dataset{RepoDir: datasetRepoDir, BuildId: buildId}
+	json.Unmarshal(common.ReadByteFromFile(getInfoFileLoc(datasetRepoDir, buildId)), &ds.Info)
+	ds.AdditionalRepos = getAdditionalRepos(path.Join(datasetRepoDir, buildId, dataset.ADDITIONAL_REPOS))
+	ds.FoloTrackContent = common.GetFoloRecordFromFile(path.Join(datasetRepoDir, buildId, dataset.TRACKING_JSON))
+	return ds
+}
+
+// PackageType returns maven or npm by the build type
+func (ds Dataset) PackageType() string {
+	return getPackageType(ds.Info)
+}
+
+// OriginalIndyBaseUrl returns the indy which the original build uploaded to
+func (ds Dataset) OriginalIndyBaseUrl() string {
+	return getOriginalIndyBaseUrl(ds.FoloTrackContent.Uploads[0].LocalUrl)
+}
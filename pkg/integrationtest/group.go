@@ -0,0 +1,365 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/datest"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const DEPENDENCY_GRAPH_JSON = "dependency-graph.json"
+
+// DependencyGraph is the dependency-graph.json of a group build from PNC. An edge means the source build depends
+// on the target build.
+type DependencyGraph struct {
+	Vertices map[string]struct {
+		Name string `json:"name"`
+	} `json:"vertices"`
+	Edges []struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	} `json:"edges"`
+}
+
+// LoadDependencyGraph reads the dependency-graph.json
+func LoadDependencyGraph(fileLoc string) (DependencyGraph, error) {
+	var g DependencyGraph
+	if !common.FileOrDirExists(fileLoc) {
+		return g, fmt.Errorf("%s not exists", fileLoc)
+	}
+	if err := json.Unmarshal(common.ReadByteFromFile(fileLoc), &g); err != nil {
+		return g, fmt.Errorf("invalid %s, %s", fileLoc, err)
+	}
+	return g, nil
+}
+
+// dependencies returns the builds each build depends on, and the builds depending on each build
+func (g DependencyGraph) dependencies() (map[string][]string, map[string][]string) {
+	deps := make(map[string][]string)
+	dependents := make(map[string][]string)
+	for _, e := range g.Edges {
+		deps[e.Source] = append(deps[e.Source], e.Target)
+		dependents[e.Target] = append(dependents[e.Target], e.Source)
+	}
+	return deps, dependents
+}
+
+// TopologicalOrder returns the builds with each one after the builds it depends on. Independent builds are sorted
+// by id, so that the order is stable. It fails if the graph has a cycle or an edge to an unknown build.
+func (g DependencyGraph) TopologicalOrder() ([]string, error) {
+	deps, dependents := g.dependencies()
+	remaining := make(map[string]int)
+	var ready []string
+	for id := range g.Vertices {
+		for _, d := range deps[id] {
+			if _, ok := g.Vertices[d]; !ok {
+				return nil, fmt.Errorf("build %s depends on unknown build %s", id, d)
+			}
+		}
+		remaining[id] = len(deps[id])
+		if remaining[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	sort.Strings(ready)
+
+	var order []string
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		var next []string
+		for _, d := range dependents[id] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				next = append(next, d)
+			}
+		}
+		sort.Strings(next)
+		ready = append(ready, next...)
+	}
+	if len(order) < len(g.Vertices) {
+		return nil, fmt.Errorf("dependency graph has a cycle")
+	}
+	return order, nil
+}
+
+// DependencyFailedError is the error of a build which is not run because a build it depends on failed
+type DependencyFailedError struct {
+	Dependency string
+}
+
+func (e *DependencyFailedError) Error() string {
+	return fmt.Sprintf("skipped, dependency %s failed", e.Dependency)
+}
+
+// runInOrder runs the builds of the graph with at most parallelism builds at a time. A build starts only after all
+// the builds it depends on succeeded; if any of them failed, it is not run and gets a DependencyFailedError. It
+// returns the error (nil if succeeded) of each build, and the builds in the order they finished.
+func runInOrder(g DependencyGraph, parallelism int, run func(id string) error) (map[string]error, []string, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, nil, err
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	deps, dependents := g.dependencies()
+	remaining := make(map[string]int)
+	for _, id := range order {
+		remaining[id] = len(deps[id])
+	}
+
+	type outcome struct {
+		id  string
+		err error
+	}
+	results := make(map[string]error)
+	var finished []string
+	failedDep := make(map[string]string) // build -> a failed dependency
+	var ready []string
+	for _, id := range order {
+		if remaining[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	// finish records the result, and makes the dependents ready, or fails them if the build failed
+	var finish func(id string, err error)
+	finish = func(id string, err error) {
+		results[id] = err
+		finished = append(finished, id)
+		for _, d := range dependents[id] {
+			if err != nil && failedDep[d] == "" {
+				failedDep[d] = id
+			}
+			remaining[d]--
+			if remaining[d] > 0 {
+				continue
+			}
+			if failedDep[d] != "" {
+				finish(d, &DependencyFailedError{Dependency: failedDep[d]})
+			} else {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	done := make(chan outcome)
+	running := 0
+	for len(results) < len(order) {
+		for running < parallelism && len(ready) > 0 {
+			id := ready[0]
+			ready = ready[1:]
+			running++
+			go func(id string) {
+				done <- outcome{id, run(id)}
+			}(id)
+		}
+		o := <-done
+		running--
+		finish(o.id, o.err)
+	}
+	return results, finished, nil
+}
+
+// groupBuild is the replay of a build of the group build
+type groupBuild struct {
+	id         string
+	dataset    Dataset
+	name       string // the build group, hosted repo and folo tracking id, e.g, build-913413
+	newVersion string
+	metaFiles  []string
+	built      bool
+	promoted   bool
+	promotion  string // the result of the promotion, for rollback
+	elapsed    time.Duration
+}
+
+/*
+ * RunGroup runs the integration test of all the builds of a group build, e.g, "12327" whose builds are in
+ * "12327/builds/<id>" of the dataset repo. The builds are replayed following the dependency-graph.json, with at
+ * most parallelism builds at a time on independent branches. For each build it runs (in order):
+ *
+ * a. Retrieve the metadata files in da.json
+ * b. Create the build group and hosted repo, download files, and upload the renamed files
+ * c. Verify the folo record, and check the new version not exists in the metadata
+ * d. Promote the uploads to the target store, and wait for the new version in the metadata
+ *
+ * A build starts after all the builds it depends on are promoted, and is skipped if any of them failed. After all
+ * the builds finish, the promotions are rolled back in reverse order, and the build groups and hosted repos are
+ * deleted. It returns true if all the builds succeeded.
+ */
+func RunGroup(indyBaseUrl, datasetRepoUrl, groupBuildId, promoteTargetStore, metaCheckRepo, promoteMode string, parallelism int,
+	clearCache, dryRun bool, poll PollOptions, upload buildtest.UploadOptions) bool {
+	indyBaseUrl = common.NormIndyURL(indyBaseUrl)
+	if dryRun {
+		poll.Timeout = 0 // nothing is promoted, no need to wait
+	}
+
+	datasetRepoDir := cloneRepo(datasetRepoUrl)
+	fmt.Printf("Clone SUCCESS, dir: %s\n", datasetRepoDir)
+	return runGroup(indyBaseUrl, datasetRepoDir, groupBuildId, promoteTargetStore, metaCheckRepo, promoteMode, parallelism, clearCache, dryRun, poll, upload)
+}
+
+func runGroup(indyBaseUrl, datasetRepoDir, groupBuildId, promoteTargetStore, metaCheckRepo, promoteMode string, parallelism int,
+	clearCache, dryRun bool, poll PollOptions, upload buildtest.UploadOptions) bool {
+	start := time.Now()
+	graph, err := LoadDependencyGraph(path.Join(datasetRepoDir, groupBuildId, DEPENDENCY_GRAPH_JSON))
+	if err == nil {
+		_, err = graph.TopologicalOrder()
+	}
+	if err != nil {
+		fmt.Printf("Error: cannot run group build %s, %s\n", groupBuildId, err)
+		report.RecordCheck(report.KIND_GROUP, groupBuildId, time.Since(start), err)
+		return false
+	}
+
+	// Generate the build names up front, so that they are unique in the group
+	builds := make(map[string]*groupBuild)
+	names := make(map[string]bool)
+	for id := range graph.Vertices {
+		name := common.GenerateRandomBuildName()
+		for names[name] {
+			name = common.GenerateRandomBuildName()
+		}
+		names[name] = true
+		ds := LoadDataset(datasetRepoDir, path.Join(groupBuildId, "builds", id))
+		builds[id] = &groupBuild{id: id, dataset: ds, name: name, newVersion: name[len(common.BUILD_TEST_):],
+			metaFiles: CalculateMetadataFiles(ds.FoloTrackContent)}
+	}
+
+	results, finished, _ := runInOrder(graph, parallelism, func(id string) error {
+		b := builds[id]
+		buildStart := time.Now()
+		err := replayAndPromote(indyBaseUrl, b, promoteTargetStore, metaCheckRepo, promoteMode, clearCache, dryRun, poll, upload)
+		b.elapsed = time.Since(buildStart)
+		if err != nil {
+			fmt.Printf("Group build %s: build %s (%s) FAILED, elapsed: %v, %s\n", groupBuildId, id, b.name, b.elapsed, err)
+		} else {
+			fmt.Printf("Group build %s: build %s (%s) SUCCESS, elapsed: %v\n", groupBuildId, id, b.name, b.elapsed)
+		}
+		return err
+	})
+
+	// Rollback in reverse order, so that a build is rolled back before the builds it depends on
+	for i := len(finished) - 1; i >= 0; i-- {
+		b := builds[finished[i]]
+		if !b.promoted {
+			continue
+		}
+		if !rollbackBuild(indyBaseUrl, promoteMode, b.promotion, dryRun) {
+			results[b.id] = fmt.Errorf("rollback failed")
+			continue
+		}
+		metaFilesLoc := path.Join(TMP_METADATA_DIR, b.name, "rollback")
+		if passed, e := PollMetadataAndValidate(indyBaseUrl, b.dataset.PackageType(), metaCheckRepo, b.metaFiles, metaFilesLoc,
+			b.newVersion, false, poll); !passed && results[b.id] == nil {
+			results[b.id] = fmt.Errorf("metadata check failed (rollback): %s", e.Error())
+		}
+		if !verifyRollback(indyBaseUrl, promoteMode, b.name, b.promotion, metaCheckRepo, dryRun, poll) && results[b.id] == nil {
+			results[b.id] = fmt.Errorf("rollback verification failed")
+		}
+	}
+	for _, id := range finished {
+		if builds[id].built {
+			CleanUp(indyBaseUrl, builds[id].dataset.PackageType(), builds[id].name, dryRun)
+		}
+	}
+
+	return reportGroup(groupBuildId, finished, builds, results, time.Since(start))
+}
+
+// replayAndPromote runs the steps a to d of RunGroup for a build
+func replayAndPromote(indyBaseUrl string, b *groupBuild, promoteTargetStore, metaCheckRepo, promoteMode string, clearCache, dryRun bool,
+	poll PollOptions, upload buildtest.UploadOptions) error {
+	ds := b.dataset
+	packageType := ds.PackageType()
+	datest.LookupMetadataByRoutines(AlignmentMetadataURLs(indyBaseUrl, ds, ""), DEFAULT_ROUTINES)
+
+	b.built = true // the repos may be created even if the build fails
+	if !buildtest.DoRun(ds.OriginalIndyBaseUrl(), "", indyBaseUrl, packageType, b.name, ds.FoloTrackContent, ds.AdditionalRepos,
+		DEFAULT_ROUTINES, clearCache, dryRun, upload, nil, 0) {
+		return fmt.Errorf("download/upload failed")
+	}
+	if !dryRun && !VerifyFoloRecord(indyBaseUrl, b.name, ds.FoloTrackContent) {
+		return fmt.Errorf("folo record not matches the original build")
+	}
+
+	metaFilesLoc := path.Join(TMP_METADATA_DIR, b.name, "before-promote")
+	if passed, e := RetrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, b.metaFiles, metaFilesLoc, b.newVersion, false); !passed {
+		return fmt.Errorf("metadata check failed (before): %s", e.Error())
+	}
+
+	resp, success := promoteBuild(indyBaseUrl, promoteMode, packageType, b.name, promoteTargetStore, b.newVersion, ds.FoloTrackContent, dryRun)
+	if !success {
+		return fmt.Errorf("promote failed, %s", resp)
+	}
+	b.promoted, b.promotion = true, resp
+
+	metaFilesLoc = path.Join(TMP_METADATA_DIR, b.name, "after-promote")
+	if passed, e := PollMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, b.metaFiles, metaFilesLoc, b.newVersion, true, poll); !passed {
+		return fmt.Errorf("metadata check failed (after promotion): %s", e.Error())
+	}
+	return nil
+}
+
+// reportGroup records the result of each build and the whole group, and prints them
+func reportGroup(groupBuildId string, finished []string, builds map[string]*groupBuild, results map[string]error,
+	elapsed time.Duration) bool {
+	var failed, skipped int
+	fmt.Printf("Group build %s results:\n", groupBuildId)
+	for _, id := range finished {
+		err := results[id]
+		r := report.Result{Kind: report.KIND_BUILD, Name: id + " (" + builds[id].name + ")", Status: report.STATUS_PASSED,
+			Duration: builds[id].elapsed}
+		status := "SUCCESS"
+		if _, ok := err.(*DependencyFailedError); ok {
+			r.Status, r.Error = report.STATUS_SKIPPED, err.Error()
+			status = "SKIPPED"
+			skipped++
+		} else if err != nil {
+			r.Status, r.Error = report.STATUS_FAILED, err.Error()
+			status = "FAILED"
+			failed++
+		}
+		report.Record(r)
+		if err != nil {
+			fmt.Printf("  %s (%s): %s, %s\n", id, builds[id].name, status, err)
+		} else {
+			fmt.Printf("  %s (%s): %s\n", id, builds[id].name, status)
+		}
+	}
+
+	var err error
+	if failed > 0 || skipped > 0 {
+		err = fmt.Errorf("builds: %d, failed: %d, skipped: %d", len(finished), failed, skipped)
+		fmt.Printf("Group build %s FAILED, %s, elapsed: %v\n", groupBuildId, err, elapsed)
+	} else {
+		fmt.Printf("Group build %s SUCCESS, builds: %d, elapsed: %v\n", groupBuildId, len(finished), elapsed)
+	}
+	report.RecordCheck(report.KIND_GROUP, groupBuildId, elapsed, err)
+	return err == nil
+}
@@ -0,0 +1,199 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/dataset"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newGraph creates a graph from the edges like "B->A", i.e, B depends on A
+func newGraph(ids []string, edges ...string) DependencyGraph {
+	var g DependencyGraph
+	b, _ := json.Marshal(map[string]interface{}{"vertices": map[string]interface{}{}})
+	json.Unmarshal(b, &g)
+	for _, id := range ids {
+		g.Vertices[id] = struct {
+			Name string `json:"name"`
+		}{id}
+	}
+	for _, e := range edges {
+		toks := strings.Split(e, "->")
+		g.Edges = append(g.Edges, struct {
+			Source string `json:"source"`
+			Target string `json:"target"`
+		}{toks[0], toks[1]})
+	}
+	return g
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	Convey("TestTopologicalOrder", t, func() {
+		g, err := LoadDependencyGraph("../dataset/testdata/pnc/group-builds/2836/dependency-graph.json")
+		So(err, ShouldBeNil)
+		order, err := g.TopologicalOrder()
+		So(err, ShouldBeNil)
+		So(order, ShouldResemble, []string{"AMJMVSDA5EAAE", "AMJMVSDA5EAAF"})
+
+		// A diamond: D depends on B and C, which depend on A
+		order, err = newGraph([]string{"D", "C", "B", "A", "E"}, "B->A", "C->A", "D->B", "D->C").TopologicalOrder()
+		So(err, ShouldBeNil)
+		So(order, ShouldResemble, []string{"A", "E", "B", "C", "D"})
+
+		_, err = newGraph([]string{"A", "B"}, "A->B", "B->A").TopologicalOrder()
+		So(err.Error(), ShouldContainSubstring, "cycle")
+		_, err = newGraph([]string{"A"}, "A->X").TopologicalOrder()
+		So(err.Error(), ShouldContainSubstring, "unknown build X")
+	})
+}
+
+func TestRunInOrder(t *testing.T) {
+	g := newGraph([]string{"A", "B", "C", "D", "E", "F"}, "B->A", "C->A", "D->B", "D->C", "F->E")
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	started := make(map[string]time.Time)
+	ended := make(map[string]time.Time)
+	run := func(id string) error {
+		mu.Lock()
+		started[id] = time.Now()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		ended[id] = time.Now()
+		running--
+		mu.Unlock()
+		if id == "E" {
+			return fmt.Errorf("E failed")
+		}
+		return nil
+	}
+	results, finished, err := runInOrder(g, 2, run)
+
+	Convey("TestRunInOrder", t, func() {
+		So(err, ShouldBeNil)
+		So(maxRunning, ShouldEqual, 2)
+		So(len(finished), ShouldEqual, 6)
+		for _, dep := range [][]string{{"B", "A"}, {"C", "A"}, {"D", "B"}, {"D", "C"}} {
+			So(started[dep[0]].Before(ended[dep[1]]), ShouldBeFalse)
+		}
+		So(results["D"], ShouldBeNil)
+		So(results["E"].Error(), ShouldEqual, "E failed")
+		// F is not run since E failed
+		So(results["F"], ShouldResemble, &DependencyFailedError{Dependency: "E"})
+		So(started["F"].IsZero(), ShouldBeTrue)
+	})
+}
+
+// newGroupBuild runs an original build of the group through the folo of the mock indy, and writes it to the dataset
+func newGroupBuild(indy *mockindy.Server, datasetDir, groupId, buildId, artifactId string) {
+	store := "build-" + buildId
+	indy.Seed("maven:hosted:pnc-builds", fmt.Sprintf("/org/foo/%s/0.9.0.redhat-00001/%s-0.9.0.redhat-00001.pom", artifactId, artifactId),
+		[]byte("old-pom"))
+	indy.AddStore("maven:hosted:"+store, nil)
+	trackURL := indy.URL + "/api/folo/track/" + store
+	for _, p := range []string{
+		fmt.Sprintf("/org/foo/%s/1.0.0.redhat-00001/%s-1.0.0.redhat-00001.pom", artifactId, artifactId),
+		fmt.Sprintf("/org/foo/%s/1.0.0.redhat-00001/%s-1.0.0.redhat-00001.jar", artifactId, artifactId),
+	} {
+		common.HTTPRequest(trackURL+"/maven/hosted/"+store+p, common.MethodPut, nil, false,
+			strings.NewReader("content of "+p), nil, "", false)
+	}
+	common.SealFoloRecord(indy.URL, store)
+	tracking, _ := json.Marshal(common.GetFoloRecord(indy.URL, store))
+
+	buildDir := path.Join(datasetDir, groupId, "builds", buildId)
+	os.MkdirAll(buildDir, 0755)
+	ioutil.WriteFile(path.Join(buildDir, dataset.TRACKING_JSON), tracking, 0644)
+	ioutil.WriteFile(path.Join(buildDir, dataset.DA_JSON), []byte(`[]`), 0644)
+}
+
+func TestRunGroup(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+
+	mountPath, _ := ioutil.TempDir("", "indy-it-group")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	datasetDir := path.Join(mountPath, "dataset")
+	os.MkdirAll(path.Join(datasetDir, "2836"), 0755)
+	ioutil.WriteFile(path.Join(datasetDir, "2836", dataset.INFO_JSON), []byte(`{"buildId": "2836", "buildType": "MVN"}`), 0644)
+	graph, _ := ioutil.ReadFile("../dataset/testdata/pnc/group-builds/2836/dependency-graph.json")
+	ioutil.WriteFile(path.Join(datasetDir, "2836", DEPENDENCY_GRAPH_JSON), graph, 0644)
+	newGroupBuild(indy, datasetDir, "2836", "AMJMVSDA5EAAE", "bar")
+	newGroupBuild(indy, datasetDir, "2836", "AMJMVSDA5EAAF", "baz")
+
+	report.Start("integrationtest", nil, "")
+	poll := PollOptions{Timeout: 5 * time.Second, Interval: 50 * time.Millisecond}
+	passed := runGroup(indy.URL, datasetDir, "2836", "", META_CHECK_REPO, promotetest.MODE_PATHS, 2, false, false, poll, buildtest.UploadOptions{})
+	r := report.Current()
+
+	Convey("TestRunGroup", t, func() {
+		So(passed, ShouldBeTrue)
+		So(r.Summary.Failed, ShouldEqual, 0)
+		var builds []string
+		groups := 0
+		for _, res := range r.Results {
+			switch res.Kind {
+			case report.KIND_BUILD:
+				So(res.Status, ShouldEqual, report.STATUS_PASSED)
+				builds = append(builds, res.Name[:len("AMJMVSDA5EAAE")])
+			case report.KIND_GROUP:
+				So(res.Name, ShouldEqual, "2836")
+				So(res.Status, ShouldEqual, report.STATUS_PASSED)
+				groups++
+			}
+		}
+		So(builds, ShouldResemble, []string{"AMJMVSDA5EAAE", "AMJMVSDA5EAAF"})
+		So(groups, ShouldEqual, 1)
+
+		// Promoted and rolled back, then cleaned up
+		for _, p := range []string{"/org/foo/bar/maven-metadata.xml", "/org/foo/baz/maven-metadata.xml"} {
+			meta, _, _ := common.HTTPRequest(indy.URL+"/api/content/maven/group/builds-untested+shared-imports+public"+p,
+				common.MethodGet, nil, true, nil, nil, "", false)
+			So(meta, ShouldContainSubstring, "0.9.0.redhat-00001")
+			So(meta, ShouldNotContainSubstring, "1.0.0")
+		}
+		for _, res := range r.Results {
+			if res.Kind == report.KIND_BUILD {
+				buildName := strings.TrimSuffix(res.Name[len("AMJMVSDA5EAAE ("):], ")")
+				So(indy.HasStore("maven:hosted:"+buildName), ShouldBeFalse)
+				So(indy.HasStore("maven:group:"+buildName), ShouldBeFalse)
+			}
+		}
+	})
+}
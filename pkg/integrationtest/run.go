@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
 	"path"
 	"strings"
 	"time"
@@ -31,14 +32,24 @@ import (
 	"github.com/commonjava/indy-tests/pkg/dataset"
 	"github.com/commonjava/indy-tests/pkg/datest"
 	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 const (
 	DEFAULT_ROUTINES     = 4
 	TMP_METADATA_DIR     = "/tmp/metadata"
 	PROMOTE_TARGET_STORE = "pnc-builds"
+
+	DEFAULT_POLL_TIMEOUT  = 5 * time.Minute
+	DEFAULT_POLL_INTERVAL = 2 * time.Second
 )
 
+// PollOptions of checking the metadata after promotion and rollback, until indy handles the events
+type PollOptions struct {
+	Timeout  time.Duration // 0 means checking only once
+	Interval time.Duration
+}
+
 /*
  * Run integration test. If dryRun is true, it prints the repo creation, file down/upload, promote, rollback,
  * and clean-up info without really doing them. Otherwise, it will run (in order):
@@ -50,110 +61,121 @@ const (
  * e. Download the files in tracking "uploads" from origin, and rename all the files (jar, pom, and so on)
  *    with a new version suffix and upload them to the hosted repo A. Seal the folo record afterwards.
  * f. Retrieve the metadata files that will be affected by promotion, check that the new version not exists
- * g. Promote the files in hosted repo A to target hosted repo, e.g, pnc-builds
- * h. Retrieve the metadata files from step #f again, check that the new version is available
+ * g. Promote the files in hosted repo A to target hosted repo, e.g, pnc-builds. Or with the group promote mode,
+ *    add the hosted repo A to the target group as a constituent
+ * h. Retrieve the metadata files from step #f again until the new version is available, or the poll times out
  * i. Rollback the promotion
- * j. Retrieve the metadata files from step #f again, check that the new version is gone
+ * j. Retrieve the metadata files from step #f again until the new version is gone, or the poll times out. Then
+ *    verify that each promoted path and its checksums are gone from the target hosted repo
  * k. Clean up. Delete the build group G and the hosted repo A. Delete folo record.
  */
-func Run(indyBaseUrl, datasetRepoUrl, buildId, promoteTargetStore, metaCheckRepo string, clearCache, dryRun, keepPod bool) {
+func Run(indyBaseUrl, datasetRepoUrl, buildId, promoteTargetStore, metaCheckRepo, promoteMode string, clearCache, dryRun, keepPod bool,
+	poll PollOptions, upload buildtest.UploadOptions) {
+	indyBaseUrl = common.NormIndyURL(indyBaseUrl)
+	if dryRun {
+		poll.Timeout = 0 // nothing is promoted, no need to wait
+	}
+
 	//a. Clone dataset repo
 	datasetRepoDir := cloneRepo(datasetRepoUrl)
 	fmt.Printf("Clone SUCCESS, dir: %s\n", datasetRepoDir)
 
-	//Load the info.json
-	var info dataset.Info
-	infoFileLoc := getInfoFileLoc(datasetRepoDir, buildId)
-	json.Unmarshal(common.ReadByteFromFile(infoFileLoc), &info)
-
-	//Load the additional-repos.json
-	additionalReposFileLoc := path.Join(datasetRepoDir, buildId, dataset.ADDITIONAL_REPOS)
-	additionalRepos := getAdditionalRepos(additionalReposFileLoc)
+	//Load the info.json, additional-repos.json and tracking.json
+	ds := LoadDataset(datasetRepoDir, buildId)
 
 	start := time.Now()
 
 	//b. Retrieve the metadata files in da.json
-	retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId, info)
+	datest.LookupMetadataByRoutines(AlignmentMetadataURLs(indyBaseUrl, ds, ""), DEFAULT_ROUTINES)
 	t := time.Now()
 	fmt.Printf("Retrieve metadata SUCCESS, elapsed(s): %f\n", t.Sub(start).Seconds())
 
-	//c/d/e. Create a mock build group, download files, rename to-be-uploaded files
-	packageType := getPackageType(info)
-	foloFileLoc := path.Join(datasetRepoDir, buildId, dataset.TRACKING_JSON)
-	foloTrackContent := common.GetFoloRecordFromFile(foloFileLoc)
-	originalIndy := getOriginalIndyBaseUrl(foloTrackContent.Uploads[0].LocalUrl)
-	buildName := common.GenerateRandomBuildName()
-	prev := t
-	buildSuccess := buildtest.DoRun(originalIndy, "", indyBaseUrl, packageType, buildName, foloTrackContent, additionalRepos, DEFAULT_ROUTINES, clearCache, dryRun)
-	t = time.Now()
-	fmt.Printf("Create mock group(%s) and download/upload SUCCESS, elapsed(s): %f\n", buildName, t.Sub(prev).Seconds())
+	//c-k. Replay the build, promote and roll back it, failing the test if any check fails
+	if !replayAndVerify(indyBaseUrl, ds, promoteTargetStore, metaCheckRepo, promoteMode, clearCache, dryRun, poll, upload) {
+		report.Exit(1)
+	}
 
+	// Pause and keep pod for debugging
+	if keepPod {
+		fmt.Printf("Waiting 30m...\n")
+		time.Sleep(30 * time.Minute)
+	}
+}
+
+// replayAndVerify runs the steps c to k of Run, and returns false if any step fails. The promotion is rolled back
+// even if the metadata check after it fails, and the repos of the build are always cleaned up.
+func replayAndVerify(indyBaseUrl string, ds Dataset, promoteTargetStore, metaCheckRepo, promoteMode string, clearCache, dryRun bool,
+	poll PollOptions, upload buildtest.UploadOptions) bool {
+	packageType := ds.PackageType()
+	foloTrackContent := ds.FoloTrackContent
+	originalIndy := ds.OriginalIndyBaseUrl()
+	buildName := common.GenerateRandomBuildName()
+	prev := time.Now()
+	//c/d/e. Create a mock build group, download files, rename to-be-uploaded files
+	buildSuccess := buildtest.DoRun(originalIndy, "", indyBaseUrl, packageType, buildName, foloTrackContent, ds.AdditionalRepos, DEFAULT_ROUTINES, clearCache, dryRun, upload, nil, 0)
 	//k. Delete the temp group and the hosted repo, and folo record
-	defer cleanUp(indyBaseUrl, packageType, buildName, dryRun)
+	defer CleanUp(indyBaseUrl, packageType, buildName, dryRun)
+	if !buildSuccess {
+		return false
+	}
+	fmt.Printf("Create mock group(%s) and download/upload SUCCESS, elapsed(s): %f\n", buildName, time.Since(prev).Seconds())
 
 	// Advanced checks
-	if buildSuccess && !dryRun {
-		if !verifyFoloRecord(indyBaseUrl, buildName, foloTrackContent) {
-			return
-		}
+	if !dryRun && !VerifyFoloRecord(indyBaseUrl, buildName, foloTrackContent) {
+		return false
 	}
 
 	//f. Retrieve the metadata files which will be affected by promotion
-	metaFiles := calculateMetadataFiles(foloTrackContent)
+	metaFiles := CalculateMetadataFiles(foloTrackContent)
 	metaFilesLoc := path.Join(TMP_METADATA_DIR, "before-promote")
 	newVersionNum := buildName[len(common.BUILD_TEST_):]
 	exists := true
-	passed, e := retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, !exists)
+	passed, e := RetrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, !exists)
 	if !passed {
 		logger.Infof("Metadata check failed (before). Errors: %s", e.Error())
-		return
+		return false
 	}
 	fmt.Printf("Metadata validate (before) SUCCESS\n")
 
 	//g. Promote the files in hosted repo A to hosted repo pnc-builds
-	foloTrackId := buildName
-	sourceStore, targetStore := getPromotionSrcTargetStores(packageType, buildName, promoteTargetStore, foloTrackContent)
-	resp, _, success := promotetest.DoRun(indyBaseUrl, foloTrackId, sourceStore, targetStore, newVersionNum, foloTrackContent, dryRun)
+	resp, success := promoteBuild(indyBaseUrl, promoteMode, packageType, buildName, promoteTargetStore, newVersionNum, foloTrackContent, dryRun)
 	if !success {
 		fmt.Printf("Promote failed, %s\n", resp)
-		return
+		return false
 	}
 
-	//h. Retrieve the metadata files again, check the new version
-	fmt.Printf("Waiting 30s...\n")
-	time.Sleep(30 * time.Second) // wait for Indy event handled
-
+	//h. Retrieve the metadata files again until the new version is available, i.e, Indy has handled the events
 	metaFilesLoc = path.Join(TMP_METADATA_DIR, "after-promote")
-	passed, e = retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, exists)
-	if !passed {
+	succeeded, e := PollMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, exists, poll)
+	if !succeeded {
 		logger.Infof("Metadata check failed (after promotion). Errors: %s", e.Error())
-		return
+	} else {
+		fmt.Printf("Metadata validate (after promotion) SUCCESS\n")
 	}
-	fmt.Printf("Metadata validate (after promotion) SUCCESS\n")
 
 	//i. Rollback the promotion
-	promotetest.Rollback(indyBaseUrl, resp, dryRun)
-
-	//h. Retrieve the metadata files again, check the new version is GONE
-	fmt.Printf("Waiting 30s...\n")
-	time.Sleep(30 * time.Second)
+	if !rollbackBuild(indyBaseUrl, promoteMode, resp, dryRun) {
+		logger.Infof("Rollback failed.")
+		return false
+	}
 
+	//j. Retrieve the metadata files again until the new version is GONE
 	metaFilesLoc = path.Join(TMP_METADATA_DIR, "rollback")
-	passed, e = retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, !exists)
+	passed, e = PollMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, !exists, poll)
 	if !passed {
 		logger.Infof("Metadata check failed (rollback). Errors: %s", e.Error())
-		return
+		return false
 	}
 	fmt.Printf("Metadata validate (rollback) SUCCESS\n")
-
-	// Pause and keep pod for debugging
-	if keepPod {
-		fmt.Printf("Waiting 30m...\n")
-		time.Sleep(30 * time.Minute)
+	if !verifyRollback(indyBaseUrl, promoteMode, buildName, resp, metaCheckRepo, dryRun, poll) {
+		logger.Infof("Rollback verification failed.")
+		return false
 	}
+	return succeeded
 }
 
-func verifyFoloRecord(indyBaseUrl, buildName string, originalTrackContent common.TrackedContent) bool {
+func VerifyFoloRecord(indyBaseUrl, buildName string, originalTrackContent common.TrackedContent) bool {
+	start := time.Now()
 	trackedContent := common.GetFoloRecord(indyBaseUrl, buildName)
 	// For debug
 	// b, _ := json.MarshalIndent(trackedContent, "", "  ")
@@ -161,6 +183,8 @@ func verifyFoloRecord(indyBaseUrl, buildName string, originalTrackContent common
 
 	if trackedContent.TrackingKey.Id != buildName {
 		logger.Infof("Verify folo record FAILED! TrackingKey.Id, expected: %s, got: %s", buildName, trackedContent.TrackingKey.Id)
+		report.RecordCheck(report.KIND_FOLO, "verify "+buildName, time.Since(start),
+			fmt.Errorf("TrackingKey.Id, expected: %s, got: %s", buildName, trackedContent.TrackingKey.Id))
 		return false
 	}
 
@@ -168,8 +192,11 @@ func verifyFoloRecord(indyBaseUrl, buildName string, originalTrackContent common
 	downloadErrors := checkFoloEntries("Downloads", nil, "", trackedContent.Downloads, originalTrackContent.Downloads)
 
 	if len(uploadErrors) > 0 || len(downloadErrors) > 0 {
+		report.RecordCheck(report.KIND_FOLO, "verify "+buildName, time.Since(start),
+			fmt.Errorf("%s", strings.Join(append(uploadErrors, downloadErrors...), ", ")))
 		return false
 	}
+	report.RecordCheck(report.KIND_FOLO, "verify "+buildName, time.Since(start), nil)
 	logger.Info("Verify folo record SUCCESS!")
 	return true
 }
@@ -194,7 +221,8 @@ func checkFoloEntries(title string, alterPath func(string, string) string, build
 		if common.IsRegularFile(p) {
 			if m[p] == "" {
 				errors = append(errors, "[Missing] "+v.Path)
-			} else if m[p] != v.Md5 {
+			} else if m[p] != v.Md5 && !(alterPath != nil && common.IsNpmTarball(p)) {
+				// The uploaded npm tarballs are altered with the new version, so only the md5 of the others is checked
 				errors = append(errors, "[Md5-Error] "+v.Path)
 			}
 		}
@@ -225,7 +253,7 @@ func getInfoFileLoc(datasetRepoDir, buildId string) string {
 	return path.Join(datasetRepoDir, toks[0], dataset.INFO_JSON)
 }
 
-func getPromotionSrcTargetStores(packageType, buildName, targetStoreName string, foloTrackContent common.TrackedContent) (string, string) {
+func GetPromotionSrcTargetStores(packageType, buildName, targetStoreName string, foloTrackContent common.TrackedContent) (string, string) {
 	toks := strings.Split(foloTrackContent.Uploads[0].StoreKey, ":")
 	sourceStore := fmt.Sprintf("%s:%s:%s", toks[0], toks[1], buildName)
 	if targetStoreName == "" {
@@ -236,7 +264,43 @@ func getPromotionSrcTargetStores(packageType, buildName, targetStoreName string,
 	return sourceStore, targetStore
 }
 
-func calculateMetadataFiles(foloTrackContent common.TrackedContent) []string {
+// promoteBuild promotes the uploads of the build to the target store, or the hosted repo of the build to the target
+// group in promotetest.MODE_GROUP. It returns the result of the promotion for rollback.
+func promoteBuild(indyBaseUrl, promoteMode, packageType, buildName, promoteTargetStore, newVersionNum string,
+	foloTrackContent common.TrackedContent, dryRun bool) (string, bool) {
+	sourceStore, targetStore := GetPromotionSrcTargetStores(packageType, buildName, promoteTargetStore, foloTrackContent)
+	if promoteMode == promotetest.MODE_GROUP {
+		targetGroup := strings.Replace(targetStore, ":hosted:", ":group:", 1)
+		fmt.Printf("Promote to group: %s\n", targetGroup)
+		resp, _, success := promotetest.DoRunGroup(indyBaseUrl, buildName, sourceStore, targetGroup, foloTrackContent, dryRun)
+		return resp, success
+	}
+	resp, _, success := promotetest.DoRun(indyBaseUrl, buildName, sourceStore, targetStore, newVersionNum, foloTrackContent, dryRun, promotetest.AsyncOptions{})
+	return resp, success
+}
+
+// rollbackBuild rolls back the promotion of promoteBuild
+func rollbackBuild(indyBaseUrl, promoteMode, promotion string, dryRun bool) bool {
+	if promoteMode == promotetest.MODE_GROUP {
+		_, _, success := promotetest.RollbackGroup(indyBaseUrl, promotion, dryRun)
+		return success
+	}
+	_, _, success := promotetest.Rollback(indyBaseUrl, promotion, dryRun)
+	return success
+}
+
+// verifyRollback checks the target, the source and the folo record of the rolled back promotion of promoteBuild
+// path by path. The group promotion moves no paths, the rollback of which is verified by the membership of the group.
+func verifyRollback(indyBaseUrl, promoteMode, buildName, promotion, metaCheckRepo string, dryRun bool, poll PollOptions) bool {
+	if promoteMode == promotetest.MODE_GROUP || dryRun {
+		return true
+	}
+	return promotetest.VerifyRollback(indyBaseUrl, promotion, buildName, metaCheckRepo, poll.Interval, poll.Timeout)
+}
+
+// CalculateMetadataFiles returns the metadata paths affected by promoting the uploads, i.e, the maven-metadata.xml
+// of each pom, and the package document of each npm tarball
+func CalculateMetadataFiles(foloTrackContent common.TrackedContent) []string {
 	paths := []string{}
 	for _, up := range foloTrackContent.Uploads {
 		if strings.HasSuffix(up.Path, ".pom") {
@@ -244,12 +308,26 @@ func calculateMetadataFiles(foloTrackContent common.TrackedContent) []string {
 			artifactDir := path.Dir(versionsDir)
 			metadataPath := path.Join(artifactDir, common.MAVEN_METADATA_XML)
 			paths = append(paths, metadataPath)
+		} else if common.IsNpmTarball(up.Path) {
+			metadataPath := common.NpmMetadataPath(common.NpmPackageName(up.Path))
+			if !common.Contains(paths, metadataPath) {
+				paths = append(paths, metadataPath)
+			}
 		}
 	}
 	return paths
 }
 
-func retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string, metaFiles []string, filesLoc, versionNumber string, exist bool) (bool, error) {
+func RetrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string, metaFiles []string, filesLoc, versionNumber string, exist bool) (bool, error) {
+	return PollMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, filesLoc, versionNumber, exist, PollOptions{})
+}
+
+// PollMetadataAndValidate fetches the metadata files again and again until the version exists (or not) as expected
+// in all of them, or the timeout elapses. The time until a file is as expected is the propagation latency, i.e,
+// the delay of indy handling the promotion/rollback events, which is recorded in the report. With a zero timeout,
+// the files are checked only once.
+func PollMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string, metaFiles []string, filesLoc, versionNumber string,
+	exist bool, opts PollOptions) (bool, error) {
 	if metaCheckRepo == "" {
 		fmt.Printf("Skip metadata check, no metaCheckRepo specified.\n")
 		return true, nil
@@ -265,47 +343,109 @@ func retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string,
 		repoType = toks[1]
 		repoName = toks[2]
 	}
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_POLL_INTERVAL
+	}
 
-	// Download meta files
-	for _, p := range metaFiles {
-		url := common.GetIndyContentUrl(indyBaseUrl, packageType, repoType, repoName, p)
-		common.DownloadFile(url, path.Join(filesLoc, p))
+	stage := path.Base(filesLoc)
+	start := time.Now()
+	pending := metaFiles
+	results := make(map[string]common.TransferResult)
+	var propagation time.Duration
+	for attempt := 1; ; attempt++ {
+		var unmatched []string
+		for _, p := range pending {
+			url := common.GetIndyContentUrl(indyBaseUrl, packageType, repoType, repoName, p)
+			result := checkMetadata(url, path.Join(filesLoc, p), packageType, versionNumber, exist)
+			results[p] = result
+			if result.Err != nil {
+				unmatched = append(unmatched, p)
+				continue
+			}
+			// The propagation latency of the file, rather than the time of the last download
+			result.Duration = time.Since(start)
+			if result.Duration > propagation {
+				propagation = result.Duration
+			}
+			report.RecordTransfer(report.KIND_METADATA, p+" ("+stage+")", result)
+		}
+		pending = unmatched
+		if len(pending) == 0 || time.Since(start)+opts.Interval > opts.Timeout {
+			break
+		}
+		fmt.Printf("Metadata not as expected yet (%s), files: %d, attempt: %d, elapsed: %v\n", stage, len(pending), attempt,
+			time.Since(start).Round(time.Millisecond))
+		time.Sleep(opts.Interval)
 	}
 
 	// Check version
-	success := true
 	var e common.MultiError
-	for _, p := range metaFiles {
-		file := path.Join(filesLoc, p)
-		// read file and see if version exist
-		if !common.FileOrDirExists(file) {
-			fmt.Printf("Check metadata FAILED, file: %s, file not exists\n", file)
-			success = false
-			e.Append(p)
-			continue
-		} else {
-			content := string(common.ReadByteFromFile(file))
-			fmt.Printf("Check metadata, file: %s, content:\n%s\n", file, content)
-			index := strings.Index(content, common.REDHAT_+versionNumber)
-			isExist := false
-			if index >= 0 {
-				isExist = true
-			}
-			if isExist != exist {
-				success = false
-				e.Append(p)
-			}
+	for _, p := range pending {
+		result := results[p]
+		fmt.Printf("Check metadata FAILED, file: %s, %s\n", path.Join(filesLoc, p), result.Err)
+		e.Append(p)
+		result.Duration = time.Since(start)
+		report.RecordTransfer(report.KIND_METADATA, p+" ("+stage+")", result)
+	}
+	if len(pending) > 0 {
+		return false, &e
+	}
+	if opts.Timeout > 0 {
+		fmt.Printf("Metadata propagation (%s), files: %d, latency: %v\n", stage, len(metaFiles), propagation.Round(time.Millisecond))
+		report.RecordMetric("metadata propagation ("+stage+")", propagation)
+	}
+	return true, &e
+}
+
+// checkMetadata downloads the metadata file and checks the version exists or not as expected. The error of the
+// result is set if not.
+func checkMetadata(url, file, packageType, versionNumber string, exist bool) common.TransferResult {
+	os.Remove(file) // not to check the one of the previous attempt if the download fails
+	result := common.DownloadFileWithResult(url, file)
+	// read file and see if version exist
+	if !common.FileOrDirExists(file) {
+		if result.Err == nil {
+			result.Err = fmt.Errorf("file not exists")
 		}
+		return result
+	}
+	content := common.ReadByteFromFile(file)
+	fmt.Printf("Check metadata, file: %s, content:\n%s\n", file, content)
+	isExist, err := metadataHasVersion(packageType, content, versionNumber)
+	if err != nil {
+		result.Err = err
+	} else if isExist != exist {
+		result.Err = fmt.Errorf("version %s exists: %t, expected: %t", common.REDHAT_+versionNumber, isExist, exist)
 	}
-	return success, &e
+	return result
+}
+
+// metadataHasVersion checks if the version with the release number is in the metadata, i.e, in the versions of
+// an npm package document, or anywhere in a maven-metadata.xml
+func metadataHasVersion(packageType string, content []byte, versionNumber string) (bool, error) {
+	if packageType != common.PACKAGE_TYPE_NPM {
+		return strings.Contains(string(content), common.REDHAT_+versionNumber), nil
+	}
+	versions, err := common.NpmMetadataVersions(content)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range versions {
+		if strings.HasSuffix(v, common.REDHAT_+versionNumber) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func cloneRepo(datasetRepoUrl string) string {
 	return common.DownloadRepo(datasetRepoUrl)
 }
 
-func retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId string, info dataset.Info) {
-	fileLoc := path.Join(datasetRepoDir, buildId, dataset.DA_JSON)
+// AlignmentMetadataURLs returns the urls of the metadata files in da.json, through the DA group of the target indy.
+// groupName defaults to DA, or DA-temporary-builds for a temporary build.
+func AlignmentMetadataURLs(indyBaseUrl string, ds Dataset, groupName string) []string {
+	fileLoc := path.Join(ds.RepoDir, ds.BuildId, dataset.DA_JSON)
 
 	// Read jsonFile
 	byteValue := common.ReadByteFromFile(fileLoc)
@@ -315,10 +455,12 @@ func retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId string, info
 	json.Unmarshal([]byte(byteValue), &arr)
 
 	var urls []string
-	packageType := getPackageType(info)
-	groupName := "DA"
-	if info.TemporaryBuild {
-		groupName = "DA-temporary-builds"
+	packageType := ds.PackageType()
+	if groupName == "" {
+		groupName = "DA"
+		if ds.Info.TemporaryBuild {
+			groupName = "DA-temporary-builds"
+		}
 	}
 
 	for _, v := range arr {
@@ -331,8 +473,7 @@ func retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId string, info
 			fmt.Println(v)
 		}
 	}
-
-	datest.LookupMetadataByRoutines(urls, DEFAULT_ROUTINES)
+	return urls
 }
 
 func getPackageType(info dataset.Info) string {
@@ -351,7 +492,7 @@ func getOriginalIndyBaseUrl(localUrl string) string {
 	return u.Scheme + "://" + u.Host
 }
 
-func cleanUp(indyBaseUrl, packageType, buildName string, dryRun bool) {
+func CleanUp(indyBaseUrl, packageType, buildName string, dryRun bool) {
 	if dryRun {
 		fmt.Printf("Dry run cleanUp\n")
 		return
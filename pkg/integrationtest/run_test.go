@@ -0,0 +1,319 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	META_CHECK_REPO = "builds-untested+shared-imports+public"
+	ORIGINAL_BUILD  = "build-1234"
+)
+
+// newOriginalBuild seeds the mock indy with a dependency and an older released version, then "runs" the
+// original build through folo so that its tracking record can be replayed.
+func newOriginalBuild(indy *mockindy.Server) common.TrackedContent {
+	indy.Seed("maven:remote:central", "/org/dep/dep/1.0/dep-1.0.jar", []byte("dep-jar"))
+	indy.Seed("maven:hosted:pnc-builds", "/org/foo/bar/0.9.0.redhat-00001/bar-0.9.0.redhat-00001.pom", []byte("old-pom"))
+	indy.AddStore("maven:hosted:"+ORIGINAL_BUILD, nil)
+
+	trackURL := indy.URL + "/api/folo/track/" + ORIGINAL_BUILD
+	common.HTTPRequest(trackURL+"/maven/group/"+META_CHECK_REPO+"/org/dep/dep/1.0/dep-1.0.jar",
+		common.MethodGet, nil, false, nil, nil, "", false)
+	for _, p := range []string{
+		"/org/foo/bar/1.0.0.redhat-00001/bar-1.0.0.redhat-00001.pom",
+		"/org/foo/bar/1.0.0.redhat-00001/bar-1.0.0.redhat-00001.jar",
+	} {
+		common.HTTPRequest(trackURL+"/maven/hosted/"+ORIGINAL_BUILD+p, common.MethodPut, nil, false,
+			strings.NewReader("content of "+p), nil, "", false)
+	}
+	common.SealFoloRecord(indy.URL, ORIGINAL_BUILD)
+	return common.GetFoloRecord(indy.URL, ORIGINAL_BUILD)
+}
+
+func TestIntegrationFlow(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+
+	mountPath, _ := ioutil.TempDir("", "indy-it")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalBuild(indy)
+	buildName := common.GenerateRandomBuildName()
+	newVersionNum := buildName[len(common.BUILD_TEST_):]
+	metaFiles := CalculateMetadataFiles(foloTrackContent)
+	metaFilesLoc := mountPath + "/metadata"
+	reportDir := path.Join(mountPath, "report")
+	report.Start("integrationtest", nil, reportDir)
+
+	Convey("TestIntegrationFlow", t, func() {
+		So(buildtest.DoRun(indy.URL, "", indy.URL, "maven", buildName, foloTrackContent, nil, 2, false, false, buildtest.UploadOptions{}, nil, 0), ShouldBeTrue)
+		So(VerifyFoloRecord(indy.URL, buildName, foloTrackContent), ShouldBeTrue)
+		So(indy.IsSealed(buildName), ShouldBeTrue)
+
+		passed, _ := RetrieveMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/before", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+
+		sourceStore, targetStore := GetPromotionSrcTargetStores("maven", buildName, "", foloTrackContent)
+		resp, _, success := promotetest.DoRun(indy.URL, buildName, sourceStore, targetStore, newVersionNum, foloTrackContent, false, promotetest.AsyncOptions{})
+		So(success, ShouldBeTrue)
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/after", newVersionNum, true)
+		So(passed, ShouldBeTrue)
+
+		_, _, success = promotetest.Rollback(indy.URL, resp, false)
+		So(success, ShouldBeTrue)
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/rollback", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+		So(verifyRollback(indy.URL, promotetest.MODE_PATHS, buildName, resp, META_CHECK_REPO, false, PollOptions{}), ShouldBeTrue)
+
+		CleanUp(indy.URL, "maven", buildName, false)
+		So(indy.HasStore("maven:hosted:"+buildName), ShouldBeFalse)
+		So(indy.HasStore("maven:group:"+buildName), ShouldBeFalse)
+
+		So(report.Write(), ShouldBeNil)
+		So(common.FileOrDirExists(path.Join(reportDir, report.REPORT_JSON)), ShouldBeTrue)
+		So(common.FileOrDirExists(path.Join(reportDir, report.JUNIT_XML)), ShouldBeTrue)
+		r := report.Current()
+		So(r.Summary.Failed, ShouldEqual, 0)
+		kinds := map[string]int{}
+		for _, res := range r.Results {
+			kinds[res.Kind]++
+		}
+		So(kinds[report.KIND_DOWNLOAD], ShouldEqual, len(foloTrackContent.Downloads))
+		So(kinds[report.KIND_UPLOAD], ShouldEqual, len(foloTrackContent.Uploads))
+		So(kinds[report.KIND_METADATA], ShouldEqual, 4*len(metaFiles))
+		So(kinds[report.KIND_PROMOTION], ShouldEqual, 1)
+		So(kinds[report.KIND_ROLLBACK], ShouldEqual, 1+len(foloTrackContent.Uploads))
+	})
+}
+
+func TestGroupPromotionFlow(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+
+	mountPath, _ := ioutil.TempDir("", "indy-it")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	indy.AddStore("maven:group:tested-builds", []string{"maven:hosted:pnc-builds"})
+	foloTrackContent := newOriginalBuild(indy)
+	buildName := common.GenerateRandomBuildName()
+	newVersionNum := buildName[len(common.BUILD_TEST_):]
+	metaFiles := CalculateMetadataFiles(foloTrackContent)
+	metaFilesLoc := mountPath + "/metadata"
+	report.Start("integrationtest", nil, "")
+
+	Convey("TestGroupPromotionFlow", t, func() {
+		So(buildtest.DoRun(indy.URL, "", indy.URL, "maven", buildName, foloTrackContent, nil, 2, false, false, buildtest.UploadOptions{}, nil, 0), ShouldBeTrue)
+		passed, _ := RetrieveMetadataAndValidate(indy.URL, "maven", "tested-builds", metaFiles, metaFilesLoc+"/before", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+
+		resp, success := promoteBuild(indy.URL, promotetest.MODE_GROUP, "maven", buildName, "tested-builds", newVersionNum, foloTrackContent, false)
+		So(success, ShouldBeTrue)
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "maven", "tested-builds", metaFiles, metaFilesLoc+"/after", newVersionNum, true)
+		So(passed, ShouldBeTrue)
+		// Nothing is copied to the hosted repo
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/hosted", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+
+		So(rollbackBuild(indy.URL, promotetest.MODE_GROUP, resp, false), ShouldBeTrue)
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "maven", "tested-builds", metaFiles, metaFilesLoc+"/rollback", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+
+		CleanUp(indy.URL, "maven", buildName, false)
+		r := report.Current()
+		So(r.Summary.Failed, ShouldEqual, 0)
+		kinds := map[string]int{}
+		for _, res := range r.Results {
+			kinds[res.Kind]++
+		}
+		So(kinds[report.KIND_PROMOTION], ShouldEqual, 2) // the promotion and the membership check
+		So(kinds[report.KIND_ROLLBACK], ShouldEqual, 2)
+	})
+}
+
+func newNpmTarball(packageJSON string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "package/package.json", Mode: 0644, Size: int64(len(packageJSON))})
+	tw.Write([]byte(packageJSON))
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func readNpmPackageJSON(tarball []byte) string {
+	gr, _ := gzip.NewReader(bytes.NewReader(tarball))
+	tr := tar.NewReader(gr)
+	tr.Next()
+	b, _ := ioutil.ReadAll(tr)
+	return string(b)
+}
+
+// newOriginalNpmBuild is newOriginalBuild of an npm package, which uploads the tarball and the package document
+func newOriginalNpmBuild(indy *mockindy.Server) common.TrackedContent {
+	indy.Seed("npm:remote:npmjs", "/lodash/-/lodash-4.17.21.tgz", newNpmTarball(`{"name": "lodash", "version": "4.17.21"}`))
+	indy.Seed("npm:hosted:pnc-builds", "/@redhat/foo/-/foo-0.9.0-redhat-00001.tgz",
+		newNpmTarball(`{"name": "@redhat/foo", "version": "0.9.0-redhat-00001"}`))
+	indy.AddStore("npm:hosted:"+ORIGINAL_BUILD, nil)
+
+	trackURL := indy.URL + "/api/folo/track/" + ORIGINAL_BUILD
+	common.HTTPRequest(trackURL+"/npm/group/"+META_CHECK_REPO+"/lodash/-/lodash-4.17.21.tgz",
+		common.MethodGet, nil, false, nil, nil, "", false)
+	common.HTTPRequest(trackURL+"/npm/hosted/"+ORIGINAL_BUILD+"/@redhat/foo/-/foo-1.0.0-redhat-00001.tgz", common.MethodPut, nil, false,
+		bytes.NewReader(newNpmTarball(`{"name": "@redhat/foo", "version": "1.0.0-redhat-00001"}`)), nil, "", false)
+	common.HTTPRequest(trackURL+"/npm/hosted/"+ORIGINAL_BUILD+"/@redhat/foo", common.MethodPut, nil, false,
+		strings.NewReader(`{"name": "@redhat/foo", "versions": {"1.0.0-redhat-00001": {"version": "1.0.0-redhat-00001"}}}`), nil, "", false)
+	common.SealFoloRecord(indy.URL, ORIGINAL_BUILD)
+	return common.GetFoloRecord(indy.URL, ORIGINAL_BUILD)
+}
+
+func TestNpmIntegrationFlow(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+
+	mountPath, _ := ioutil.TempDir("", "indy-it")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalNpmBuild(indy)
+	buildName := common.GenerateRandomBuildName()
+	newVersionNum := buildName[len(common.BUILD_TEST_):]
+	metaFiles := CalculateMetadataFiles(foloTrackContent)
+	metaFilesLoc := mountPath + "/metadata"
+	report.Start("integrationtest", nil, "")
+
+	Convey("TestNpmIntegrationFlow", t, func() {
+		So(len(foloTrackContent.Uploads), ShouldEqual, 2)
+		So(metaFiles, ShouldResemble, []string{"/@redhat/foo/package.json"})
+
+		So(buildtest.DoRun(indy.URL, "", indy.URL, "npm", buildName, foloTrackContent, nil, 2, false, false, buildtest.UploadOptions{}, nil, 0), ShouldBeTrue)
+		So(VerifyFoloRecord(indy.URL, buildName, foloTrackContent), ShouldBeTrue)
+		tarball, ok := indy.Content("npm:hosted:"+buildName, "/@redhat/foo/-/foo-1.0.0-redhat-"+newVersionNum+".tgz")
+		So(ok, ShouldBeTrue)
+		So(readNpmPackageJSON(tarball), ShouldContainSubstring, `"version": "1.0.0-redhat-`+newVersionNum+`"`)
+		doc, ok := indy.Content("npm:hosted:"+buildName, "/@redhat/foo/package.json")
+		So(ok, ShouldBeTrue)
+		versions, _ := common.NpmMetadataVersions(doc)
+		So(versions, ShouldResemble, []string{"1.0.0-redhat-" + newVersionNum})
+
+		// The versions are altered on the way in stream mode too
+		streamed := common.GenerateRandomBuildName()
+		So(buildtest.DoRun(indy.URL, "", indy.URL, "npm", streamed, foloTrackContent, nil, 2, false, false,
+			buildtest.UploadOptions{Stream: true}, nil, 0), ShouldBeTrue)
+		tarball, ok = indy.Content("npm:hosted:"+streamed, "/@redhat/foo/-/foo-1.0.0-redhat-"+streamed[len(common.BUILD_TEST_):]+".tgz")
+		So(ok, ShouldBeTrue)
+		So(readNpmPackageJSON(tarball), ShouldContainSubstring, `"version": "1.0.0-redhat-`+streamed[len(common.BUILD_TEST_):]+`"`)
+		CleanUp(indy.URL, "npm", streamed, false)
+
+		passed, _ := RetrieveMetadataAndValidate(indy.URL, "npm", META_CHECK_REPO, metaFiles, metaFilesLoc+"/before", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+
+		sourceStore, targetStore := GetPromotionSrcTargetStores("npm", buildName, "", foloTrackContent)
+		So(targetStore, ShouldEqual, "npm:hosted:pnc-builds")
+		resp, _, success := promotetest.DoRun(indy.URL, buildName, sourceStore, targetStore, newVersionNum, foloTrackContent, false, promotetest.AsyncOptions{})
+		So(success, ShouldBeTrue)
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "npm", META_CHECK_REPO, metaFiles, metaFilesLoc+"/after", newVersionNum, true)
+		So(passed, ShouldBeTrue)
+
+		_, _, success = promotetest.Rollback(indy.URL, resp, false)
+		So(success, ShouldBeTrue)
+		passed, _ = RetrieveMetadataAndValidate(indy.URL, "npm", META_CHECK_REPO, metaFiles, metaFilesLoc+"/rollback", newVersionNum, false)
+		So(passed, ShouldBeTrue)
+
+		CleanUp(indy.URL, "npm", buildName, false)
+		So(indy.HasStore("npm:hosted:"+buildName), ShouldBeFalse)
+		So(indy.HasStore("npm:group:"+buildName), ShouldBeFalse)
+		So(report.Current().Summary.Failed, ShouldEqual, 0)
+	})
+}
+
+func TestPollMetadata(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	indy.SetEventDelay(300 * time.Millisecond)
+
+	mountPath, _ := ioutil.TempDir("", "indy-it")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	foloTrackContent := newOriginalBuild(indy)
+	buildName := common.GenerateRandomBuildName()
+	newVersionNum := buildName[len(common.BUILD_TEST_):]
+	metaFiles := CalculateMetadataFiles(foloTrackContent)
+	metaFilesLoc := mountPath + "/metadata"
+	report.Start("integrationtest", nil, "")
+	poll := PollOptions{Timeout: 5 * time.Second, Interval: 50 * time.Millisecond}
+
+	buildtest.DoRun(indy.URL, "", indy.URL, "maven", buildName, foloTrackContent, nil, 2, false, false, buildtest.UploadOptions{}, nil, 0)
+	sourceStore, targetStore := GetPromotionSrcTargetStores("maven", buildName, "", foloTrackContent)
+	resp, _, _ := promotetest.DoRun(indy.URL, buildName, sourceStore, targetStore, newVersionNum, foloTrackContent, false, promotetest.AsyncOptions{})
+	// Not propagated yet
+	notYet, _ := RetrieveMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/not-yet", newVersionNum, true)
+	afterPromote, _ := PollMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/after-promote", newVersionNum, true, poll)
+
+	promotetest.Rollback(indy.URL, resp, false)
+	timedOut, _ := PollMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/timed-out", newVersionNum, false,
+		PollOptions{Timeout: 100 * time.Millisecond, Interval: 50 * time.Millisecond})
+	afterRollback, _ := PollMetadataAndValidate(indy.URL, "maven", META_CHECK_REPO, metaFiles, metaFilesLoc+"/rollback", newVersionNum, false, poll)
+	r := report.Current()
+
+	Convey("TestPollMetadata", t, func() {
+		So(notYet, ShouldBeFalse)
+		So(afterPromote, ShouldBeTrue)
+		So(timedOut, ShouldBeFalse)
+		So(afterRollback, ShouldBeTrue)
+
+		So(len(r.Metrics), ShouldEqual, 2)
+		So(r.Metrics[0].Name, ShouldEqual, "metadata propagation (after-promote)")
+		So(r.Metrics[0].Value, ShouldBeGreaterThan, 200*time.Millisecond)
+		So(r.Metrics[0].Value, ShouldBeLessThan, 2*time.Second)
+		So(r.Metrics[1].Name, ShouldEqual, "metadata propagation (rollback)")
+		So(r.Metrics[1].Value, ShouldBeGreaterThan, 100*time.Millisecond)
+		for _, res := range r.Results {
+			if res.Name == metaFiles[0]+" (after-promote)" {
+				So(res.Status, ShouldEqual, report.STATUS_PASSED)
+				So(res.Duration, ShouldEqual, r.Metrics[0].Value)
+			}
+			if res.Name == metaFiles[0]+" (timed-out)" {
+				So(res.Status, ShouldEqual, report.STATUS_FAILED)
+			}
+		}
+	})
+}
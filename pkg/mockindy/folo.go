@@ -0,0 +1,131 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockindy
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	EFFECT_DOWNLOAD = "DOWNLOAD"
+	EFFECT_UPLOAD   = "UPLOAD"
+	CHANNEL_NATIVE  = "NATIVE"
+)
+
+type foloRecord struct {
+	id        string
+	sealed    bool
+	uploads   []common.TrackedContentEntry
+	downloads []common.TrackedContentEntry
+}
+
+func (rec *foloRecord) toTrackedContent() common.TrackedContent {
+	tracked := common.TrackedContent{TrackingKey: common.TrackingKey{Id: rec.id}}
+	tracked.Uploads = append([]common.TrackedContentEntry{}, rec.uploads...)
+	tracked.Downloads = append([]common.TrackedContentEntry{}, rec.downloads...)
+	return tracked
+}
+
+// Should be called with write lock held
+func (s *Server) getOrCreateRecord(id string) *foloRecord {
+	rec, ok := s.records[id]
+	if !ok {
+		rec = &foloRecord{id: id}
+		s.records[id] = rec
+	}
+	return rec
+}
+
+// track adds an entry to the folo record. Like indy, accessing the same path of the same store again only
+// appends a new timestamp to the existing entry.
+func (s *Server) track(id, effect, storeKey, aPath string, content []byte) {
+	entry := common.TrackedContentEntry{
+		AccessChannel: CHANNEL_NATIVE,
+		Path:          aPath,
+		LocalUrl:      fmt.Sprintf("%s/api/content/%s%s", s.URL, common.StoreKeyToPath(storeKey), aPath),
+		Effect:        effect,
+		Md5:           fmt.Sprintf("%x", md5.Sum(content)),
+		Sha1:          fmt.Sprintf("%x", sha1.Sum(content)),
+		Sha256:        fmt.Sprintf("%x", sha256.Sum256(content)),
+		Size:          int64(len(content)),
+		Timestamps:    []int64{time.Now().UnixNano() / int64(time.Millisecond)},
+		StoreKey:      storeKey,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.getOrCreateRecord(id)
+	entries := &rec.downloads
+	if effect == EFFECT_UPLOAD {
+		entries = &rec.uploads
+	}
+	for i, e := range *entries {
+		if e.StoreKey == storeKey && e.Path == aPath {
+			entry.Timestamps = append(e.Timestamps, entry.Timestamps...)
+			(*entries)[i] = entry
+			return
+		}
+	}
+	*entries = append(*entries, entry)
+}
+
+// handleFoloAdmin serves "{id}/record" (GET/POST/DELETE) and "{id}/report" (GET)
+func (s *Server) handleFoloAdmin(w http.ResponseWriter, r *http.Request, rest string) {
+	toks := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(toks) != 2 || (toks[1] != "record" && toks[1] != "report") {
+		http.NotFound(w, r)
+		return
+	}
+	id := toks[0]
+
+	switch {
+	case r.Method == http.MethodGet:
+		tracked, ok := s.FoloRecord(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := json.MarshalIndent(tracked, "", "  ")
+		writeJSON(w, http.StatusOK, b)
+	case r.Method == http.MethodPost && toks[1] == "record":
+		s.mu.Lock()
+		s.getOrCreateRecord(id).sealed = true
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete && toks[1] == "record":
+		s.mu.Lock()
+		_, ok := s.records[id]
+		delete(s.records, id)
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,370 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockindy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+type promoteRequest struct {
+	Source         string          `json:"source"`
+	Target         string          `json:"target"`
+	Paths          []string        `json:"paths"`
+	Async          bool            `json:"async"`
+	PurgeSource    bool            `json:"purgeSource"`
+	DryRun         bool            `json:"dryRun"`
+	FireEvents     bool            `json:"fireEvents"`
+	FailWhenExists bool            `json:"failWhenExists"`
+	PromotionId    string          `json:"promotionId,omitempty"`
+	Callback       *callbackTarget `json:"callback,omitempty"`
+}
+
+// callbackTarget is where the result of an async promotion is sent when it's done
+type callbackTarget struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// asyncPromotion is an accepted async promotion, the result of which is pending until done
+type asyncPromotion struct {
+	result promoteResult
+	done   bool
+}
+
+type promoteResult struct {
+	Request        promoteRequest    `json:"request"`
+	PendingPaths   []string          `json:"pendingPaths"`
+	CompletedPaths []string          `json:"completedPaths"`
+	SkippedPaths   []string          `json:"skippedPaths"`
+	Validations    *validationResult `json:"validations,omitempty"`
+	Error          string            `json:"error,omitempty"`
+}
+
+func (s *Server) handlePromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req promoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Async {
+		s.acceptPromotion(w, req)
+		return
+	}
+
+	s.mu.Lock()
+	result := s.promote(req)
+	s.mu.Unlock()
+
+	b, _ := json.MarshalIndent(result, "", "  ")
+	writeJSON(w, http.StatusOK, b)
+}
+
+// acceptPromotion returns 202 with all the paths pending, and does the promotion in the background after the
+// promote delay. The result is kept for the status query, and sent to the callback of the request if any.
+func (s *Server) acceptPromotion(w http.ResponseWriter, req promoteRequest) {
+	s.mu.Lock()
+	if req.PromotionId == "" {
+		s.promotionSeq++
+		req.PromotionId = fmt.Sprintf("promotion-%d", s.promotionSeq)
+	}
+	accepted := promoteResult{Request: req, PendingPaths: append([]string{}, req.Paths...), CompletedPaths: []string{}, SkippedPaths: []string{}}
+	s.promotions[req.PromotionId] = &asyncPromotion{result: accepted}
+	delay := s.promoteDelay
+	s.mu.Unlock()
+
+	go func() {
+		time.Sleep(delay)
+		s.mu.Lock()
+		result := s.promote(req)
+		s.promotions[req.PromotionId] = &asyncPromotion{result: result, done: true}
+		s.mu.Unlock()
+
+		if req.Callback != nil && req.Callback.URL != "" {
+			method := req.Callback.Method
+			if method == "" {
+				method = common.MethodPost
+			}
+			b, _ := json.Marshal(result)
+			cb, err := http.NewRequest(method, req.Callback.URL, bytes.NewReader(b))
+			if err != nil {
+				return
+			}
+			cb.Header.Set("Content-Type", common.ContentTypeJSON)
+			for k, v := range req.Callback.Headers {
+				cb.Header.Set(k, v)
+			}
+			if resp, err := http.DefaultClient.Do(cb); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	b, _ := json.MarshalIndent(accepted, "", "  ")
+	writeJSON(w, http.StatusAccepted, b)
+}
+
+// handlePromotionStatus returns the result of an async promotion, 202 if it's still pending
+func (s *Server) handlePromotionStatus(w http.ResponseWriter, r *http.Request, promotionId string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	promotion, ok := s.promotions[promotionId]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := http.StatusAccepted
+	if promotion.done {
+		status = http.StatusOK
+	}
+	b, _ := json.MarshalIndent(promotion.result, "", "  ")
+	writeJSON(w, status, b)
+}
+
+// promote copies the paths from source to target hosted store, after validating them against the rule set of the
+// target if any. Paths missing in the source, or existing in the target with the same content, are skipped. If
+// failWhenExists is set and any path exists in the target with different content, nothing is promoted. Should be
+// called with write lock held.
+func (s *Server) promote(req promoteRequest) promoteResult {
+	result := promoteResult{Request: req, PendingPaths: []string{}, CompletedPaths: []string{}, SkippedPaths: []string{}}
+
+	src, ok := s.stores[req.Source]
+	if !ok {
+		result.Error = fmt.Sprintf("No such source store: %s", req.Source)
+		return result
+	}
+	target, ok := s.stores[req.Target]
+	if !ok || target.storeType != TYPE_HOSTED {
+		result.Error = fmt.Sprintf("No such target hosted store: %s", req.Target)
+		return result
+	}
+
+	paths := req.Paths
+	if len(paths) == 0 {
+		for p := range src.content {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+	}
+
+	// Nothing is promoted if any rule of the rule set of the target is violated
+	if result.Validations = s.validate(src, target, paths); result.Validations != nil && !result.Validations.Valid {
+		for _, p := range paths {
+			result.PendingPaths = append(result.PendingPaths, normPath(p))
+		}
+		return result
+	}
+
+	var toPromote, conflicts []string
+	for _, p := range paths {
+		p = normPath(p)
+		content, ok := src.content[p]
+		if !ok {
+			result.SkippedPaths = append(result.SkippedPaths, p)
+			continue
+		}
+		if existing, ok := target.content[p]; ok {
+			if bytes.Equal(existing, content) {
+				result.SkippedPaths = append(result.SkippedPaths, p)
+				continue
+			}
+			if req.FailWhenExists {
+				conflicts = append(conflicts, p)
+				continue
+			}
+		}
+		toPromote = append(toPromote, p)
+	}
+
+	if len(conflicts) > 0 {
+		result.PendingPaths = append(result.PendingPaths, toPromote...)
+		result.PendingPaths = append(result.PendingPaths, conflicts...)
+		result.Error = fmt.Sprintf("Paths already exist in %s: %s", req.Target, strings.Join(conflicts, ", "))
+		return result
+	}
+
+	for _, p := range toPromote {
+		if !req.DryRun {
+			target.content[p] = src.content[p]
+			if req.PurgeSource {
+				delete(src.content, p)
+			}
+			if s.eventDelay > 0 {
+				target.hiddenUntil[p] = time.Now().Add(s.eventDelay)
+				delete(target.lingeringUntil, p)
+			}
+		}
+		result.CompletedPaths = append(result.CompletedPaths, p)
+	}
+	return result
+}
+
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var promoted promoteResult
+	if err := json.NewDecoder(r.Body).Decode(&promoted); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	result := s.rollback(promoted)
+	s.mu.Unlock()
+
+	b, _ := json.MarshalIndent(result, "", "  ")
+	writeJSON(w, http.StatusOK, b)
+}
+
+// rollback removes the completed paths of a previous promotion from the target store, and moves them back to
+// the source store if the source was purged. Should be called with write lock held.
+func (s *Server) rollback(promoted promoteResult) promoteResult {
+	req := promoted.Request
+	result := promoteResult{Request: req, PendingPaths: []string{}, CompletedPaths: []string{}, SkippedPaths: []string{}}
+
+	target, ok := s.stores[req.Target]
+	if !ok {
+		result.Error = fmt.Sprintf("No such target store: %s", req.Target)
+		return result
+	}
+	src := s.stores[req.Source]
+
+	for _, p := range promoted.CompletedPaths {
+		content, ok := target.content[p]
+		if !ok {
+			result.SkippedPaths = append(result.SkippedPaths, p)
+			continue
+		}
+		if req.PurgeSource && src != nil {
+			src.content[p] = content
+		}
+		delete(target.content, p)
+		if s.eventDelay > 0 {
+			target.lingeringUntil[p] = time.Now().Add(s.eventDelay)
+			delete(target.hiddenUntil, p)
+		}
+		result.PendingPaths = append(result.PendingPaths, p)
+	}
+	return result
+}
+
+type groupPromoteRequest struct {
+	Source      string `json:"source"`
+	TargetGroup string `json:"targetGroup"` // name of the group, with the same package type as the source
+	DryRun      bool   `json:"dryRun"`
+	FireEvents  bool   `json:"fireEvents"`
+}
+
+type groupPromoteResult struct {
+	Request groupPromoteRequest `json:"request"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// handleGroupPromote adds the source store to the constituents of the target group, or removes it for rollback,
+// the body of which is the result of the promotion
+func (s *Server) handleGroupPromote(w http.ResponseWriter, r *http.Request, rollback bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req groupPromoteRequest
+	if rollback {
+		var promoted groupPromoteResult
+		if err := json.NewDecoder(r.Body).Decode(&promoted); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req = promoted.Request
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	result := s.promoteToGroup(req, rollback)
+	s.mu.Unlock()
+
+	b, _ := json.MarshalIndent(result, "", "  ")
+	writeJSON(w, http.StatusOK, b)
+}
+
+// promoteToGroup appends the source to the constituents of the target group, which fails if it's already a member.
+// The rollback removes it, which fails if it's not a member. Should be called with write lock held.
+func (s *Server) promoteToGroup(req groupPromoteRequest, rollback bool) groupPromoteResult {
+	result := groupPromoteResult{Request: req}
+
+	src, ok := s.stores[req.Source]
+	if !ok {
+		result.Error = fmt.Sprintf("No such source store: %s", req.Source)
+		return result
+	}
+	groupKey := src.packageType + ":" + TYPE_GROUP + ":" + req.TargetGroup
+	group, ok := s.stores[groupKey]
+	if !ok || group.storeType != TYPE_GROUP {
+		result.Error = fmt.Sprintf("No such target group: %s", groupKey)
+		return result
+	}
+
+	index := -1
+	for i, c := range group.constituents {
+		if c == req.Source {
+			index = i
+		}
+	}
+	if !rollback && index >= 0 {
+		result.Error = fmt.Sprintf("%s is already a constituent of %s", req.Source, groupKey)
+		return result
+	}
+	if rollback && index < 0 {
+		result.Error = fmt.Sprintf("%s is not a constituent of %s", req.Source, groupKey)
+		return result
+	}
+	if req.DryRun {
+		return result
+	}
+
+	var constituents []string
+	if rollback {
+		constituents = append(constituents, group.constituents[:index]...)
+		constituents = append(constituents, group.constituents[index+1:]...)
+	} else {
+		constituents = append(append(constituents, group.constituents...), req.Source)
+	}
+	group.constituents = constituents
+	group.definition["constituents"] = constituents
+	return result
+}
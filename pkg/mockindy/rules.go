@@ -0,0 +1,124 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockindy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Rules of the promotion validation, named as the rule scripts of indy
+const (
+	RULE_CHECKSUMS       = "checksums-required.groovy"    // each artifact has its .md5 and .sha1 in the source
+	RULE_NO_SNAPSHOTS    = "no-snapshots-paths.groovy"    // no snapshot versions
+	RULE_POM_REQUIRED    = "pom-required.groovy"          // each version dir with artifacts has a pom
+	RULE_NO_PRE_EXISTING = "no-pre-existing-paths.groovy" // no path exists in the target
+)
+
+type ruleSet struct {
+	name  string
+	rules []string
+}
+
+type validationResult struct {
+	Valid           bool              `json:"valid"`
+	RuleSet         string            `json:"ruleSet"`
+	ValidatorErrors map[string]string `json:"validatorErrors"`
+}
+
+// SetRuleSet sets the rules validating the promotions to the target store, like the rule sets of indy matched by
+// the target store. No rules removes the rule set.
+func (s *Server) SetRuleSet(targetKey, name string, rules ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(rules) == 0 {
+		delete(s.ruleSets, targetKey)
+		return
+	}
+	s.ruleSets[targetKey] = &ruleSet{name: name, rules: rules}
+}
+
+// validate checks the paths to be promoted from src to target against the rule set of the target, which is nil if
+// there is no rule set. Should be called with lock held.
+func (s *Server) validate(src, target *store, paths []string) *validationResult {
+	rs, ok := s.ruleSets[target.key]
+	if !ok {
+		return nil
+	}
+	result := &validationResult{Valid: true, RuleSet: rs.name, ValidatorErrors: map[string]string{}}
+
+	var artifacts []string
+	for _, p := range paths {
+		if !isChecksum(p) {
+			artifacts = append(artifacts, normPath(p))
+		}
+	}
+	for _, rule := range rs.rules {
+		var violations []string
+		switch rule {
+		case RULE_CHECKSUMS:
+			for _, p := range artifacts {
+				for _, ext := range []string{".md5", ".sha1"} {
+					if _, ok := src.content[p+ext]; !ok {
+						violations = append(violations, p+ext)
+					}
+				}
+			}
+		case RULE_NO_SNAPSHOTS:
+			for _, p := range artifacts {
+				if strings.Contains(p, "-SNAPSHOT") {
+					violations = append(violations, p)
+				}
+			}
+		case RULE_POM_REQUIRED:
+			dirs := map[string]bool{}
+			for p := range src.content {
+				if strings.HasSuffix(p, ".pom") {
+					dirs[path.Dir(p)] = true
+				}
+			}
+			for _, p := range artifacts {
+				if !strings.HasSuffix(p, ".pom") && !isMetadata(src.packageType, p) && !dirs[path.Dir(p)] {
+					violations = append(violations, p)
+				}
+			}
+		case RULE_NO_PRE_EXISTING:
+			for _, p := range artifacts {
+				if _, ok := target.content[p]; ok {
+					violations = append(violations, p)
+				}
+			}
+		}
+		if len(violations) > 0 {
+			sort.Strings(violations)
+			result.Valid = false
+			result.ValidatorErrors[rule] = fmt.Sprintf("Invalid paths: %s", strings.Join(violations, ", "))
+		}
+	}
+	return result
+}
+
+func isChecksum(aPath string) bool {
+	for _, ext := range []string{".md5", ".sha1", ".sha256"} {
+		if strings.HasSuffix(aPath, ext) {
+			return true
+		}
+	}
+	return false
+}
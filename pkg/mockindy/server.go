@@ -0,0 +1,219 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockindy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	API_ADMIN_STORES = "/api/admin/stores/"
+	API_CONTENT      = "/api/content/"
+	API_FOLO_TRACK   = "/api/folo/track/"
+	API_FOLO_ADMIN   = "/api/folo/admin/"
+	API_PROMOTE      = "/api/promotion/paths/promote"
+	API_ROLLBACK     = "/api/promotion/paths/rollback"
+
+	API_GROUP_PROMOTE  = "/api/promotion/groups/promote"
+	API_GROUP_ROLLBACK = "/api/promotion/groups/rollback"
+)
+
+/*
+ * Server is an in-process stand-in of Indy. It serves the REST endpoints used by this tool:
+ *
+ * - /api/admin/stores/{pkg}/{hosted|group|remote}/{name} (GET/HEAD/PUT/POST/DELETE)
+ * - /api/content/{pkg}/{type}/{name}/{path} (GET/HEAD/PUT/DELETE)
+ * - /api/folo/track/{id}/{pkg}/{type}/{name}/{path} (same as content, plus tracking)
+ * - /api/folo/admin/{id}/record (GET/POST/DELETE) and /api/folo/admin/{id}/report (GET)
+ * - /api/promotion/paths/promote and /api/promotion/paths/rollback (POST)
+ * - /api/promotion/paths/promote/{promotionId} (GET), the result of an async promotion, 202 while pending
+ * - /api/promotion/groups/promote and /api/promotion/groups/rollback (POST)
+ *
+ * All the stores and content are kept in memory. Groups are resolved through their constituents in order,
+ * and maven-metadata.xml files are generated from the stored version directories when not uploaded explicitly.
+ */
+type Server struct {
+	*httptest.Server
+
+	mu         sync.RWMutex
+	stores     map[string]*store
+	records    map[string]*foloRecord
+	eventDelay time.Duration
+
+	promotions   map[string]*asyncPromotion
+	promotionSeq int
+	promoteDelay time.Duration
+	ruleSets     map[string]*ruleSet // by target store key
+}
+
+// NewServer creates and starts a mock Indy server with the default stores, i.e, maven:remote:central,
+// npm:remote:npmjs, maven:hosted:shared-imports, maven:hosted:pnc-builds and the shared build group.
+// Call Close() when done.
+func NewServer() *Server {
+	s := &Server{
+		stores:     make(map[string]*store),
+		records:    make(map[string]*foloRecord),
+		promotions: make(map[string]*asyncPromotion),
+		ruleSets:   make(map[string]*ruleSet),
+	}
+	s.addDefaultStores()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) addDefaultStores() {
+	s.AddStore("maven:remote:central", nil)
+	s.AddStore("npm:remote:npmjs", nil)
+	s.AddStore("maven:hosted:shared-imports", nil)
+	s.AddStore("maven:hosted:pnc-builds", nil)
+	s.AddStore("npm:hosted:shared-imports", nil)
+	s.AddStore("npm:hosted:pnc-builds", nil)
+	s.AddStore("maven:group:builds-untested+shared-imports+public",
+		[]string{"maven:hosted:pnc-builds", "maven:hosted:shared-imports", "maven:remote:central"})
+	s.AddStore("npm:group:builds-untested+shared-imports+public",
+		[]string{"npm:hosted:pnc-builds", "npm:hosted:shared-imports", "npm:remote:npmjs"})
+}
+
+// AddStore creates (or replaces) a store by its key, e.g, "maven:hosted:build-1". The constituents are only
+// used by group stores.
+func (s *Server) AddStore(storeKey string, constituents []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putStore(newStore(storeKey, constituents, nil))
+}
+
+// SetEventDelay simulates the delay of indy handling the promotion events: the promoted paths appear in, and
+// the rolled back paths disappear from, the metadata only after the delay
+func (s *Server) SetEventDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eventDelay = d
+}
+
+// SetPromoteDelay simulates the time an async promotion waits in the queue of indy before it's done
+func (s *Server) SetPromoteDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.promoteDelay = d
+}
+
+// HasStore tells if the store exists
+func (s *Server) HasStore(storeKey string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.stores[storeKey]
+	return ok
+}
+
+// Seed stores the content to a store without tracking. The store is created if it does not exist yet.
+func (s *Server) Seed(storeKey, aPath string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.stores[storeKey]
+	if !ok {
+		st = newStore(storeKey, nil, nil)
+		s.putStore(st)
+	}
+	st.content[normPath(aPath)] = content
+}
+
+// Content gets the content stored directly in a store (no group resolution).
+func (s *Server) Content(storeKey, aPath string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.stores[storeKey]
+	if !ok {
+		return nil, false
+	}
+	b, ok := st.content[normPath(aPath)]
+	return b, ok
+}
+
+// AddFoloRecord registers a tracking record, e.g, the record of an original build to be replayed.
+func (s *Server) AddFoloRecord(record common.TrackedContent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.getOrCreateRecord(record.TrackingKey.Id)
+	rec.uploads = append(rec.uploads, record.Uploads...)
+	rec.downloads = append(rec.downloads, record.Downloads...)
+}
+
+// FoloRecord returns the tracking record by id and whether it exists
+func (s *Server) FoloRecord(id string) (common.TrackedContent, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return common.TrackedContent{}, false
+	}
+	return rec.toTrackedContent(), true
+}
+
+// IsSealed tells if the tracking record is sealed
+func (s *Server) IsSealed(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[id]
+	return ok && rec.sealed
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, API_ADMIN_STORES):
+		s.handleStores(w, r, strings.TrimPrefix(p, API_ADMIN_STORES))
+	case strings.HasPrefix(p, API_CONTENT):
+		s.handleContent(w, r, "", strings.TrimPrefix(p, API_CONTENT))
+	case strings.HasPrefix(p, API_FOLO_TRACK):
+		toks := strings.SplitN(strings.TrimPrefix(p, API_FOLO_TRACK), "/", 2)
+		if len(toks) < 2 {
+			http.NotFound(w, r)
+			return
+		}
+		s.handleContent(w, r, toks[0], toks[1])
+	case strings.HasPrefix(p, API_FOLO_ADMIN):
+		s.handleFoloAdmin(w, r, strings.TrimPrefix(p, API_FOLO_ADMIN))
+	case p == API_PROMOTE:
+		s.handlePromote(w, r)
+	case strings.HasPrefix(p, API_PROMOTE+"/"):
+		s.handlePromotionStatus(w, r, strings.TrimPrefix(p, API_PROMOTE+"/"))
+	case p == API_ROLLBACK:
+		s.handleRollback(w, r)
+	case p == API_GROUP_PROMOTE:
+		s.handleGroupPromote(w, r, false)
+	case p == API_GROUP_ROLLBACK:
+		s.handleGroupPromote(w, r, true)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", common.ContentTypeJSON)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func normPath(aPath string) string {
+	return "/" + strings.TrimLeft(aPath, "/")
+}
@@ -0,0 +1,223 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockindy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStores(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	Convey("TestStores", t, func() {
+		Convey("Default stores should exist so that the server passes indy validation", func() {
+			_, validated := common.ValidateTargetIndy(s.URL)
+			So(validated, ShouldBeTrue)
+		})
+		Convey("Stores can be created and deleted", func() {
+			URL := s.URL + "/api/admin/stores/maven/hosted/build-1"
+			So(putContent(URL, `{"key": "maven:hosted:build-1", "type": "hosted"}`), ShouldBeTrue)
+			So(s.HasStore("maven:hosted:build-1"), ShouldBeTrue)
+			_, code, _ := common.HTTPRequest(URL, common.MethodGet, nil, true, nil, nil, "", false)
+			So(code, ShouldEqual, common.StatusOK)
+			_, _, deleted := common.HTTPRequest(URL, common.MethodDelete, nil, false, nil, nil, "", false)
+			So(deleted, ShouldBeTrue)
+			So(s.HasStore("maven:hosted:build-1"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestGroupResolution(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Seed("maven:hosted:a", "/org/foo/bar/1.0/bar-1.0.pom", []byte("a"))
+	s.Seed("maven:hosted:b", "/org/foo/bar/1.0/bar-1.0.pom", []byte("b"))
+	s.Seed("maven:hosted:b", "/org/foo/bar/2.0/bar-2.0.pom", []byte("b"))
+	s.AddStore("maven:group:g", []string{"maven:hosted:a", "maven:hosted:b"})
+
+	Convey("TestGroupResolution", t, func() {
+		Convey("The first constituent containing the path wins", func() {
+			content, _, _ := common.HTTPRequest(s.URL+"/api/content/maven/group/g/org/foo/bar/1.0/bar-1.0.pom",
+				common.MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldEqual, "a")
+		})
+		Convey("Metadata is merged from all constituents", func() {
+			content, _, _ := common.HTTPRequest(s.URL+"/api/content/maven/group/g/org/foo/bar/maven-metadata.xml",
+				common.MethodGet, nil, true, nil, nil, "", false)
+			So(content, ShouldContainSubstring, "<version>1.0</version>")
+			So(content, ShouldContainSubstring, "<version>2.0</version>")
+			So(content, ShouldContainSubstring, "<groupId>org.foo</groupId>")
+		})
+		Convey("Missing path should be 404", func() {
+			_, code, _ := common.HTTPRequest(s.URL+"/api/content/maven/group/g/org/foo/bar/3.0/bar-3.0.pom",
+				common.MethodGet, nil, true, nil, nil, "", false)
+			So(code, ShouldEqual, common.StatusNotFound)
+		})
+	})
+}
+
+func TestFoloTracking(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Seed("maven:remote:central", "/org/dep/dep/1.0/dep-1.0.jar", []byte("dep"))
+	s.AddStore("maven:hosted:build-1", nil)
+
+	downURL := s.URL + "/api/folo/track/build-1/maven/group/builds-untested+shared-imports+public/org/dep/dep/1.0/dep-1.0.jar"
+	common.HTTPRequest(downURL, common.MethodGet, nil, true, nil, nil, "", false)
+	common.HTTPRequest(downURL, common.MethodGet, nil, true, nil, nil, "", false)
+	putContent(s.URL+"/api/folo/track/build-1/maven/hosted/build-1/org/foo/bar/1.0/bar-1.0.jar", "bar")
+	record := common.GetFoloRecord(s.URL, "build-1")
+
+	Convey("TestFoloTracking", t, func() {
+		Convey("Downloads are recorded with the store where the content was found", func() {
+			So(len(record.Downloads), ShouldEqual, 1)
+			So(record.Downloads[0].StoreKey, ShouldEqual, "maven:remote:central")
+			So(len(record.Downloads[0].Timestamps), ShouldEqual, 2)
+			So(record.Downloads[0].Md5, ShouldEqual, "2254342becceafbd04538e0a38696791")
+		})
+		Convey("Uploads are recorded with checksums", func() {
+			So(len(record.Uploads), ShouldEqual, 1)
+			So(record.Uploads[0].Path, ShouldEqual, "/org/foo/bar/1.0/bar-1.0.jar")
+			So(record.Uploads[0].Md5, ShouldEqual, "37b51d194a7513e45b56f6524f2d51f2")
+			So(record.Uploads[0].Size, ShouldEqual, 3)
+		})
+		Convey("Record can be sealed and deleted", func() {
+			So(common.SealFoloRecord(s.URL, "build-1"), ShouldBeTrue)
+			So(s.IsSealed("build-1"), ShouldBeTrue)
+			So(common.DeleteFoloRecord(s.URL, "build-1"), ShouldBeTrue)
+			_, exists := s.FoloRecord("build-1")
+			So(exists, ShouldBeFalse)
+		})
+	})
+}
+
+func TestPromotion(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Seed("maven:hosted:build-1", "/org/foo/bar/1.0/bar-1.0.pom", []byte("pom"))
+	s.Seed("maven:hosted:build-1", "/org/foo/bar/1.0/bar-1.0.jar", []byte("jar"))
+
+	req := `{"source": "maven:hosted:build-1", "target": "maven:hosted:pnc-builds", "failWhenExists": true,
+		"paths": ["/org/foo/bar/1.0/bar-1.0.pom", "/org/foo/bar/1.0/bar-1.0.jar"]}`
+	result, _, ok := common.HTTPRequest(s.URL+API_PROMOTE, common.MethodPost, nil, true, strings.NewReader(req), nil, "", false)
+
+	Convey("TestPromotion", t, func() {
+		Convey("Paths are promoted to the target", func() {
+			So(ok, ShouldBeTrue)
+			_, promoted := s.Content("maven:hosted:pnc-builds", "/org/foo/bar/1.0/bar-1.0.jar")
+			So(promoted, ShouldBeTrue)
+		})
+
+		Convey("Promoting changed content again should fail when exists", func() {
+			s.Seed("maven:hosted:build-1", "/org/foo/bar/1.0/bar-1.0.jar", []byte("changed"))
+			again, _, _ := common.HTTPRequest(s.URL+API_PROMOTE, common.MethodPost, nil, true, strings.NewReader(req), nil, "", false)
+			So(again, ShouldContainSubstring, "already exist")
+		})
+		Convey("Rollback removes the promoted paths", func() {
+			_, _, ok := common.HTTPRequest(s.URL+API_ROLLBACK, common.MethodPost, nil, true, strings.NewReader(result), nil, "", false)
+			So(ok, ShouldBeTrue)
+			_, promoted := s.Content("maven:hosted:pnc-builds", "/org/foo/bar/1.0/bar-1.0.jar")
+			So(promoted, ShouldBeFalse)
+		})
+	})
+}
+
+func TestAsyncPromotion(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetPromoteDelay(200 * time.Millisecond)
+	s.Seed("maven:hosted:build-1", "/org/foo/bar/1.0/bar-1.0.jar", []byte("jar"))
+
+	req := `{"source": "maven:hosted:build-1", "target": "maven:hosted:pnc-builds", "async": true, "promotionId": "p-1",
+		"paths": ["/org/foo/bar/1.0/bar-1.0.jar"]}`
+	accepted, code, ok := common.HTTPRequest(s.URL+API_PROMOTE, common.MethodPost, nil, true, strings.NewReader(req), nil, "", false)
+
+	Convey("TestAsyncPromotion", t, func() {
+		Convey("Promotion is accepted with the paths pending", func() {
+			So(ok, ShouldBeTrue)
+			So(code, ShouldEqual, http.StatusAccepted)
+			So(accepted, ShouldContainSubstring, `"pendingPaths": [
+    "/org/foo/bar/1.0/bar-1.0.jar"`)
+			_, code, _ = common.HTTPRequest(s.URL+API_PROMOTE+"/p-1", common.MethodGet, nil, true, nil, nil, "", false)
+			So(code, ShouldEqual, http.StatusAccepted)
+			_, promoted := s.Content("maven:hosted:pnc-builds", "/org/foo/bar/1.0/bar-1.0.jar")
+			So(promoted, ShouldBeFalse)
+		})
+
+		Convey("Result is available when done", func() {
+			time.Sleep(400 * time.Millisecond)
+			result, code, _ := common.HTTPRequest(s.URL+API_PROMOTE+"/p-1", common.MethodGet, nil, true, nil, nil, "", false)
+			So(code, ShouldEqual, http.StatusOK)
+			So(result, ShouldContainSubstring, `"completedPaths": [
+    "/org/foo/bar/1.0/bar-1.0.jar"`)
+			_, promoted := s.Content("maven:hosted:pnc-builds", "/org/foo/bar/1.0/bar-1.0.jar")
+			So(promoted, ShouldBeTrue)
+		})
+
+		Convey("Unknown promotion should be 404", func() {
+			_, code, _ := common.HTTPRequest(s.URL+API_PROMOTE+"/p-2", common.MethodGet, nil, true, nil, nil, "", false)
+			So(code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
+
+func TestGroupPromotion(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddStore("maven:hosted:build-1", nil)
+	s.AddStore("maven:group:builds", []string{"maven:hosted:pnc-builds"})
+	groupURL := s.URL + API_ADMIN_STORES + "maven/group/builds"
+
+	req := `{"source": "maven:hosted:build-1", "targetGroup": "builds"}`
+	result, _, ok := common.HTTPRequest(s.URL+API_GROUP_PROMOTE, common.MethodPost, nil, true, strings.NewReader(req), nil, "", false)
+
+	Convey("TestGroupPromotion", t, func() {
+		Convey("Source is added to the constituents of the group", func() {
+			So(ok, ShouldBeTrue)
+			So(result, ShouldNotContainSubstring, "error")
+			group, _, _ := common.HTTPRequest(groupURL, common.MethodGet, nil, true, nil, nil, "", false)
+			So(group, ShouldContainSubstring, `"maven:hosted:pnc-builds",
+    "maven:hosted:build-1"`)
+		})
+
+		Convey("Promoting a member again should fail", func() {
+			again, _, _ := common.HTTPRequest(s.URL+API_GROUP_PROMOTE, common.MethodPost, nil, true, strings.NewReader(req), nil, "", false)
+			So(again, ShouldContainSubstring, "already a constituent")
+		})
+
+		Convey("Rollback removes the source from the group", func() {
+			_, _, ok := common.HTTPRequest(s.URL+API_GROUP_ROLLBACK, common.MethodPost, nil, true, strings.NewReader(result), nil, "", false)
+			So(ok, ShouldBeTrue)
+			group, _, _ := common.HTTPRequest(groupURL, common.MethodGet, nil, true, nil, nil, "", false)
+			So(group, ShouldNotContainSubstring, "build-1")
+			again, _, _ := common.HTTPRequest(s.URL+API_GROUP_ROLLBACK, common.MethodPost, nil, true, strings.NewReader(result), nil, "", false)
+			So(again, ShouldContainSubstring, "not a constituent")
+		})
+	})
+}
+
+func putContent(url, content string) bool {
+	_, _, succeeded := common.HTTPRequest(url, common.MethodPut, nil, false, strings.NewReader(content), nil, "", false)
+	return succeeded
+}
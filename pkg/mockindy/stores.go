@@ -0,0 +1,443 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockindy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	TYPE_HOSTED = "hosted"
+	TYPE_GROUP  = "group"
+	TYPE_REMOTE = "remote"
+)
+
+type store struct {
+	key          string
+	packageType  string
+	storeType    string
+	name         string
+	constituents []string
+	definition   map[string]interface{}
+	content      map[string][]byte
+	// Simulates the event handling delay of indy: the paths of a promotion are not in the metadata until the time,
+	// and the paths of a rollback are still in the metadata until the time
+	hiddenUntil    map[string]time.Time
+	lingeringUntil map[string]time.Time
+}
+
+func newStore(storeKey string, constituents []string, definition map[string]interface{}) *store {
+	toks := strings.SplitN(storeKey, ":", 3)
+	st := &store{
+		key:            storeKey,
+		packageType:    toks[0],
+		storeType:      toks[1],
+		name:           toks[2],
+		constituents:   constituents,
+		definition:     definition,
+		content:        make(map[string][]byte),
+		hiddenUntil:    make(map[string]time.Time),
+		lingeringUntil: make(map[string]time.Time),
+	}
+	if st.definition == nil {
+		st.definition = make(map[string]interface{})
+	}
+	st.definition["key"] = storeKey
+	st.definition["packageType"] = st.packageType
+	st.definition["type"] = st.storeType
+	st.definition["name"] = st.name
+	if st.storeType == TYPE_GROUP {
+		st.definition["constituents"] = st.constituents
+	}
+	return st
+}
+
+// Should be called with write lock held
+func (s *Server) putStore(st *store) {
+	if old, ok := s.stores[st.key]; ok {
+		st.content = old.content
+		st.hiddenUntil, st.lingeringUntil = old.hiddenUntil, old.lingeringUntil
+	}
+	s.stores[st.key] = st
+}
+
+func (s *Server) handleStores(w http.ResponseWriter, r *http.Request, rest string) {
+	toks := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(toks) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	storeKey := strings.Join(toks, ":")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.mu.RLock()
+		st, ok := s.stores[storeKey]
+		var b []byte
+		if ok {
+			b, _ = json.MarshalIndent(st.definition, "", "  ")
+		}
+		s.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+	case http.MethodPut, http.MethodPost:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var definition map[string]interface{}
+		if err := json.Unmarshal(body, &definition); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var constituents []string
+		if cons, ok := definition["constituents"].([]interface{}); ok {
+			for _, c := range cons {
+				constituents = append(constituents, fmt.Sprint(c))
+			}
+		}
+		s.mu.Lock()
+		_, existed := s.stores[storeKey]
+		s.putStore(newStore(storeKey, constituents, definition))
+		s.mu.Unlock()
+		if existed {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodDelete:
+		s.mu.Lock()
+		_, ok := s.stores[storeKey]
+		delete(s.stores, storeKey)
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleContent serves "{pkg}/{type}/{name}/{path}". If trackingId is not empty, the access is recorded to that folo record.
+func (s *Server) handleContent(w http.ResponseWriter, r *http.Request, trackingId, rest string) {
+	toks := strings.SplitN(strings.TrimLeft(rest, "/"), "/", 4)
+	if len(toks) < 4 || toks[3] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	storeKey := strings.Join(toks[:3], ":")
+	aPath := normPath(toks[3])
+	if toks[0] == common.PACKAGE_TYPE_NPM && common.IsNpmMetadata(aPath) {
+		// Like indy, the package document of "/foo" is stored as "/foo/package.json"
+		aPath = common.NpmMetadataPath(common.NpmPackageName(aPath))
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.mu.RLock()
+		content, foundIn, ok := s.resolve(storeKey, aPath, map[string]bool{})
+		if !ok {
+			content, foundIn, ok = s.resolveChecksum(storeKey, aPath)
+		}
+		s.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Like indy, folo does not track the metadata retrieved through a group
+		if trackingId != "" && r.Method == http.MethodGet && !(toks[1] == TYPE_GROUP && isMetadata(toks[0], aPath)) {
+			s.track(trackingId, EFFECT_DOWNLOAD, foundIn, aPath, content)
+		}
+		w.Header().Set("Content-Type", contentType(aPath))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		st, ok := s.stores[storeKey]
+		if ok && st.storeType == TYPE_HOSTED {
+			st.content[aPath] = body
+		}
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if st.storeType != TYPE_HOSTED {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if trackingId != "" {
+			s.track(trackingId, EFFECT_UPLOAD, storeKey, aPath, body)
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		s.mu.Lock()
+		st, ok := s.stores[storeKey]
+		if ok {
+			_, ok = st.content[aPath]
+			delete(st.content, aPath)
+		}
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// resolve finds the content in the store, or in the constituents for groups. It returns the content, the store key
+// where it was found, and whether it was found. Should be called with read lock held.
+func (s *Server) resolve(storeKey, aPath string, visited map[string]bool) ([]byte, string, bool) {
+	if visited[storeKey] {
+		return nil, "", false
+	}
+	visited[storeKey] = true
+
+	st, ok := s.stores[storeKey]
+	if !ok {
+		return nil, "", false
+	}
+
+	if st.storeType == TYPE_GROUP {
+		if isMetadata(st.packageType, aPath) {
+			versions := s.versions(storeKey, aPath, map[string]bool{})
+			if len(versions) == 0 {
+				return nil, "", false
+			}
+			return generateMetadata(st.packageType, aPath, versions), storeKey, true
+		}
+		for _, c := range st.constituents {
+			if content, foundIn, ok := s.resolve(c, aPath, visited); ok {
+				return content, foundIn, true
+			}
+		}
+		return nil, "", false
+	}
+
+	if content, ok := st.content[aPath]; ok {
+		return content, storeKey, true
+	}
+	if isMetadata(st.packageType, aPath) {
+		versions := s.versions(storeKey, aPath, map[string]bool{})
+		if len(versions) > 0 {
+			return generateMetadata(st.packageType, aPath, versions), storeKey, true
+		}
+	}
+	return nil, "", false
+}
+
+// resolveChecksum generates the sidecar checksum file like indy, e.g, "/foo.jar.sha1" of "/foo.jar". Should be
+// called with read lock held.
+func (s *Server) resolveChecksum(storeKey, aPath string) ([]byte, string, bool) {
+	ext := path.Ext(aPath)
+	if ext != common.EXT_MD5 && ext != common.EXT_SHA1 && ext != common.EXT_SHA256 {
+		return nil, "", false
+	}
+	content, foundIn, ok := s.resolve(storeKey, strings.TrimSuffix(aPath, ext), map[string]bool{})
+	if !ok {
+		return nil, "", false
+	}
+	w := common.NewDigestWriter()
+	w.Write(content)
+	return []byte(w.Digests().Checksum(ext)), foundIn, true
+}
+
+// isMetadata checks if the path is the metadata generated from the versions, i.e, maven-metadata.xml for maven, and
+// the package.json of a package for npm
+func isMetadata(packageType, aPath string) bool {
+	if packageType == common.PACKAGE_TYPE_NPM {
+		return strings.HasSuffix(aPath, "/"+common.NPM_PACKAGE_JSON) && common.IsNpmMetadata(aPath)
+	}
+	return common.IsMetadata(aPath)
+}
+
+// versions collects the versions for a metadata path, both from the stored metadata and from the version
+// directories of the maven artifact, or the tarballs of the npm package. Group versions are merged from all
+// constituents.
+func (s *Server) versions(storeKey, metaPath string, visited map[string]bool) []string {
+	if visited[storeKey] {
+		return nil
+	}
+	visited[storeKey] = true
+
+	st, ok := s.stores[storeKey]
+	if !ok {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	if st.storeType == TYPE_GROUP {
+		for _, c := range st.constituents {
+			for _, v := range s.versions(c, metaPath, visited) {
+				found[v] = true
+			}
+		}
+	} else {
+		if content, ok := st.content[metaPath]; ok {
+			for _, v := range parseMetadataVersions(st.packageType, content) {
+				found[v] = true
+			}
+		}
+		now := time.Now()
+		addVersion := func(p string) {
+			if v, ok := versionOf(st.packageType, metaPath, p); ok {
+				found[v] = true
+			}
+		}
+		for p := range st.content {
+			if now.Before(st.hiddenUntil[p]) {
+				continue
+			}
+			addVersion(p)
+		}
+		for p, until := range st.lingeringUntil {
+			if now.Before(until) {
+				addVersion(p)
+			}
+		}
+	}
+
+	var versions []string
+	for v := range found {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+type metadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupId    string   `xml:"groupId"`
+	ArtifactId string   `xml:"artifactId"`
+	Versioning struct {
+		Latest   string   `xml:"latest"`
+		Release  string   `xml:"release"`
+		Versions []string `xml:"versions>version"`
+	} `xml:"versioning"`
+}
+
+// versionOf returns the version of the path if it belongs to the metadata, e.g, "1.0" of "/org/foo/bar/1.0/bar-1.0.jar"
+// for "/org/foo/bar/maven-metadata.xml", or of "/foo/-/foo-1.0.tgz" for "/foo/package.json"
+func versionOf(packageType, metaPath, aPath string) (string, bool) {
+	if packageType == common.PACKAGE_TYPE_NPM {
+		packageDir := path.Dir(metaPath)
+		tarball := strings.TrimPrefix(aPath, packageDir+"/-/")
+		prefix := path.Base(packageDir) + "-"
+		if tarball == aPath || !strings.HasPrefix(tarball, prefix) || !strings.HasSuffix(tarball, ".tgz") {
+			return "", false
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(tarball, prefix), ".tgz"), true
+	}
+
+	artifactDir := path.Dir(metaPath)
+	artifactId := path.Base(artifactDir)
+	if !strings.HasPrefix(aPath, artifactDir+"/") {
+		return "", false
+	}
+	toks := strings.Split(strings.TrimPrefix(aPath, artifactDir+"/"), "/")
+	if len(toks) == 2 && strings.HasPrefix(toks[1], artifactId+"-"+toks[0]) {
+		return toks[0], true
+	}
+	return "", false
+}
+
+func parseMetadataVersions(packageType string, content []byte) []string {
+	if packageType == common.PACKAGE_TYPE_NPM {
+		versions, _ := common.NpmMetadataVersions(content)
+		return versions
+	}
+	var meta metadata
+	if err := xml.Unmarshal(content, &meta); err != nil {
+		return nil
+	}
+	return meta.Versioning.Versions
+}
+
+func generateMetadata(packageType, metaPath string, versions []string) []byte {
+	if packageType == common.PACKAGE_TYPE_NPM {
+		return generateNpmMetadata(metaPath, versions)
+	}
+	artifactDir := path.Dir(metaPath)
+	var meta metadata
+	meta.GroupId = strings.ReplaceAll(strings.Trim(path.Dir(artifactDir), "/"), "/", ".")
+	meta.ArtifactId = path.Base(artifactDir)
+	meta.Versioning.Versions = versions
+	meta.Versioning.Latest = versions[len(versions)-1]
+	meta.Versioning.Release = versions[len(versions)-1]
+	b, _ := xml.MarshalIndent(meta, "", "  ")
+	return append([]byte(xml.Header), b...)
+}
+
+// generateNpmMetadata generates a package document with the versions, which is a subset of the one of indy
+func generateNpmMetadata(metaPath string, versions []string) []byte {
+	name := strings.Trim(path.Dir(metaPath), "/")
+	all := make(map[string]interface{})
+	for _, v := range versions {
+		all[v] = map[string]interface{}{
+			"name":    name,
+			"version": v,
+			"dist":    map[string]string{"tarball": fmt.Sprintf("/%s/-/%s-%s.tgz", name, path.Base(name), v)},
+		}
+	}
+	doc := map[string]interface{}{
+		"name":      name,
+		"dist-tags": map[string]string{"latest": versions[len(versions)-1]},
+		"versions":  all,
+	}
+	b, _ := json.MarshalIndent(doc, "", "  ")
+	return b
+}
+
+func contentType(aPath string) string {
+	switch {
+	case strings.HasSuffix(aPath, ".xml"), strings.HasSuffix(aPath, ".pom"):
+		return common.ContentTypeXML
+	case strings.HasSuffix(aPath, ".json"):
+		return common.ContentTypeJSON
+	case strings.HasSuffix(aPath, ".md5"), strings.HasSuffix(aPath, ".sha1"), strings.HasSuffix(aPath, ".sha256"):
+		return common.ContentTypePlain
+	}
+	return common.ContentTypeStream
+}
@@ -0,0 +1,98 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package mockpnc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	PNC_REST_V2      = "/pnc-rest/v2/"
+	FOLO_ADMIN       = "/api/folo/admin/"
+	FOLO_FIXTURE_DIR = "folo"
+)
+
+/**
+ * Handler serves the PNC (and folo report) fixtures from a data directory. The request paths are mapped as below.
+ *
+ * /pnc-rest/v2/group-builds/2836                   => <dataDir>/group-builds/2836.json
+ * /pnc-rest/v2/group-builds/2836/dependency-graph  => <dataDir>/group-builds/2836/dependency-graph.json
+ * /pnc-rest/v2/builds/AMJMVSDA5EAAE                => <dataDir>/builds/AMJMVSDA5EAAE.json
+ * /pnc-rest/v2/builds/AMJMVSDA5EAAE/logs/align     => <dataDir>/builds/AMJMVSDA5EAAE/logs/align.log
+ * /api/folo/admin/build-AMJMVSDA5EAAE/report       => <dataDir>/folo/build-AMJMVSDA5EAAE.json
+ *
+ * So the same directory can be used as both pncBaseUrl and indyBaseUrl of the dataset command.
+ */
+func Handler(dataDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fixture := fixturePath(r.URL.Path)
+		if fixture == "" {
+			http.NotFound(w, r)
+			return
+		}
+		for _, ext := range []string{".json", ".log"} {
+			fileLoc := filepath.Join(dataDir, filepath.FromSlash(fixture+ext))
+			if !common.FileOrDirExists(fileLoc) {
+				continue
+			}
+			if ext == ".json" {
+				w.Header().Set("Content-Type", common.ContentTypeJSON)
+			} else {
+				w.Header().Set("Content-Type", common.ContentTypePlain)
+			}
+			fmt.Printf("Serve %s with %s\n", r.URL.Path, fileLoc)
+			http.ServeFile(w, r, fileLoc)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// fixturePath maps the request path to the fixture file path without extension, or "" if not supported
+func fixturePath(reqPath string) string {
+	reqPath = path.Clean(reqPath)
+	if strings.HasPrefix(reqPath, PNC_REST_V2) {
+		return strings.TrimPrefix(reqPath, PNC_REST_V2)
+	}
+	if strings.HasPrefix(reqPath, FOLO_ADMIN) && strings.HasSuffix(reqPath, "/report") {
+		id := path.Base(path.Dir(reqPath))
+		return path.Join(FOLO_FIXTURE_DIR, id)
+	}
+	return ""
+}
+
+// NewServer starts a PNC stand-in on a random local port, which is useful for go tests. Call Close() when done.
+func NewServer(dataDir string) *httptest.Server {
+	return httptest.NewServer(Handler(dataDir))
+}
+
+// ListenAndServe serves the fixtures on the address, e.g, ":8080", until an error happens
+func ListenAndServe(addr, dataDir string) error {
+	fmt.Printf("Start serving PNC fixtures from %s on %s\n", dataDir, addr)
+	return http.ListenAndServe(addr, Handler(dataDir))
+}
@@ -0,0 +1,146 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	DEFAULT_POLL_INTERVAL = 2 * time.Second
+	DEFAULT_ASYNC_TIMEOUT = 10 * time.Minute
+	CALLBACK_PATH         = "/promotion/callback"
+)
+
+// AsyncOptions of the promotion. An async promotion is accepted by indy with 202 and done in the background.
+// Its result is polled from indy, or posted by indy to a local callback receiver if Callback is set.
+type AsyncOptions struct {
+	Enabled      bool
+	Callback     string // listen address of the callback receiver, e.g, ":8090"
+	CallbackURL  string // the url for indy to post the result, default http://<hostname>:<port>/promotion/callback
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+func (opts *AsyncOptions) fillDefaults() {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_ASYNC_TIMEOUT
+	}
+}
+
+func newPromotionId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// callbackReceiver is a local http server receiving the result of an async promotion from indy
+type callbackReceiver struct {
+	URL      string
+	listener net.Listener
+	server   *http.Server
+	results  chan string
+}
+
+func startCallbackReceiver(addr, callbackURL, promotionId string) (*callbackReceiver, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := &callbackReceiver{URL: callbackURL, listener: listener, results: make(chan string, 1)}
+	if r.URL == "" {
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			if host, err = os.Hostname(); err != nil {
+				host = "localhost"
+			}
+		}
+		r.URL = fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), CALLBACK_PATH)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(CALLBACK_PATH, func(w http.ResponseWriter, req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result struct {
+			Request struct {
+				PromotionId string `json:"promotionId"`
+			} `json:"request"`
+		}
+		// The results of other promotions are ignored
+		if json.Unmarshal(b, &result) == nil && result.Request.PromotionId == promotionId {
+			select {
+			case r.results <- string(b):
+			default:
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	r.server = &http.Server{Handler: mux}
+	go r.server.Serve(listener)
+	return r, nil
+}
+
+func (r *callbackReceiver) Close() {
+	r.server.Close()
+}
+
+// waitForPromotion waits for the result of an accepted async promotion, from the callback receiver if any,
+// otherwise by polling indy until it's not 202.
+func waitForPromotion(indyURL, promotionId string, receiver *callbackReceiver, opts AsyncOptions) (string, int, error) {
+	timeout := time.After(opts.Timeout)
+	if receiver != nil {
+		select {
+		case respText := <-receiver.results:
+			return respText, http.StatusOK, nil
+		case <-timeout:
+			return "", common.StatusUnknown, fmt.Errorf("no callback of promotion %s in %v", promotionId, opts.Timeout)
+		}
+	}
+
+	URL := fmt.Sprintf("%s/api/promotion/paths/promote/%s", indyURL, promotionId)
+	for {
+		respText, code, succeeded := common.HTTPRequest(URL, common.MethodGet, nil, true, nil, nil, "", false)
+		if !succeeded {
+			return respText, code, fmt.Errorf("cannot get the status of promotion %s, code: %d", promotionId, code)
+		}
+		if code != http.StatusAccepted {
+			return respText, code, nil
+		}
+		select {
+		case <-time.After(opts.PollInterval):
+		case <-timeout:
+			return respText, code, fmt.Errorf("promotion %s not done in %v", promotionId, opts.Timeout)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	source = "maven:hosted:build-1"
+	target = "maven:hosted:pnc-builds"
+	jar    = "/org/foo/bar/1.0/bar-1.0.jar"
+)
+
+func TestAsyncPromote(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	indy.SetPromoteDelay(100 * time.Millisecond)
+	report.Start("promotetest", nil, "")
+
+	Convey("TestAsyncPromote", t, func() {
+		indy.Seed(source, jar, []byte("jar"))
+
+		Convey("The result is polled until done", func() {
+			resp, code, success := promote(indy.URL, source, target, []string{jar}, false,
+				AsyncOptions{Enabled: true, PollInterval: 20 * time.Millisecond})
+			So(success, ShouldBeTrue)
+			So(code, ShouldEqual, http.StatusOK)
+			So(resp, ShouldContainSubstring, jar)
+			_, promoted := indy.Content(target, jar)
+			So(promoted, ShouldBeTrue)
+			Rollback(indy.URL, resp, false)
+		})
+
+		Convey("The result is received by the callback", func() {
+			resp, code, success := promote(indy.URL, source, target, []string{jar}, false,
+				AsyncOptions{Enabled: true, Callback: "127.0.0.1:0", Timeout: 5 * time.Second})
+			So(success, ShouldBeTrue)
+			So(code, ShouldEqual, http.StatusOK)
+			_, promoted := indy.Content(target, jar)
+			So(promoted, ShouldBeTrue)
+			Rollback(indy.URL, resp, false)
+		})
+
+		Convey("The final result decides the outcome", func() {
+			_, _, success := promote(indy.URL, "maven:hosted:missing", target, []string{jar}, false,
+				AsyncOptions{Enabled: true, PollInterval: 20 * time.Millisecond})
+			So(success, ShouldBeFalse)
+			r := report.Current()
+			So(r.Results[len(r.Results)-1].Status, ShouldEqual, report.STATUS_FAILED)
+			So(r.Results[len(r.Results)-1].Error, ShouldContainSubstring, "No such source store")
+		})
+
+		Convey("It fails if not done in time", func() {
+			_, _, success := promote(indy.URL, source, target, []string{jar}, false,
+				AsyncOptions{Enabled: true, PollInterval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond})
+			So(success, ShouldBeFalse)
+			r := report.Current()
+			So(r.Results[len(r.Results)-1].Error, ShouldContainSubstring, "not done in")
+		})
+
+		Convey("The latency is recorded for the completed promotions", func() {
+			r := report.Current()
+			So(len(r.Metrics), ShouldEqual, 3)
+			So(r.Metrics[0].Name, ShouldEqual, "promotion queue to completion")
+			So(r.Metrics[0].Value, ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestIndyPromoteJSONTemplate(t *testing.T) {
+	Convey("TestIndyPromoteJSONTemplate", t, func() {
+		paths := []string{"/org/foo/bar/1.0+build/bar-1.0+build.jar", jar}
+		request := IndyPromoteJSONTemplate(&IndyPromoteVars{Source: source, Target: target, Paths: paths, Async: true,
+			PromotionId: "abc", CallbackURL: "http://host:8090/promotion/callback?build=1&token=a+b"})
+		var parsed struct {
+			Async       bool     `json:"async"`
+			PromotionId string   `json:"promotionId"`
+			Paths       []string `json:"paths"`
+			Callback    struct {
+				URL    string `json:"url"`
+				Method string `json:"method"`
+			} `json:"callback"`
+		}
+		So(json.Unmarshal([]byte(request), &parsed), ShouldBeNil)
+		So(parsed.Async, ShouldBeTrue)
+		So(parsed.PromotionId, ShouldEqual, "abc")
+		So(parsed.Paths, ShouldResemble, paths)
+		So(parsed.Callback.URL, ShouldEqual, "http://host:8090/promotion/callback?build=1&token=a+b")
+		So(parsed.Callback.Method, ShouldEqual, http.MethodPost)
+		So(request, ShouldNotContainSubstring, "&amp;")
+
+		// Without the optional fields
+		request = IndyPromoteJSONTemplate(&IndyPromoteVars{Source: source, Target: target})
+		So(request, ShouldNotContainSubstring, "callback")
+		So(request, ShouldNotContainSubstring, "promotionId")
+		So(request, ShouldNotContainSubstring, "paths")
+	})
+}
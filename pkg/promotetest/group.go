@@ -0,0 +1,178 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+// Modes of the promotion
+const (
+	MODE_PATHS = "paths" // promote the paths of the uploads to a hosted store
+	MODE_GROUP = "group" // add the hosted store of the build to the constituents of a group
+)
+
+// IndyGroupPromoteVars ...
+type IndyGroupPromoteVars struct {
+	Source      string
+	TargetGroup string // name of the group
+	DryRun      bool
+	FireEvents  bool
+}
+
+// IndyGroupPromoteJSONTemplate ...
+func IndyGroupPromoteJSONTemplate(indyGroupPromoteVars *IndyGroupPromoteVars) string {
+	request := struct {
+		Source      string `json:"source"`
+		TargetGroup string `json:"targetGroup"`
+		DryRun      bool   `json:"dryRun"`
+		FireEvents  bool   `json:"fireEvents"`
+	}{
+		Source:      indyGroupPromoteVars.Source,
+		TargetGroup: indyGroupPromoteVars.TargetGroup,
+		DryRun:      indyGroupPromoteVars.DryRun,
+		FireEvents:  indyGroupPromoteVars.FireEvents,
+	}
+	return marshalRequest(request)
+}
+
+// groupPromoteRequest is the part of the group promotion result needed to check the rollback
+type groupPromoteRequest struct {
+	Request struct {
+		Source      string `json:"source"`
+		TargetGroup string `json:"targetGroup"`
+	} `json:"request"`
+}
+
+// DoRunGroup promotes the hosted store of the build (the store of the uploads if sourceStore is empty) to the
+// target group, e.g, "maven:group:builds-untested". A target without package type is in that of the source.
+func DoRunGroup(indyBaseUrl, foloTrackId, sourceStore, targetGroup string, foloTrackContent common.TrackedContent,
+	dryRun bool) (string, int, bool) {
+	if sourceStore == "" {
+		if len(foloTrackContent.Uploads) == 0 {
+			fmt.Printf("There are not any uploads records in folo build %s, promotion will be ignored!\n", foloTrackId)
+			return "", 200, true
+		}
+		sourceStore = foloTrackContent.Uploads[0].StoreKey
+	}
+	if !strings.Contains(targetGroup, ":") {
+		targetGroup = common.PackageTypeOf(sourceStore) + ":group:" + targetGroup
+	}
+	return PromoteGroup(indyBaseUrl, sourceStore, targetGroup, dryRun)
+}
+
+// PromoteGroup adds the source store to the constituents of the target group via the group promotion of indy,
+// then checks the constituents of the group via the admin stores api
+func PromoteGroup(indyURL, source, targetGroup string, dryRun bool) (string, int, bool) {
+	toks := strings.Split(targetGroup, ":")
+	promoteVars := IndyGroupPromoteVars{
+		Source:      source,
+		TargetGroup: toks[len(toks)-1],
+		FireEvents:  true,
+	}
+	promote := IndyGroupPromoteJSONTemplate(&promoteVars)
+
+	URL := fmt.Sprintf("%s/api/promotion/groups/promote", indyURL)
+
+	name := fmt.Sprintf("%s -> %s", source, targetGroup)
+	if dryRun {
+		fmt.Printf("Dry run group promote request:\n %s\n\n", promote)
+		report.Record(report.Result{Kind: report.KIND_PROMOTION, Name: name, URL: URL, Status: report.STATUS_SKIPPED, Error: "dry run"})
+		return "", 200, true
+	}
+
+	fmt.Printf("Start group promote request:\n %s\n\n", promote)
+	start := time.Now()
+	respText, code, result := common.HTTPRequest(URL, common.MethodPost, nil, true, strings.NewReader(promote), nil, "", false)
+	recordPromotion(report.KIND_PROMOTION, name, URL, respText, code, result, time.Since(start))
+
+	printPromoteResult("Group promote", respText, result)
+	if !accepted(respText, result) {
+		return respText, code, false
+	}
+
+	start = time.Now()
+	err := ValidateGroupMembership(indyURL, targetGroup, source, true)
+	report.RecordCheck(report.KIND_PROMOTION, "membership of "+name, time.Since(start), err)
+	if err != nil {
+		fmt.Printf("Group promote validation failed, %s\n\n", err)
+		return respText, code, false
+	}
+	return respText, code, true
+}
+
+// RollbackGroup removes the source store of a group promotion from the target group, then checks that it's not
+// a constituent any more
+func RollbackGroup(indyURL, promoteResult string, dryRun bool) (string, int, bool) {
+	URL := fmt.Sprintf("%s/api/promotion/groups/rollback", indyURL)
+
+	if dryRun {
+		fmt.Printf("Dry run group rollback request:\n %s\n\n", URL)
+		report.Record(report.Result{Kind: report.KIND_ROLLBACK, Name: "group rollback", URL: URL, Status: report.STATUS_SKIPPED, Error: "dry run"})
+		return "", 200, true
+	}
+
+	fmt.Printf("Start group rollback request:\n %s\n\n", URL)
+	start := time.Now()
+	respText, code, result := common.HTTPRequest(URL, common.MethodPost, nil, true, strings.NewReader(promoteResult), nil, "", false)
+	recordPromotion(report.KIND_ROLLBACK, "group rollback", URL, respText, code, result, time.Since(start))
+
+	printPromoteResult("Group rollback", respText, result)
+	var rolledBack groupPromoteRequest
+	if !accepted(respText, result) || json.Unmarshal([]byte(respText), &rolledBack) != nil {
+		return respText, code, false
+	}
+
+	source := rolledBack.Request.Source
+	targetGroup := common.PackageTypeOf(source) + ":group:" + rolledBack.Request.TargetGroup
+	start = time.Now()
+	err := ValidateGroupMembership(indyURL, targetGroup, source, false)
+	report.RecordCheck(report.KIND_ROLLBACK, fmt.Sprintf("membership of %s -> %s", source, targetGroup), time.Since(start), err)
+	if err != nil {
+		fmt.Printf("Group rollback validation failed, %s\n\n", err)
+		return respText, code, false
+	}
+	return respText, code, true
+}
+
+// ValidateGroupMembership checks that the store is (or is not, if member is false) a constituent of the group
+func ValidateGroupMembership(indyURL, groupKey, storeKey string, member bool) error {
+	URL := fmt.Sprintf("%s/api/admin/stores/%s", indyURL, common.StoreKeyToPath(groupKey))
+	respText, code, succeeded := common.HTTPRequest(URL, common.MethodGet, nil, true, nil, nil, "", false)
+	if !succeeded {
+		return fmt.Errorf("cannot get group %s, code: %d", groupKey, code)
+	}
+	var group struct {
+		Constituents []string `json:"constituents"`
+	}
+	if err := json.Unmarshal([]byte(respText), &group); err != nil {
+		return fmt.Errorf("invalid definition of group %s, %s", groupKey, err)
+	}
+	if common.Contains(group.Constituents, storeKey) != member {
+		if member {
+			return fmt.Errorf("%s is not a constituent of %s, constituents: %v", storeKey, groupKey, group.Constituents)
+		}
+		return fmt.Errorf("%s is still a constituent of %s", storeKey, groupKey)
+	}
+	return nil
+}
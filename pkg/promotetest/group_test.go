@@ -0,0 +1,84 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupPromote(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	indy.AddStore(source, nil)
+	indy.AddStore("maven:group:builds", []string{target})
+	report.Start("promotetest", nil, "")
+	foloTrackContent := common.TrackedContent{Uploads: []common.TrackedContentEntry{{StoreKey: source, Path: jar}}}
+
+	Convey("TestGroupPromote", t, func() {
+		resp, _, success := DoRunGroup(indy.URL, "build-1", "", "builds", foloTrackContent, false)
+		So(success, ShouldBeTrue)
+		So(ValidateGroupMembership(indy.URL, "maven:group:builds", source, true), ShouldBeNil)
+
+		// Rejected as already a constituent, which is a failure even if the membership is as expected
+		_, _, success = PromoteGroup(indy.URL, source, "maven:group:builds", false)
+		So(success, ShouldBeFalse)
+		r := report.Current()
+		So(r.Results[len(r.Results)-1].Error, ShouldContainSubstring, "already a constituent")
+
+		// Rejected as no such source store
+		_, _, success = PromoteGroup(indy.URL, "maven:hosted:missing", "maven:group:builds", false)
+		So(success, ShouldBeFalse)
+		r = report.Current()
+		So(r.Results[len(r.Results)-1].Status, ShouldEqual, report.STATUS_FAILED)
+
+		_, _, success = RollbackGroup(indy.URL, resp, false)
+		So(success, ShouldBeTrue)
+		So(ValidateGroupMembership(indy.URL, "maven:group:builds", source, false), ShouldBeNil)
+		So(ValidateGroupMembership(indy.URL, "maven:group:builds", source, true), ShouldNotBeNil)
+
+		r = report.Current()
+		So(r.Summary.Total, ShouldEqual, 6)
+		So(r.Summary.Failed, ShouldEqual, 2)
+	})
+}
+
+func TestGroupPromoteEscaping(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	indy.AddStore(source, nil)
+	indy.AddStore("maven:group:builds-untested+shared-imports+public", []string{target})
+	report.Start("promotetest", nil, "")
+
+	Convey("TestGroupPromoteEscaping", t, func() {
+		So(IndyGroupPromoteJSONTemplate(&IndyGroupPromoteVars{Source: source, TargetGroup: "a+b&c<d'e"}), ShouldContainSubstring,
+			`"targetGroup": "a+b&c<d'e"`)
+
+		resp, _, success := PromoteGroup(indy.URL, source, "maven:group:builds-untested+shared-imports+public", false)
+		So(success, ShouldBeTrue)
+		So(report.Current().Summary.Failed, ShouldEqual, 0)
+		So(ValidateGroupMembership(indy.URL, "maven:group:builds-untested+shared-imports+public", source, true), ShouldBeNil)
+
+		_, _, success = RollbackGroup(indy.URL, resp, false)
+		So(success, ShouldBeTrue)
+		So(report.Current().Summary.Failed, ShouldEqual, 0)
+	})
+}
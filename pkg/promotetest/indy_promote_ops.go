@@ -2,12 +2,15 @@ package promotetest
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"html/template"
 	"log"
+	"net/http"
 	"strings"
+	"time"
 
 	common "github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 // IndyPromoteVars ...
@@ -20,10 +23,11 @@ type IndyPromoteVars struct {
 	DryRun         bool
 	FireEvents     bool
 	FailWhenExists bool
+	PromotionId    string
+	CallbackURL    string
 }
 
 func (promoteVars *IndyPromoteVars) fillDefaults() {
-	promoteVars.Async = false
 	promoteVars.DryRun = false
 	promoteVars.PurgeSource = false
 	promoteVars.FireEvents = true
@@ -36,62 +40,109 @@ func createIndyPromoteVars(source, target string, paths []string) IndyPromoteVar
 	return *promoteVars
 }
 
+// indyPromoteCallback is where indy posts the result of an async promotion to
+type indyPromoteCallback struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+}
+
 // IndyPromoteJSONTemplate ...
 func IndyPromoteJSONTemplate(indyPromoteVars *IndyPromoteVars) string {
-	request := `{
-  "async": {{.Async}},
-  "source": "{{.Source}}",
-  "target": "{{.Target}}",
-  {{if gt (len .Paths) 0}}
-  "paths": [{{range $index,$path := .Paths}}"{{$path}}"{{if isNotLast $index $.Paths}},{{end}}{{end}}],
-  {{end}}
-  "purgeSource": {{.PurgeSource}},
-  "dryRun": {{.DryRun}},
-  "fireEvents": {{.FireEvents}},
-  "failWhenExists": {{.FailWhenExists}}
-}`
-
-	t := template.Must(template.New("promote_request").Funcs(isNotLast).Parse(request))
-	var buf bytes.Buffer
-	err := t.Execute(&buf, indyPromoteVars)
-	if err != nil {
-		log.Fatal("executing template:", err)
+	request := struct {
+		Async          bool                 `json:"async"`
+		PromotionId    string               `json:"promotionId,omitempty"`
+		Callback       *indyPromoteCallback `json:"callback,omitempty"`
+		Source         string               `json:"source"`
+		Target         string               `json:"target"`
+		Paths          []string             `json:"paths,omitempty"`
+		PurgeSource    bool                 `json:"purgeSource"`
+		DryRun         bool                 `json:"dryRun"`
+		FireEvents     bool                 `json:"fireEvents"`
+		FailWhenExists bool                 `json:"failWhenExists"`
+	}{
+		Async:          indyPromoteVars.Async,
+		PromotionId:    indyPromoteVars.PromotionId,
+		Source:         indyPromoteVars.Source,
+		Target:         indyPromoteVars.Target,
+		Paths:          indyPromoteVars.Paths,
+		PurgeSource:    indyPromoteVars.PurgeSource,
+		DryRun:         indyPromoteVars.DryRun,
+		FireEvents:     indyPromoteVars.FireEvents,
+		FailWhenExists: indyPromoteVars.FailWhenExists,
 	}
-
-	return buf.String()
+	if indyPromoteVars.CallbackURL != "" {
+		request.Callback = &indyPromoteCallback{URL: indyPromoteVars.CallbackURL, Method: http.MethodPost}
+	}
+	return marshalRequest(request)
 }
 
-var isNotLast = template.FuncMap{
-	"isNotLast": func(index int, array []string) bool {
-		return index < len(array)-1
-	},
+// marshalRequest encodes the request to indy as JSON, keeping the characters like '+' and '&' of the store keys,
+// paths and urls as is
+func marshalRequest(request interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(request); err != nil {
+		log.Fatal("encoding request:", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
 }
 
-func promote(indyURL, source, target string, paths []string, dryRun bool) (string, int, bool) {
+func promote(indyURL, source, target string, paths []string, dryRun bool, async AsyncOptions) (string, int, bool) {
 	promoteVars := IndyPromoteVars{
 		Source: source,
 		Target: target,
 		Paths:  paths,
+		Async:  async.Enabled,
+	}
+	if async.Enabled {
+		async.fillDefaults()
+		promoteVars.PromotionId = newPromotionId()
 	}
-	promote := IndyPromoteJSONTemplate(&promoteVars)
 
 	URL := fmt.Sprintf("%s/api/promotion/paths/promote", indyURL)
 
+	name := fmt.Sprintf("%s -> %s", source, target)
 	if dryRun {
-		fmt.Printf("Dry run promote request:\n %s\n\n", promote)
+		fmt.Printf("Dry run promote request:\n %s\n\n", IndyPromoteJSONTemplate(&promoteVars))
+		report.Record(report.Result{Kind: report.KIND_PROMOTION, Name: name, URL: URL, Status: report.STATUS_SKIPPED, Error: "dry run"})
 		return "", 200, true
 	}
 
+	var receiver *callbackReceiver
+	if async.Enabled && async.Callback != "" {
+		var err error
+		if receiver, err = startCallbackReceiver(async.Callback, async.CallbackURL, promoteVars.PromotionId); err != nil {
+			fmt.Printf("Promote Error. Cannot start the callback receiver on %s, %s\n\n", async.Callback, err)
+			report.Record(report.Result{Kind: report.KIND_PROMOTION, Name: name, URL: URL, Status: report.STATUS_FAILED, Error: err.Error()})
+			return "", common.StatusUnknown, false
+		}
+		defer receiver.Close()
+		promoteVars.CallbackURL = receiver.URL
+	}
+	promote := IndyPromoteJSONTemplate(&promoteVars)
+
 	fmt.Printf("Start promote request:\n %s\n\n", promote)
+	start := time.Now()
 	respText, code, result := common.HTTPRequest(URL, common.MethodPost, nil, true, strings.NewReader(promote), nil, "", false)
-
-	if result {
-		fmt.Printf("Promote Done. Result is:\n %s\n\n", respText)
-	} else {
-		fmt.Printf("Promote Error. Result is:\n %s\n\n", respText)
+	// The async promotion is only queued with 202, the final result of which is the outcome
+	if result && code == http.StatusAccepted {
+		fmt.Printf("Promote %s accepted, waiting for it to be done.\n\n", promoteVars.PromotionId)
+		var err error
+		respText, code, err = waitForPromotion(indyURL, promoteVars.PromotionId, receiver, async)
+		if err != nil {
+			fmt.Printf("Promote Error. %s\n\n", err)
+			report.Record(report.Result{Kind: report.KIND_PROMOTION, Name: name, URL: URL, Status: report.STATUS_FAILED,
+				Error: err.Error(), Duration: time.Since(start)})
+			return respText, code, false
+		}
+		report.RecordMetric("promotion queue to completion", time.Since(start))
 	}
+	recordPromotion(report.KIND_PROMOTION, name, URL, respText, code, result, time.Since(start))
+	printPromoteResult("Promote", respText, result)
 
-	return respText, code, result
+	return respText, code, accepted(respText, result)
 }
 
 func Rollback(indyURL, promoteResult string, dryRun bool) (string, int, bool) {
@@ -99,17 +150,47 @@ func Rollback(indyURL, promoteResult string, dryRun bool) (string, int, bool) {
 
 	if dryRun {
 		fmt.Printf("Dry run rollback request:\n %s\n\n", URL)
+		report.Record(report.Result{Kind: report.KIND_ROLLBACK, Name: "rollback", URL: URL, Status: report.STATUS_SKIPPED, Error: "dry run"})
 		return "", 200, true
 	}
 
 	fmt.Printf("Start rollback request:\n %s\n\n", URL)
+	start := time.Now()
 	respText, code, result := common.HTTPRequest(URL, common.MethodPost, nil, true, strings.NewReader(promoteResult), nil, "", false)
+	recordPromotion(report.KIND_ROLLBACK, "rollback", URL, respText, code, result, time.Since(start))
+	printPromoteResult("Rollback", respText, result)
 
-	if result {
-		fmt.Printf("Rollback Done. Result is:\n %s\n\n", respText)
-	} else {
-		fmt.Printf("Rollback Error. Result is:\n %s\n\n", respText)
+	return respText, code, accepted(respText, result)
+}
+
+// recordPromotion adds the promotion or rollback to the report. Indy returns 200 even if the promotion fails,
+// with the error or the failed validation rules in the response body.
+func recordPromotion(kind, name, url, respText string, code int, succeeded bool, duration time.Duration) {
+	r := report.Result{Kind: kind, Name: name, URL: url, Status: report.STATUS_PASSED, Duration: duration}
+	if code != common.StatusUnknown {
+		r.HTTPCode = code
+	}
+	if !succeeded {
+		r.Status, r.Error = report.STATUS_FAILED, fmt.Sprintf("%s failed, code: %d", kind, code)
+	} else if result, err := ParsePromoteResult(respText); err == nil && result.Rejected() {
+		r.Status, r.Error = report.STATUS_FAILED, result.Reason()
 	}
+	report.Record(r)
+}
 
-	return respText, code, result
+// printPromoteResult prints the parsed result, with the error of each failed rule if rejected
+func printPromoteResult(action, respText string, succeeded bool) {
+	result, err := ParsePromoteResult(respText)
+	switch {
+	case !succeeded || err != nil:
+		fmt.Printf("%s Error. Result is:\n %s\n\n", action, respText)
+	case result.Rejected():
+		fmt.Printf("%s Rejected. %s\n", action, result)
+		for _, rule := range result.FailedRules() {
+			fmt.Printf("  %s: %s\n", rule, result.Validations.ValidatorErrors[rule])
+		}
+		fmt.Println()
+	default:
+		fmt.Printf("%s Done. %s\n\n", action, result)
+	}
 }
@@ -0,0 +1,107 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationResult is the validation of a promotion against the rule set matched by the target store
+type ValidationResult struct {
+	Valid           bool              `json:"valid"`
+	RuleSet         string            `json:"ruleSet"`
+	ValidatorErrors map[string]string `json:"validatorErrors"` // the error by rule name
+}
+
+// PromoteRequest is the request of a promotion, which indy returns in the result
+type PromoteRequest struct {
+	Source      string   `json:"source"`
+	Target      string   `json:"target"`
+	Paths       []string `json:"paths"`
+	PurgeSource bool     `json:"purgeSource"`
+}
+
+// PromoteResult is the response of a promotion or a rollback
+type PromoteResult struct {
+	Request        PromoteRequest   `json:"request"`
+	PendingPaths   []string         `json:"pendingPaths"`
+	CompletedPaths []string         `json:"completedPaths"`
+	SkippedPaths   []string         `json:"skippedPaths"`
+	Validations    ValidationResult `json:"validations"`
+	Error          string           `json:"error"`
+}
+
+// ParsePromoteResult parses the response of indy. The result is valid if there are no validations in it.
+func ParsePromoteResult(respText string) (PromoteResult, error) {
+	result := PromoteResult{Validations: ValidationResult{Valid: true}}
+	if err := json.Unmarshal([]byte(respText), &result); err != nil {
+		return result, fmt.Errorf("invalid promotion result, %s", err)
+	}
+	return result, nil
+}
+
+// Rejected tells if indy refused the promotion, by an error or by the validation rules
+func (r PromoteResult) Rejected() bool {
+	return r.Error != "" || !r.Validations.Valid || len(r.Validations.ValidatorErrors) > 0
+}
+
+// accepted tells if the promotion or rollback request succeeded with a result that indy did not reject. Indy
+// returns 200 for a rejected promotion too.
+func accepted(respText string, succeeded bool) bool {
+	result, err := ParsePromoteResult(respText)
+	return succeeded && err == nil && !result.Rejected()
+}
+
+// FailedRules returns the names of the rules rejecting the promotion, in order
+func (r PromoteResult) FailedRules() []string {
+	var rules []string
+	for rule := range r.Validations.ValidatorErrors {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// Reason describes why the promotion is rejected, empty if not
+func (r PromoteResult) Reason() string {
+	var reasons []string
+	if r.Error != "" {
+		reasons = append(reasons, r.Error)
+	}
+	if rules := r.FailedRules(); len(rules) > 0 {
+		var errs []string
+		for _, rule := range rules {
+			errs = append(errs, fmt.Sprintf("%s: %s", rule, r.Validations.ValidatorErrors[rule]))
+		}
+		reasons = append(reasons, fmt.Sprintf("validation failed by rule set %s, %s", r.Validations.RuleSet, strings.Join(errs, "; ")))
+	} else if !r.Validations.Valid {
+		reasons = append(reasons, fmt.Sprintf("validation failed by rule set %s", r.Validations.RuleSet))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// String is the summary of the result for the logs
+func (r PromoteResult) String() string {
+	s := fmt.Sprintf("completed: %d, skipped: %d, pending: %d", len(r.CompletedPaths), len(r.SkippedPaths), len(r.PendingPaths))
+	if r.Rejected() {
+		s += ", rejected: " + r.Reason()
+	}
+	return s
+}
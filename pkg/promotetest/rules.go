@@ -0,0 +1,223 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+// Cases of the validation rule suite, each of which violates one rule of the rule set of the target
+const (
+	CASE_MISSING_CHECKSUMS = "missing-checksums" // artifacts without .md5 and .sha1
+	CASE_SNAPSHOT          = "snapshot"          // a snapshot version to a release repo
+	CASE_MISSING_POM       = "missing-pom"       // a jar without its pom
+	CASE_PRE_EXISTING      = "pre-existing"      // paths already in the target, with failWhenExists
+)
+
+// RULE_CASES are all the cases, in the order they run
+var RULE_CASES = []string{CASE_MISSING_CHECKSUMS, CASE_SNAPSHOT, CASE_MISSING_POM, CASE_PRE_EXISTING}
+
+// DEFAULT_RULES are the rules expected to reject the cases, which can be overridden to match the rule set of the
+// target store
+var DEFAULT_RULES = map[string]string{
+	CASE_MISSING_CHECKSUMS: "checksums-required.groovy",
+	CASE_SNAPSHOT:          "no-snapshots-paths.groovy",
+	CASE_MISSING_POM:       "pom-required.groovy",
+	CASE_PRE_EXISTING:      "no-pre-existing-paths.groovy",
+}
+
+const RULES_TEST_ARTIFACT = "/org/commonjava/indy/indy-rules-test"
+
+// ruleCase is the content to promote for a case. If existing is true, it's promoted once before, so that the
+// paths exist in the target when promoted again with changed content.
+type ruleCase struct {
+	files    map[string][]byte
+	existing bool
+}
+
+func newRuleCase(name, suffix string) ruleCase {
+	version := "1.0.0.redhat-" + suffix
+	if name == CASE_SNAPSHOT {
+		version = "1.0." + suffix + "-SNAPSHOT"
+	}
+	prefix := fmt.Sprintf("%s/%s/indy-rules-test-%s", RULES_TEST_ARTIFACT, version, version)
+	files := map[string][]byte{
+		prefix + ".pom": []byte(fmt.Sprintf("<project><groupId>org.commonjava.indy</groupId><artifactId>indy-rules-test</artifactId><version>%s</version></project>", version)),
+		prefix + ".jar": []byte("jar of " + version),
+	}
+	c := ruleCase{files: files, existing: name == CASE_PRE_EXISTING}
+	if name == CASE_MISSING_POM {
+		delete(files, prefix+".pom")
+	}
+	if name != CASE_MISSING_CHECKSUMS {
+		addChecksums(files)
+	}
+	return c
+}
+
+// addChecksums adds the .md5 and .sha1 files of the artifacts
+func addChecksums(files map[string][]byte) {
+	for p, content := range files {
+		if strings.HasSuffix(p, common.EXT_MD5) || strings.HasSuffix(p, common.EXT_SHA1) {
+			continue
+		}
+		w := common.NewDigestWriter()
+		w.Write(content)
+		d := w.Digests()
+		files[p+common.EXT_MD5] = []byte(d.Md5)
+		files[p+common.EXT_SHA1] = []byte(d.Sha1)
+	}
+}
+
+// RunRules runs the validation rule suite against the target hosted store of the target indy, and exits if any
+// case is not rejected by the expected rule
+func RunRules(targetIndy, targetStore string, rules map[string]string) {
+	indyURL, validated := common.ValidateTargetIndy(targetIndy)
+	if !validated {
+		report.Exit(1)
+	}
+	if !DoRunRules(indyURL, targetStore, rules) {
+		report.Exit(1)
+	}
+}
+
+/*
+ * DoRunRules promotes content violating the rules to the target store, e.g, "pnc-builds" or "maven:hosted:pnc-builds",
+ * and checks that indy rejects each promotion by the expected rule in the validation result. The expected rules are
+ * DEFAULT_RULES, overridden by rules. For each case, a temporary hosted repo is created as the source, and deleted
+ * afterwards. A promotion which is not rejected is rolled back.
+ */
+func DoRunRules(indyURL, targetStore string, rules map[string]string) bool {
+	if !strings.Contains(targetStore, ":") {
+		targetStore = common.PACKAGE_TYPE_MAVEN + ":hosted:" + targetStore
+	}
+	passed := true
+	for _, name := range RULE_CASES {
+		rule := DEFAULT_RULES[name]
+		if r, ok := rules[name]; ok {
+			rule = r
+		}
+		fmt.Printf("Start rule case %s, expected to be rejected by %s\n", name, rule)
+		start := time.Now()
+		err := runRuleCase(indyURL, targetStore, name, rule)
+		report.RecordCheck(report.KIND_RULE, fmt.Sprintf("%s (%s)", name, rule), time.Since(start), err)
+		if err != nil {
+			fmt.Printf("Rule case %s failed, %s\n\n", name, err)
+			passed = false
+		} else {
+			fmt.Printf("Rule case %s passed\n\n", name)
+		}
+	}
+	return passed
+}
+
+func runRuleCase(indyURL, targetStore, name, rule string) error {
+	buildName := common.GenerateRandomBuildName()
+	c := newRuleCase(name, buildName[len(common.BUILD_TEST_):])
+
+	sourceStore := common.PACKAGE_TYPE_MAVEN + ":hosted:" + buildName
+	hosted := buildtest.IndyHostedTemplate(&buildtest.IndyHostedVars{Name: buildName, Type: common.PACKAGE_TYPE_MAVEN})
+	storeURL := fmt.Sprintf("%s/api/admin/stores/%s", indyURL, common.StoreKeyToPath(sourceStore))
+	if _, code, ok := common.HTTPRequest(storeURL, common.MethodPut, nil, false, strings.NewReader(hosted), nil, "", false); !ok {
+		return fmt.Errorf("cannot create source repo %s, code: %d", sourceStore, code)
+	}
+	defer common.HTTPRequest(storeURL+"?deleteContent=true", common.MethodDelete, nil, false, nil, nil, "", false)
+
+	if err := uploadFiles(indyURL, sourceStore, c.files); err != nil {
+		return err
+	}
+	var paths []string
+	for p := range c.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if c.existing {
+		resp, result, err := submitPromotion(indyURL, sourceStore, targetStore, paths)
+		if err != nil {
+			return fmt.Errorf("cannot promote the paths to exist in the target, %s", err)
+		}
+		if result.Rejected() {
+			return fmt.Errorf("cannot promote the paths to exist in the target, %s", result.Reason())
+		}
+		defer submitRollback(indyURL, resp)
+		// Changed, so that the paths are not skipped as the same content
+		for p, content := range c.files {
+			if strings.HasSuffix(p, ".jar") {
+				c.files[p] = append(content, []byte(" changed")...)
+				delete(c.files, p+common.EXT_MD5)
+				delete(c.files, p+common.EXT_SHA1)
+			}
+		}
+		addChecksums(c.files)
+		if err := uploadFiles(indyURL, sourceStore, c.files); err != nil {
+			return err
+		}
+	}
+
+	resp, result, err := submitPromotion(indyURL, sourceStore, targetStore, paths)
+	if err != nil {
+		return err
+	}
+	if !result.Rejected() {
+		submitRollback(indyURL, resp)
+		return fmt.Errorf("promotion is not rejected, %s", result)
+	}
+	if _, ok := result.Validations.ValidatorErrors[rule]; !ok {
+		return fmt.Errorf("promotion is not rejected by %s, %s", rule, result.Reason())
+	}
+	fmt.Printf("Promotion rejected as expected, %s\n", result.Validations.ValidatorErrors[rule])
+	return nil
+}
+
+func uploadFiles(indyURL, storeKey string, files map[string][]byte) error {
+	toks := strings.Split(storeKey, ":")
+	for p, content := range files {
+		URL := common.GetIndyContentUrl(indyURL, toks[0], toks[1], toks[2], p)
+		if _, code, ok := common.HTTPRequest(URL, common.MethodPut, nil, false, bytes.NewReader(content), nil, "", false); !ok {
+			return fmt.Errorf("cannot upload %s, code: %d", URL, code)
+		}
+	}
+	return nil
+}
+
+// submitPromotion promotes the paths with failWhenExists, without recording it as a promotion test
+func submitPromotion(indyURL, source, target string, paths []string) (string, PromoteResult, error) {
+	promoteVars := createIndyPromoteVars(source, target, paths)
+	URL := fmt.Sprintf("%s/api/promotion/paths/promote", indyURL)
+	respText, code, ok := common.HTTPRequest(URL, common.MethodPost, nil, true, strings.NewReader(IndyPromoteJSONTemplate(&promoteVars)), nil, "", false)
+	if !ok {
+		return respText, PromoteResult{}, fmt.Errorf("promotion failed, code: %d", code)
+	}
+	result, err := ParsePromoteResult(respText)
+	return respText, result, err
+}
+
+func submitRollback(indyURL, promoteResult string) {
+	URL := fmt.Sprintf("%s/api/promotion/paths/rollback", indyURL)
+	if _, code, ok := common.HTTPRequest(URL, common.MethodPost, nil, true, strings.NewReader(promoteResult), nil, "", false); !ok {
+		fmt.Printf("Warning: cannot roll back the promotion of the rule case, code: %d\n", code)
+	}
+}
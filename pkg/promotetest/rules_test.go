@@ -0,0 +1,94 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParsePromoteResult(t *testing.T) {
+	Convey("TestParsePromoteResult", t, func() {
+		result, err := ParsePromoteResult(`{"completedPaths": ["/a.jar"], "skippedPaths": [], "pendingPaths": []}`)
+		So(err, ShouldBeNil)
+		So(result.Rejected(), ShouldBeFalse)
+		So(result.String(), ShouldEqual, "completed: 1, skipped: 0, pending: 0")
+
+		result, err = ParsePromoteResult(`{"pendingPaths": ["/a.jar", "/b.jar"], "validations": {"valid": false,
+			"ruleSet": "maven-pnc-builds.json", "validatorErrors": {"b.groovy": "b failed", "a.groovy": "a failed"}}}`)
+		So(err, ShouldBeNil)
+		So(result.Rejected(), ShouldBeTrue)
+		So(result.FailedRules(), ShouldResemble, []string{"a.groovy", "b.groovy"})
+		So(result.Reason(), ShouldEqual, "validation failed by rule set maven-pnc-builds.json, a.groovy: a failed; b.groovy: b failed")
+
+		result, _ = ParsePromoteResult(`{"error": "No such source store"}`)
+		So(result.Rejected(), ShouldBeTrue)
+		So(result.Reason(), ShouldEqual, "No such source store")
+
+		_, err = ParsePromoteResult("Internal Server Error")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRules(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	report.Start("promotetest", nil, "")
+
+	Convey("TestRules", t, func() {
+		Convey("All the cases are rejected by the expected rules", func() {
+			indy.SetRuleSet(target, "maven-pnc-builds.json", mockindy.RULE_CHECKSUMS, mockindy.RULE_NO_SNAPSHOTS,
+				mockindy.RULE_POM_REQUIRED, mockindy.RULE_NO_PRE_EXISTING)
+			report.Start("promotetest", nil, "")
+			So(DoRunRules(indy.URL, "pnc-builds", nil), ShouldBeTrue)
+			r := report.Current()
+			So(r.Summary.Total, ShouldEqual, len(RULE_CASES))
+			So(r.Summary.Passed, ShouldEqual, len(RULE_CASES))
+			So(indy.HasStore(source), ShouldBeFalse)
+		})
+
+		Convey("A case fails if not rejected, or rejected by another rule", func() {
+			indy.SetRuleSet(target, "maven-pnc-builds.json", mockindy.RULE_CHECKSUMS, mockindy.RULE_POM_REQUIRED,
+				mockindy.RULE_NO_PRE_EXISTING)
+			report.Start("promotetest", nil, "")
+			So(DoRunRules(indy.URL, target, map[string]string{CASE_MISSING_POM: "project-artifacts.groovy"}), ShouldBeFalse)
+			r := report.Current()
+			So(r.Summary.Failed, ShouldEqual, 2)
+			So(r.Results[1].Error, ShouldStartWith, "promotion is not rejected")
+			So(r.Results[2].Error, ShouldStartWith, "promotion is not rejected by project-artifacts.groovy")
+			// The snapshot promoted unexpectedly is rolled back
+			metadata, _, _ := common.HTTPRequest(common.GetIndyContentUrl(indy.URL, "maven", "hosted", "pnc-builds",
+				RULES_TEST_ARTIFACT+"/maven-metadata.xml"), common.MethodGet, nil, true, nil, nil, "", false)
+			So(metadata, ShouldNotContainSubstring, "SNAPSHOT")
+		})
+
+		Convey("A promotion rejected by the rules fails like any other failed promotion", func() {
+			indy.SetRuleSet(target, "maven-pnc-builds.json", mockindy.RULE_CHECKSUMS)
+			report.Start("promotetest", nil, "")
+			indy.Seed(source, jar, []byte("jar")) // no checksums
+			resp, _, success := promote(indy.URL, source, target, []string{jar}, false, AsyncOptions{})
+			So(success, ShouldBeFalse)
+			So(resp, ShouldContainSubstring, mockindy.RULE_CHECKSUMS)
+			_, promoted := indy.Content(target, jar)
+			So(promoted, ShouldBeFalse)
+		})
+	})
+}
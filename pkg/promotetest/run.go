@@ -2,37 +2,51 @@ package promotetest
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
-func Run(targetIndy, foloTrackId, targetStore string) {
-	indyHost, validated := common.ValidateTargetIndy(targetIndy)
+// Run promotes the uploads of the folo record to the target store, or to the target group in MODE_GROUP
+func Run(targetIndy, foloTrackId, targetStore, mode string, async AsyncOptions) {
+	indyURL, validated := common.ValidateTargetIndy(targetIndy)
 	if !validated {
-		os.Exit(1)
+		report.Exit(1)
 	}
 
-	indyURL := "http://" + indyHost
 	foloTrackContent := common.GetFoloRecord(indyURL, foloTrackId)
-	DoRun(indyURL, foloTrackId, "", targetStore, "", foloTrackContent, false)
+	var success bool
+	if mode == MODE_GROUP {
+		_, _, success = DoRunGroup(indyURL, foloTrackId, "", targetStore, foloTrackContent, false)
+	} else {
+		_, _, success = DoRun(indyURL, foloTrackId, "", targetStore, "", foloTrackContent, false, async)
+	}
+	if !success {
+		report.Exit(1)
+	}
 }
 
 func DoRun(indyBaseUrl, foloTrackId, sourceStore, targetStore, newVersionNum string,
-	foloTrackContent common.TrackedContent, dryRun bool) (string, int, bool) {
+	foloTrackContent common.TrackedContent, dryRun bool, async AsyncOptions) (string, int, bool) {
 	if foloTrackContent.Uploads == nil && len(foloTrackContent.Uploads) == 0 {
 		fmt.Printf("There are not any uploads records in folo build %s, promotion will be ignored!\n", foloTrackId)
 		return "", 200, true
 	}
 
-	paths := []string{}
-
 	if sourceStore == "" {
 		sourceStore = foloTrackContent.Uploads[0].StoreKey
 	}
+	paths := promotionPaths(foloTrackContent, newVersionNum)
 
+	return promote(indyBaseUrl, sourceStore, targetStore, paths, dryRun, async)
+}
+
+// promotionPaths returns the paths of the uploads except the package metadata, with the version replaced by
+// newVersionNum if not empty
+func promotionPaths(foloTrackContent common.TrackedContent, newVersionNum string) []string {
+	paths := []string{}
 	for _, up := range foloTrackContent.Uploads {
-		if common.IsMetadata(up.Path) {
+		if common.IsPackageMetadata(common.PackageTypeOf(up.StoreKey), up.Path) {
 			continue // ignore matedata
 		}
 		if newVersionNum == "" {
@@ -43,6 +57,5 @@ func DoRun(indyBaseUrl, foloTrackId, sourceStore, targetStore, newVersionNum str
 			paths = append(paths, altered)
 		}
 	}
-
-	return promote(indyBaseUrl, sourceStore, targetStore, paths, dryRun)
+	return paths
 }
@@ -0,0 +1,351 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const (
+	DEFAULT_STRESS_BUILDS   = 3
+	DEFAULT_STRESS_COPIES   = 2
+	DEFAULT_STRESS_ROUTINES = 4
+	DEFAULT_STRESS_TIMEOUT  = 2 * time.Minute
+)
+
+// StressOptions are the options of the promotion stress test
+type StressOptions struct {
+	Builds       int           // builds replayed from the folo record, the paths of which are disjoint
+	Copies       int           // concurrent promotions of each build, the paths of which overlap
+	ProcessNum   int           // goroutines to replay each build
+	PollInterval time.Duration // between the checks of the target after the promotions and the rollbacks
+	Timeout      time.Duration // until the target is as expected, which allows the events of indy to be handled
+}
+
+func (opts *StressOptions) fillDefaults() {
+	if opts.Builds <= 0 {
+		opts.Builds = DEFAULT_STRESS_BUILDS
+	}
+	if opts.Copies <= 0 {
+		opts.Copies = DEFAULT_STRESS_COPIES
+	}
+	if opts.ProcessNum <= 0 {
+		opts.ProcessNum = DEFAULT_STRESS_ROUTINES
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_STRESS_TIMEOUT
+	}
+}
+
+// stressBuild is a build replayed to its own hosted repo, with the release number of its name
+type stressBuild struct {
+	name       string
+	newVersion string
+	source     string
+	paths      []string
+}
+
+// stressPromotion is the outcome of one of the concurrent promotions
+type stressPromotion struct {
+	build     *stressBuild
+	respText  string
+	result    PromoteResult
+	succeeded bool
+	duration  time.Duration
+}
+
+// RunStress replays the build of the folo record several times to the target indy, and stresses the promotions of
+// them to the target store. It exits if any check fails.
+func RunStress(originalIndy, foloTrackId, targetIndy, targetStore string, opts StressOptions) {
+	originalIndyURL, validated := common.ValidateTargetIndy(originalIndy)
+	if !validated {
+		report.Exit(1)
+	}
+	foloTrackContent := common.GetFoloRecord(originalIndyURL, foloTrackId)
+	if !DoRunStress(originalIndyURL, targetIndy, targetStore, foloTrackContent, opts) {
+		report.Exit(1)
+	}
+}
+
+/*
+ * DoRunStress replays the build of the folo record opts.Builds times, then promotes each of them opts.Copies times
+ * to the target store at once, e.g, "pnc-builds" or "maven:hosted:pnc-builds". The promotions of a build overlap
+ * each other, while those of different builds are disjoint. It checks that:
+ *   1. every path is completed by exactly one of the promotions, and all the others skip it;
+ *   2. replaying the promotions completes nothing;
+ *   3. the metadata of the target lists the version of each build exactly once;
+ *   4. after all the promotions are rolled back, no path or version of the builds is left in the target.
+ * The test repos and folo records of the builds are deleted afterwards.
+ */
+func DoRunStress(originalIndy, targetIndy, targetStore string, foloTrackContent common.TrackedContent, opts StressOptions) bool {
+	indyURL, validated := common.ValidateTargetIndy(targetIndy)
+	if !validated {
+		return false
+	}
+	if len(foloTrackContent.Uploads) == 0 {
+		fmt.Printf("There are not any uploads records in folo build %s, nothing to promote!\n", foloTrackContent.TrackingKey.Id)
+		return false
+	}
+	opts.fillDefaults()
+
+	packageType := common.PackageTypeOf(foloTrackContent.Uploads[0].StoreKey)
+	if !strings.Contains(targetStore, ":") {
+		targetStore = packageType + ":hosted:" + targetStore
+	}
+
+	var builds []*stressBuild
+	defer func() {
+		for _, b := range builds {
+			buildtest.DeleteIndyTestRepos(indyURL, packageType, b.name)
+			common.DeleteFoloRecord(indyURL, b.name)
+		}
+	}()
+	names := map[string]bool{}
+	for len(builds) < opts.Builds {
+		name := common.GenerateRandomBuildName()
+		if names[name] {
+			continue
+		}
+		names[name] = true
+		b := &stressBuild{name: name, newVersion: name[len(common.BUILD_TEST_):], source: packageType + ":hosted:" + name}
+		b.paths = promotionPaths(foloTrackContent, b.newVersion)
+		builds = append(builds, b)
+
+		fmt.Printf("Replay build %d/%d as %s\n\n", len(builds), opts.Builds, name)
+		if !buildtest.DoRun(originalIndy, "", indyURL, packageType, name, foloTrackContent, nil, opts.ProcessNum,
+			false, false, buildtest.UploadOptions{}, nil, 0) {
+			fmt.Printf("Replay build %s failed, stress test aborted.\n", name)
+			return false
+		}
+	}
+
+	promotions := promoteConcurrently(indyURL, targetStore, builds, opts.Copies)
+	passed := true
+	check := func(kind, name string, start time.Time, err error) {
+		report.RecordCheck(kind, name, time.Since(start), err)
+		if err != nil {
+			fmt.Printf("Stress check %s FAILED, %s\n\n", name, err)
+			passed = false
+		} else {
+			fmt.Printf("Stress check %s passed\n\n", name)
+		}
+	}
+
+	start := time.Now()
+	check(report.KIND_PROMOTION, "concurrent promotions to "+targetStore, start, checkCompletedOnce(builds, promotions))
+
+	start = time.Now()
+	check(report.KIND_PROMOTION, "replayed promotions to "+targetStore, start, replayPromotions(indyURL, targetStore, builds))
+
+	metaFiles, _ := affectedMetadata(builds[0].paths)
+	start = time.Now()
+	check(report.KIND_METADATA, "versions in metadata of "+targetStore, start, pollUntil(opts, func() error {
+		return checkMetadataVersions(indyURL, targetStore, metaFiles, builds, 1)
+	}))
+
+	start = time.Now()
+	var e common.MultiError
+	for _, p := range promotions {
+		if !p.succeeded {
+			continue
+		}
+		respText, code, succeeded := Rollback(indyURL, p.respText, false)
+		if result, _ := ParsePromoteResult(respText); result.Rejected() {
+			e.Append(fmt.Sprintf("rollback of %s rejected, %s", p.build.source, result.Reason()))
+		} else if !succeeded {
+			e.Append(fmt.Sprintf("rollback of %s failed, code: %d", p.build.source, code))
+		}
+	}
+	check(report.KIND_ROLLBACK, "rollbacks from "+targetStore, start, errorOf(&e))
+
+	start = time.Now()
+	check(report.KIND_ROLLBACK, "residue in "+targetStore, start, pollUntil(opts, func() error {
+		if err := checkNoResidue(indyURL, targetStore, builds); err != nil {
+			return err
+		}
+		return checkMetadataVersions(indyURL, targetStore, metaFiles, builds, 0)
+	}))
+
+	return passed
+}
+
+// promoteConcurrently promotes each build copies times to the target, all at once
+func promoteConcurrently(indyURL, targetStore string, builds []*stressBuild, copies int) []*stressPromotion {
+	var promotions []*stressPromotion
+	for _, b := range builds {
+		for i := 0; i < copies; i++ {
+			promotions = append(promotions, &stressPromotion{build: b})
+		}
+	}
+	fmt.Printf("Start %d concurrent promotions of %d builds to %s\n\n", len(promotions), len(builds), targetStore)
+
+	begin := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, p := range promotions {
+		wg.Add(1)
+		go func(p *stressPromotion) {
+			defer wg.Done()
+			<-begin
+			start := time.Now()
+			p.respText, _, p.succeeded = promote(indyURL, p.build.source, targetStore, p.build.paths, false, AsyncOptions{})
+			p.duration = time.Since(start)
+			p.result, _ = ParsePromoteResult(p.respText)
+		}(p)
+	}
+	close(begin)
+	wg.Wait()
+
+	latency := common.NewHistogram()
+	for _, p := range promotions {
+		latency.Record(p.duration)
+	}
+	report.RecordMetric("concurrent promotion p50", latency.ValueAtPercentile(50))
+	report.RecordMetric("concurrent promotion p95", latency.ValueAtPercentile(95))
+	report.RecordMetric("concurrent promotion max", latency.Max())
+	fmt.Printf("Concurrent promotions done, p50: %v, p95: %v, max: %v\n\n", latency.ValueAtPercentile(50),
+		latency.ValueAtPercentile(95), latency.Max())
+	return promotions
+}
+
+// checkCompletedOnce checks that all the promotions succeeded, and each path of the builds is completed by exactly
+// one of them
+func checkCompletedOnce(builds []*stressBuild, promotions []*stressPromotion) error {
+	var e common.MultiError
+	completed := map[string]int{}
+	for _, p := range promotions {
+		if p.result.Rejected() {
+			e.Append(fmt.Sprintf("promotion of %s rejected, %s", p.build.source, p.result.Reason()))
+			continue
+		}
+		if !p.succeeded {
+			e.Append(fmt.Sprintf("promotion of %s failed", p.build.source))
+			continue
+		}
+		for _, aPath := range p.result.CompletedPaths {
+			completed[aPath]++
+		}
+	}
+	expected := map[string]bool{}
+	for _, b := range builds {
+		for _, aPath := range b.paths {
+			expected[aPath] = true
+			if n := completed[aPath]; n != 1 {
+				e.Append(fmt.Sprintf("%s completed %d times", aPath, n))
+			}
+		}
+	}
+	var unexpected []string
+	for aPath := range completed {
+		if !expected[aPath] {
+			unexpected = append(unexpected, aPath)
+		}
+	}
+	sort.Strings(unexpected)
+	for _, aPath := range unexpected {
+		e.Append(fmt.Sprintf("unexpected path %s completed", aPath))
+	}
+	return errorOf(&e)
+}
+
+// replayPromotions promotes each build once more, which should complete nothing as all the paths are in the
+// target with the same content
+func replayPromotions(indyURL, targetStore string, builds []*stressBuild) error {
+	var e common.MultiError
+	for _, b := range builds {
+		respText, code, succeeded := promote(indyURL, b.source, targetStore, b.paths, false, AsyncOptions{})
+		result, _ := ParsePromoteResult(respText)
+		if result.Rejected() {
+			e.Append(fmt.Sprintf("replayed promotion of %s rejected, %s", b.source, result.Reason()))
+		} else if !succeeded {
+			e.Append(fmt.Sprintf("replayed promotion of %s failed, code: %d", b.source, code))
+		} else if len(result.CompletedPaths) > 0 {
+			e.Append(fmt.Sprintf("replayed promotion of %s completed %s", b.source, strings.Join(result.CompletedPaths, ", ")))
+		}
+	}
+	return errorOf(&e)
+}
+
+// checkMetadataVersions checks that each metadata file of the target lists the version of each build expected
+// times. A missing file lists no versions.
+func checkMetadataVersions(indyURL, targetStore string, metaFiles []string, builds []*stressBuild, expected int) error {
+	var e common.MultiError
+	for _, metaPath := range metaFiles {
+		versions, err := metadataVersions(indyURL, targetStore, metaPath)
+		if err != nil {
+			e.Append(fmt.Sprintf("%s: %s", metaPath, err))
+			continue
+		}
+		for _, b := range builds {
+			n := 0
+			for _, v := range versions {
+				if strings.HasSuffix(v, common.REDHAT_+b.newVersion) {
+					n++
+				}
+			}
+			if n != expected {
+				e.Append(fmt.Sprintf("%s lists the version of %s %d times, expected: %d", metaPath, b.name, n, expected))
+			}
+		}
+	}
+	return errorOf(&e)
+}
+
+// checkNoResidue checks that none of the paths of the builds exists in the target
+func checkNoResidue(indyURL, targetStore string, builds []*stressBuild) error {
+	toks := strings.Split(targetStore, ":")
+	var e common.MultiError
+	for _, b := range builds {
+		for _, aPath := range b.paths {
+			if common.HttpExists(common.GetIndyContentUrl(indyURL, toks[0], toks[1], toks[2], aPath)) {
+				e.Append(aPath + " still exists")
+			}
+		}
+	}
+	return errorOf(&e)
+}
+
+// errorOf returns the errors, or nil if there are none
+func errorOf(e *common.MultiError) error {
+	if len(e.Error()) > 0 {
+		return e
+	}
+	return nil
+}
+
+// pollUntil runs the check again and again until it passes or the timeout elapses, and returns the last error
+func pollUntil(opts StressOptions, check func() error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil || time.Since(start)+opts.PollInterval > opts.Timeout {
+			return err
+		}
+		fmt.Printf("Target not as expected yet, attempt: %d, elapsed: %v, %s\n", attempt, time.Since(start).Round(time.Millisecond), err)
+		time.Sleep(opts.PollInterval)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const oldPom = "/org/foo/bar/0.9.0.redhat-00001/bar-0.9.0.redhat-00001.pom"
+
+var buildNameRegexp = regexp.MustCompile(common.BUILD_TEST_ + "[0-9]+")
+
+// newStressBuild "runs" an original build through folo, the record of which is replayed by the stress test
+func newStressBuild(indy *mockindy.Server) common.TrackedContent {
+	indy.Seed("maven:remote:central", "/org/dep/dep/1.0/dep-1.0.jar", []byte("dep-jar"))
+	indy.Seed(target, oldPom, []byte("old-pom"))
+	indy.AddStore("maven:hosted:build-1234", nil)
+	indy.AddStore("maven:group:builds-untested+shared-imports+public", []string{"maven:remote:central"})
+
+	trackURL := indy.URL + "/api/folo/track/build-1234"
+	common.HTTPRequest(trackURL+"/maven/group/builds-untested+shared-imports+public/org/dep/dep/1.0/dep-1.0.jar",
+		common.MethodGet, nil, false, nil, nil, "", false)
+	for _, p := range []string{
+		"/org/foo/bar/1.0.0.redhat-00001/bar-1.0.0.redhat-00001.pom",
+		"/org/foo/bar/1.0.0.redhat-00001/bar-1.0.0.redhat-00001.jar",
+		"/org/foo/baz/1.0.0.redhat-00001/baz-1.0.0.redhat-00001.pom",
+	} {
+		common.HTTPRequest(trackURL+"/maven/hosted/build-1234"+p, common.MethodPut, nil, false,
+			strings.NewReader("content of "+p), nil, "", false)
+	}
+	common.SealFoloRecord(indy.URL, "build-1234")
+	return common.GetFoloRecord(indy.URL, "build-1234")
+}
+
+func TestStress(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	indy.SetEventDelay(50 * time.Millisecond)
+	foloTrackContent := newStressBuild(indy)
+	report.Start("promotetest", nil, "")
+
+	Convey("TestStress", t, func() {
+		metaFiles, _ := affectedMetadata(promotionPaths(foloTrackContent, ""))
+		So(metaFiles, ShouldResemble, []string{"/org/foo/bar/maven-metadata.xml", "/org/foo/baz/maven-metadata.xml"})
+
+		opts := StressOptions{Builds: 2, Copies: 3, ProcessNum: 2, PollInterval: 20 * time.Millisecond, Timeout: 5 * time.Second}
+		So(DoRunStress(indy.URL, indy.URL, "pnc-builds", foloTrackContent, opts), ShouldBeTrue)
+
+		r := report.Current()
+		So(r.Summary.Failed, ShouldEqual, 0)
+		checks := 0
+		for _, res := range r.Results {
+			if strings.HasPrefix(res.Name, "concurrent promotions") || strings.HasPrefix(res.Name, "replayed promotions") ||
+				strings.HasPrefix(res.Name, "versions in metadata") || strings.HasPrefix(res.Name, "rollbacks from") ||
+				strings.HasPrefix(res.Name, "residue in") {
+				checks++
+			}
+		}
+		So(checks, ShouldEqual, 5)
+		// Only the content before the test is left
+		_, exists := indy.Content(target, oldPom)
+		So(exists, ShouldBeTrue)
+		// The repos and folo records of the replayed builds are deleted
+		builds := map[string]bool{}
+		for _, res := range r.Results {
+			if res.Kind == report.KIND_UPLOAD {
+				builds[buildNameRegexp.FindString(res.URL)] = true
+			}
+		}
+		So(len(builds), ShouldEqual, 2)
+		for name := range builds {
+			So(indy.HasStore("maven:hosted:"+name), ShouldBeFalse)
+			_, exists = indy.FoloRecord(name)
+			So(exists, ShouldBeFalse)
+		}
+	})
+}
+
+func TestCheckCompletedOnce(t *testing.T) {
+	Convey("TestCheckCompletedOnce", t, func() {
+		a := &stressBuild{source: "maven:hosted:a", paths: []string{"/a.pom", "/a.jar"}}
+		b := &stressBuild{source: "maven:hosted:b", paths: []string{"/b.pom"}}
+		promotion := func(build *stressBuild, completed ...string) *stressPromotion {
+			return &stressPromotion{build: build, succeeded: true, result: PromoteResult{CompletedPaths: completed, Validations: ValidationResult{Valid: true}}}
+		}
+
+		So(checkCompletedOnce([]*stressBuild{a, b}, []*stressPromotion{
+			promotion(a, "/a.pom"), promotion(a, "/a.jar"), promotion(b, "/b.pom"), promotion(b),
+		}), ShouldBeNil)
+
+		err := checkCompletedOnce([]*stressBuild{a, b}, []*stressPromotion{
+			promotion(a, "/a.pom", "/a.jar"), promotion(a, "/a.jar", "/c.jar"), promotion(b),
+		})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "/a.jar completed 2 times, /b.pom completed 0 times, unexpected path /c.jar completed")
+	})
+}
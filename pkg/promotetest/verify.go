@@ -0,0 +1,249 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+// CHECKSUM_EXTS are the extensions of the checksum sidecars of a path, which indy generates if not promoted
+var CHECKSUM_EXTS = []string{common.EXT_MD5, common.EXT_SHA1, common.EXT_SHA256}
+
+/*
+ * VerifyRollback checks that a rolled back promotion leaves nothing behind, path by path. promoteResult is the
+ * result of the promotion, not the rollback. For each completed path, it checks that:
+ *   1. the path is gone from the target store (404);
+ *   2. the checksum sidecars of it are gone from the target store;
+ *   3. the path is back in the source store, if the promotion purged the source;
+ *   4. the path is still an upload to the source store in the folo record of the build, if foloTrackId is not
+ *      empty, i.e, the rollback does not touch the tracking of the build.
+ * Then it checks that the metadata affected by the paths in metaGroup, e.g, "builds-untested+shared-imports+public"
+ * or "maven:group:public", does not list the rolled back versions any more. The checks are repeated until all pass
+ * or the timeout elapses, as indy regenerates the metadata asynchronously. Each path and each metadata file is a
+ * result in the report.
+ */
+func VerifyRollback(indyURL, promoteResult, foloTrackId, metaGroup string, interval, timeout time.Duration) bool {
+	start := time.Now()
+	promoted, err := ParsePromoteResult(promoteResult)
+	if err != nil {
+		report.RecordCheck(report.KIND_ROLLBACK, "rollback verification", time.Since(start), err)
+		fmt.Printf("Rollback verification failed, %s\n", err)
+		return false
+	}
+	req := promoted.Request
+	if len(promoted.CompletedPaths) == 0 {
+		fmt.Printf("Nothing was promoted from %s to %s, skip rollback verification.\n", req.Source, req.Target)
+		return true
+	}
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+
+	var tracked map[string]bool
+	if foloTrackId != "" {
+		if tracked, err = trackedUploads(indyURL, foloTrackId, req.Source); err != nil {
+			report.RecordCheck(report.KIND_FOLO, foloTrackId+" (rollback)", time.Since(start), err)
+			fmt.Printf("Rollback verification failed, %s\n", err)
+			return false
+		}
+	}
+
+	passed := pollChecks(report.KIND_ROLLBACK, promoted.CompletedPaths, func(aPath string) error {
+		return verifyRolledBackPath(indyURL, req, aPath, foloTrackId, tracked)
+	}, interval, timeout)
+
+	if metaGroup == "" {
+		fmt.Printf("Skip metadata check of rollback, no metadata group specified.\n")
+		return passed
+	}
+	if !strings.Contains(metaGroup, ":") {
+		metaGroup = common.PackageTypeOf(req.Source) + ":group:" + metaGroup
+	}
+	metaFiles, versions := affectedMetadata(promoted.CompletedPaths)
+	return pollChecks(report.KIND_METADATA, metaFiles, func(metaPath string) error {
+		return verifyRolledBackMetadata(indyURL, metaGroup, metaPath, versions[metaPath])
+	}, interval, timeout) && passed
+}
+
+// verifyRolledBackPath checks a path of a rolled back promotion in the target store, the source store and the
+// uploads of the folo record, which are not checked if tracked is nil
+func verifyRolledBackPath(indyURL string, req PromoteRequest, aPath, foloTrackId string, tracked map[string]bool) error {
+	var e common.MultiError
+	if code := contentStatus(indyURL, req.Target, aPath); code != http.StatusNotFound {
+		e.Append(fmt.Sprintf("still in %s, code: %d", req.Target, code))
+	}
+	if !isChecksum(aPath) {
+		for _, ext := range CHECKSUM_EXTS {
+			if code := contentStatus(indyURL, req.Target, aPath+ext); code != http.StatusNotFound {
+				e.Append(fmt.Sprintf("%s still in %s, code: %d", ext, req.Target, code))
+			}
+		}
+	}
+	if req.PurgeSource {
+		if code := contentStatus(indyURL, req.Source, aPath); code != http.StatusOK {
+			e.Append(fmt.Sprintf("not back in %s, code: %d", req.Source, code))
+		}
+	}
+	if tracked != nil && !tracked[aPath] {
+		e.Append(fmt.Sprintf("not an upload to %s in folo record %s", req.Source, foloTrackId))
+	}
+	return errorOf(&e)
+}
+
+// trackedUploads returns the paths uploaded to the store in the folo record
+func trackedUploads(indyURL, foloTrackId, storeKey string) (map[string]bool, error) {
+	var record common.TrackedContent
+	URL := fmt.Sprintf("%s/api/folo/admin/%s/record", indyURL, foloTrackId)
+	if err := common.GetRespAsJSONType(URL, &record); err != nil {
+		return nil, fmt.Errorf("cannot get folo record %s, %s", foloTrackId, err)
+	}
+	tracked := map[string]bool{}
+	for _, up := range record.Uploads {
+		if up.StoreKey == storeKey {
+			tracked[up.Path] = true
+		}
+	}
+	return tracked, nil
+}
+
+// verifyRolledBackMetadata checks that the metadata file of the group does not list the rolled back versions.
+// A missing file lists no versions.
+func verifyRolledBackMetadata(indyURL, metaGroup, metaPath string, versions []string) error {
+	listed, err := metadataVersions(indyURL, metaGroup, metaPath)
+	if err != nil {
+		return err
+	}
+	var left []string
+	for _, v := range versions {
+		if common.Contains(listed, v) {
+			left = append(left, v)
+		}
+	}
+	if len(left) > 0 {
+		return fmt.Errorf("versions still listed in %s: %s", metaGroup, strings.Join(left, ", "))
+	}
+	return nil
+}
+
+// metadataVersions returns the versions in the metadata file of the store, with duplicates kept for maven. A
+// missing file lists no versions.
+func metadataVersions(indyURL, storeKey, metaPath string) ([]string, error) {
+	toks := strings.Split(storeKey, ":")
+	URL := common.GetIndyContentUrl(indyURL, toks[0], toks[1], toks[2], metaPath)
+	content, code, succeeded := common.HTTPRequest(URL, common.MethodGet, nil, true, nil, nil, "", false)
+	if !succeeded {
+		if code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot get %s, code: %d", URL, code)
+	}
+	if toks[0] == common.PACKAGE_TYPE_NPM {
+		return common.NpmMetadataVersions([]byte(content))
+	}
+	return common.MavenMetadataVersions([]byte(content))
+}
+
+// affectedMetadata returns the metadata affected by promoting or rolling back the paths, i.e, the
+// maven-metadata.xml of each pom and the package document of each npm tarball, with the versions of the paths
+// in each of them
+func affectedMetadata(paths []string) ([]string, map[string][]string) {
+	var files []string
+	versions := map[string][]string{}
+	for _, aPath := range paths {
+		var metaPath, version string
+		if strings.HasSuffix(aPath, ".pom") {
+			metaPath = path.Join(path.Dir(path.Dir(aPath)), common.MAVEN_METADATA_XML)
+			version = path.Base(path.Dir(aPath))
+		} else if common.IsNpmTarball(aPath) {
+			packageName := common.NpmPackageName(aPath)
+			metaPath = common.NpmMetadataPath(packageName)
+			version = strings.TrimSuffix(strings.TrimPrefix(path.Base(aPath), path.Base(packageName)+"-"), ".tgz")
+		} else {
+			continue
+		}
+		if _, ok := versions[metaPath]; !ok {
+			files = append(files, metaPath)
+		}
+		if !common.Contains(versions[metaPath], version) {
+			versions[metaPath] = append(versions[metaPath], version)
+		}
+	}
+	return files, versions
+}
+
+// contentStatus returns the status code of the path in the store, or common.StatusUnknown if no response
+func contentStatus(indyURL, storeKey, aPath string) int {
+	toks := strings.Split(storeKey, ":")
+	resp, err := common.DoRequest(common.MethodHead, common.GetIndyContentUrl(indyURL, toks[0], toks[1], toks[2], aPath), nil, nil, nil)
+	if err != nil {
+		return common.StatusUnknown
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func isChecksum(aPath string) bool {
+	for _, ext := range CHECKSUM_EXTS {
+		if strings.HasSuffix(aPath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollChecks runs the check of each name again and again until all pass or the timeout elapses. The time until a
+// check passes, or the last error of it, is recorded in the report. With a zero timeout, each is checked only once.
+func pollChecks(kind string, names []string, check func(name string) error, interval, timeout time.Duration) bool {
+	start := time.Now()
+	pending := names
+	errs := map[string]error{}
+	for attempt := 1; ; attempt++ {
+		var failed []string
+		for _, name := range pending {
+			if errs[name] = check(name); errs[name] != nil {
+				failed = append(failed, name)
+				continue
+			}
+			report.RecordCheck(kind, name+" (rollback)", time.Since(start), nil)
+		}
+		pending = failed
+		if len(pending) == 0 || time.Since(start)+interval > timeout {
+			break
+		}
+		fmt.Printf("Rollback not verified yet, %s: %d, attempt: %d, elapsed: %v\n", kind, len(pending), attempt,
+			time.Since(start).Round(time.Millisecond))
+		time.Sleep(interval)
+	}
+	for _, name := range pending {
+		fmt.Printf("Verify rollback FAILED, %s: %s, %s\n", kind, name, errs[name])
+		report.RecordCheck(kind, name+" (rollback)", time.Since(start), errs[name])
+	}
+	if len(pending) == 0 {
+		fmt.Printf("Verify rollback SUCCESS, %s: %d\n", kind, len(names))
+	}
+	return len(pending) == 0
+}
@@ -0,0 +1,128 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	pom    = "/org/foo/bar/1.0/bar-1.0.pom"
+	public = "maven:group:public"
+)
+
+// promotePurging promotes the paths with purgeSource, so that the rollback moves them back to the source
+func promotePurging(indyURL string, paths []string) string {
+	promoteVars := IndyPromoteVars{Source: source, Target: target, Paths: paths, PurgeSource: true, FireEvents: true}
+	resp, _, _ := common.HTTPRequest(fmt.Sprintf("%s/api/promotion/paths/promote", indyURL), common.MethodPost, nil, true,
+		strings.NewReader(IndyPromoteJSONTemplate(&promoteVars)), nil, "", false)
+	return resp
+}
+
+func rollbackResults() map[string]report.Result {
+	results := map[string]report.Result{}
+	for _, r := range report.Current().Results {
+		if strings.HasSuffix(r.Name, " (rollback)") {
+			results[strings.TrimSuffix(r.Name, " (rollback)")] = r
+		}
+	}
+	return results
+}
+
+func TestVerifyRollback(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+	indy.AddStore(public, []string{target})
+	indy.SetEventDelay(50 * time.Millisecond)
+	upload := func(aPath string) common.TrackedContentEntry {
+		return common.TrackedContentEntry{StoreKey: source, Path: aPath, Effect: "UPLOAD"}
+	}
+	indy.AddFoloRecord(common.TrackedContent{TrackingKey: common.TrackingKey{Id: "build-1"},
+		Uploads: []common.TrackedContentEntry{upload(pom), upload(jar), upload(jar + common.EXT_SHA1)}})
+	indy.AddFoloRecord(common.TrackedContent{TrackingKey: common.TrackingKey{Id: "build-2"},
+		Uploads: []common.TrackedContentEntry{upload(pom), upload(jar + common.EXT_SHA1)}})
+
+	Convey("TestVerifyRollback", t, func() {
+		report.Start("promotetest", nil, "")
+		indy.Seed(source, pom, []byte("pom"))
+		indy.Seed(source, jar, []byte("jar"))
+		indy.Seed(source, jar+common.EXT_SHA1, []byte("sha1 of jar"))
+		resp := promotePurging(indy.URL, []string{pom, jar, jar + common.EXT_SHA1})
+		_, purged := indy.Content(source, jar)
+		So(purged, ShouldBeFalse)
+
+		Convey("Each path and metadata file is verified after the rollback", func() {
+			_, _, success := Rollback(indy.URL, resp, false)
+			So(success, ShouldBeTrue)
+			So(VerifyRollback(indy.URL, resp, "build-1", "public", 10*time.Millisecond, 5*time.Second), ShouldBeTrue)
+
+			results := rollbackResults()
+			So(len(results), ShouldEqual, 4)
+			for _, name := range []string{pom, jar, jar + common.EXT_SHA1} {
+				So(results[name].Kind, ShouldEqual, report.KIND_ROLLBACK)
+				So(results[name].Status, ShouldEqual, report.STATUS_PASSED)
+			}
+			So(results["/org/foo/bar/maven-metadata.xml"].Kind, ShouldEqual, report.KIND_METADATA)
+			So(results["/org/foo/bar/maven-metadata.xml"].Status, ShouldEqual, report.STATUS_PASSED)
+		})
+
+		Convey("The residue is reported per path", func() {
+			_, _, success := Rollback(indy.URL, resp, false)
+			So(success, ShouldBeTrue)
+			indy.Seed(target, jar+common.EXT_MD5, []byte("md5 of jar")) // a sidecar not rolled back
+			indy.Seed(target, pom, []byte("pom"))                       // a path not rolled back
+			common.HTTPRequest(common.GetIndyContentUrl(indy.URL, "maven", "hosted", "build-1", jar), common.MethodDelete,
+				nil, false, nil, nil, "", false) // a path not back in the source
+
+			So(VerifyRollback(indy.URL, resp, "build-2", "public", 10*time.Millisecond, 0), ShouldBeFalse)
+			results := rollbackResults()
+			So(results[pom].Error, ShouldContainSubstring, "still in maven:hosted:pnc-builds, code: 200")
+			So(results[jar].Error, ShouldContainSubstring, ".md5 still in maven:hosted:pnc-builds, code: 200")
+			So(results[jar].Error, ShouldContainSubstring, "not back in maven:hosted:build-1, code: 404")
+			So(results[jar].Error, ShouldContainSubstring, "not an upload to maven:hosted:build-1 in folo record build-2")
+			So(results[jar+common.EXT_SHA1].Status, ShouldEqual, report.STATUS_PASSED)
+			So(results["/org/foo/bar/maven-metadata.xml"].Error, ShouldEqual, "versions still listed in maven:group:public: 1.0")
+		})
+
+		Reset(func() {
+			for _, p := range []string{pom, jar, jar + common.EXT_MD5, jar + common.EXT_SHA1} {
+				common.HTTPRequest(common.GetIndyContentUrl(indy.URL, "maven", "hosted", "pnc-builds", p), common.MethodDelete,
+					nil, false, nil, nil, "", false)
+			}
+		})
+	})
+}
+
+func TestAffectedMetadata(t *testing.T) {
+	Convey("TestAffectedMetadata", t, func() {
+		files, versions := affectedMetadata([]string{
+			"/org/foo/bar/1.0/bar-1.0.pom", "/org/foo/bar/1.0/bar-1.0.jar", "/org/foo/bar/2.0/bar-2.0.pom",
+			"/@scope/foo/-/foo-1.0.0-redhat-00001.tgz", "/@scope/foo/package.json",
+		})
+		So(files, ShouldResemble, []string{"/org/foo/bar/maven-metadata.xml", "/@scope/foo/package.json"})
+		So(versions["/org/foo/bar/maven-metadata.xml"], ShouldResemble, []string{"1.0", "2.0"})
+		So(versions["/@scope/foo/package.json"], ShouldResemble, []string{"1.0.0-redhat-00001"})
+	})
+}
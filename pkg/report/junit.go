@@ -0,0 +1,138 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The JUnit XML schema as rendered by Jenkins junit plugin
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Content string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// JUnit renders the report as JUnit XML. Each suite is a testsuite, and each result is a testcase
+// with classname <suite>.<kind>.
+func (r Report) JUnit() ([]byte, error) {
+	suites := junitTestSuites{
+		Name:     r.Command,
+		Tests:    r.Summary.Total,
+		Failures: r.Summary.Failed,
+		Skipped:  r.Summary.Skipped,
+		Time:     seconds(r.End.Sub(r.Start)),
+	}
+
+	index := make(map[string]int) // suite name -> index in suites.Suites, to keep the order of first occurrence
+	for _, res := range r.Results {
+		i, ok := index[res.Suite]
+		if !ok {
+			i = len(suites.Suites)
+			index[res.Suite] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: res.Suite, Timestamp: res.Time.Format("2006-01-02T15:04:05")})
+		}
+		suite := &suites.Suites[i]
+		suite.Tests++
+
+		tc := junitTestCase{
+			ClassName: res.Suite + "." + res.Kind,
+			Name:      res.Name,
+			Time:      seconds(res.Duration),
+			SystemOut: details(res),
+		}
+		switch res.Status {
+		case STATUS_FAILED:
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: res.Error, Type: res.Kind, Content: res.Error}
+		case STATUS_SKIPPED:
+			suite.Skipped++
+			tc.Skipped = &junitSkipped{Message: res.Error}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	for i := range suites.Suites {
+		var d time.Duration
+		for _, res := range r.Results {
+			if res.Suite == suites.Suites[i].Name {
+				d += res.Duration
+			}
+		}
+		suites.Suites[i].Time = seconds(d)
+	}
+
+	b, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func details(res Result) string {
+	var toks []string
+	if res.URL != "" {
+		toks = append(toks, "url: "+res.URL)
+	}
+	if res.HTTPCode != 0 {
+		toks = append(toks, fmt.Sprintf("http code: %d", res.HTTPCode))
+	}
+	if res.Size != 0 {
+		toks = append(toks, fmt.Sprintf("size: %d", res.Size))
+	}
+	return strings.Join(toks, ", ")
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
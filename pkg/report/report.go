@@ -0,0 +1,232 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	STATUS_PASSED  = "passed"
+	STATUS_FAILED  = "failed"
+	STATUS_SKIPPED = "skipped"
+)
+
+// Kinds of the checks in a run
+const (
+	KIND_DOWNLOAD  = "download"
+	KIND_UPLOAD    = "upload"
+	KIND_METADATA  = "metadata"
+	KIND_FOLO      = "folo"
+	KIND_PROMOTION = "promotion"
+	KIND_ROLLBACK  = "rollback"
+	KIND_CHECKSUM  = "checksum" // a checksum file generated by indy, e.g, .sha1
+	KIND_STEP      = "step"     // a step of a scenario
+	KIND_BUILD     = "build"    // a build of a group build
+	KIND_GROUP     = "group"    // a group build
+	KIND_RULE      = "rule"     // a promotion expected to be rejected by a validation rule
+)
+
+const (
+	REPORT_JSON = "report.json"
+	JUNIT_XML   = "junit.xml"
+)
+
+// Result is the outcome of one check, e.g, downloading an artifact or a promotion step
+type Result struct {
+	Suite    string        `json:"suite"`
+	Kind     string        `json:"kind"`
+	Name     string        `json:"name"`
+	URL      string        `json:"url,omitempty"`
+	Status   string        `json:"status"`
+	HTTPCode int           `json:"httpCode,omitempty"`
+	Size     int64         `json:"size,omitempty"`
+	Duration time.Duration `json:"duration"` // in nanoseconds
+	Error    string        `json:"error,omitempty"`
+	Time     time.Time     `json:"time"`
+}
+
+// Metric is a measured value of a run for tracking the trend, e.g, the latency of indy handling the promotion events
+type Metric struct {
+	Suite string        `json:"suite"`
+	Name  string        `json:"name"`
+	Value time.Duration `json:"value"` // in nanoseconds
+	Time  time.Time     `json:"time"`
+}
+
+type Summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Report is all the results of a command run
+type Report struct {
+	Command string    `json:"command"`
+	Args    []string  `json:"args"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Summary Summary   `json:"summary"`
+	Results []Result  `json:"results"`
+	Metrics []Metric  `json:"metrics,omitempty"`
+}
+
+var (
+	current   = Report{Start: time.Now()}
+	outputDir string
+	suite     string // the default suite, the command name if empty
+	mu        sync.Mutex
+)
+
+// Start resets the report for a new run of the command. Results are only written if outputDir is not empty.
+func Start(command string, args []string, dir string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = Report{Command: command, Args: args, Start: time.Now()}
+	outputDir = dir
+	suite = ""
+}
+
+// SetSuite sets the default suite of the results recorded afterwards, e.g, a step of a scenario. Empty means the
+// command name.
+func SetSuite(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	suite = name
+}
+
+// Record adds a result to the report. The suite defaults to the one set by SetSuite, or the command name.
+func Record(r Result) {
+	mu.Lock()
+	defer mu.Unlock()
+	if r.Suite == "" {
+		r.Suite = suite
+	}
+	if r.Suite == "" {
+		r.Suite = current.Command
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	current.Results = append(current.Results, r)
+}
+
+// RecordMetric adds a measured value to the report
+func RecordMetric(name string, value time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	m := Metric{Suite: suite, Name: name, Value: value, Time: time.Now()}
+	if m.Suite == "" {
+		m.Suite = current.Command
+	}
+	current.Metrics = append(current.Metrics, m)
+}
+
+// RecordTransfer records the result of a download or an upload
+func RecordTransfer(kind, name string, t common.TransferResult) {
+	r := Result{Kind: kind, Name: name, URL: t.URL, Status: STATUS_PASSED, Size: t.Size, Duration: t.Duration}
+	if t.StatusCode != common.StatusUnknown {
+		r.HTTPCode = t.StatusCode
+	}
+	if t.Err != nil {
+		r.Status = STATUS_FAILED
+		r.Error = t.Err.Error()
+	}
+	Record(r)
+}
+
+// RecordCheck records a check which passed if err is nil
+func RecordCheck(kind, name string, duration time.Duration, err error) {
+	r := Result{Kind: kind, Name: name, Status: STATUS_PASSED, Duration: duration}
+	if err != nil {
+		r.Status = STATUS_FAILED
+		r.Error = err.Error()
+	}
+	Record(r)
+}
+
+// Current returns a snapshot of the report, with the summary calculated
+func Current() Report {
+	mu.Lock()
+	defer mu.Unlock()
+	r := current
+	r.Results = append([]Result{}, current.Results...)
+	r.Metrics = append([]Metric(nil), current.Metrics...)
+	r.End = time.Now()
+	r.Summary = Summary{Total: len(r.Results)}
+	for _, res := range r.Results {
+		switch res.Status {
+		case STATUS_PASSED:
+			r.Summary.Passed++
+		case STATUS_FAILED:
+			r.Summary.Failed++
+		case STATUS_SKIPPED:
+			r.Summary.Skipped++
+		}
+	}
+	return r
+}
+
+// Write writes the report as report.json and junit.xml to the output dir. It does nothing if no output dir is set.
+func Write() error {
+	mu.Lock()
+	dir := outputDir
+	mu.Unlock()
+	if common.IsEmptyString(dir) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	r := Current()
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(dir, REPORT_JSON), b, 0644); err != nil {
+		return err
+	}
+	b, err = r.JUnit()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(dir, JUNIT_XML), b, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Report written to %s, total: %d, passed: %d, failed: %d, skipped: %d\n", dir,
+		r.Summary.Total, r.Summary.Passed, r.Summary.Failed, r.Summary.Skipped)
+	return nil
+}
+
+// Exit writes the report and exits the process, which is used instead of os.Exit in the run paths so the
+// results until the failure are not lost
+func Exit(code int) {
+	if err := Write(); err != nil {
+		fmt.Printf("Error: cannot write report, %s\n", err)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,73 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReport(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "report")
+	defer os.RemoveAll(dir)
+
+	Start("build", []string{"http://indy.xyz.com", "build-1"}, dir)
+	RecordTransfer(KIND_DOWNLOAD, "org/foo/bar/1.0/bar-1.0.jar", common.TransferResult{URL: "http://indy/a", StatusCode: 200, Size: 10, Duration: time.Second})
+	RecordTransfer(KIND_UPLOAD, "org/foo/bar/1.0/bar-1.0.pom", common.TransferResult{URL: "http://indy/b", StatusCode: common.StatusUnknown, Err: fmt.Errorf("connection refused")})
+	Record(Result{Suite: "promotion", Kind: KIND_PROMOTION, Name: "a -> b", Status: STATUS_SKIPPED, Error: "dry run"})
+
+	Convey("TestReport", t, func() {
+		r := Current()
+		So(r.Summary, ShouldResemble, Summary{Total: 3, Passed: 1, Failed: 1, Skipped: 1})
+		So(r.Results[0].Suite, ShouldEqual, "build")
+		So(r.Results[1].HTTPCode, ShouldEqual, 0)
+
+		So(Write(), ShouldBeNil)
+		var fromJSON Report
+		So(json.Unmarshal(common.ReadByteFromFile(path.Join(dir, REPORT_JSON)), &fromJSON), ShouldBeNil)
+		So(len(fromJSON.Results), ShouldEqual, 3)
+		So(fromJSON.Results[0].Duration, ShouldEqual, time.Second)
+
+		var suites junitTestSuites
+		So(xml.Unmarshal(common.ReadByteFromFile(path.Join(dir, JUNIT_XML)), &suites), ShouldBeNil)
+		So(suites.Tests, ShouldEqual, 3)
+		So(suites.Failures, ShouldEqual, 1)
+		So(len(suites.Suites), ShouldEqual, 2)
+		So(suites.Suites[0].Name, ShouldEqual, "build")
+		So(suites.Suites[0].Cases[0].ClassName, ShouldEqual, "build.download")
+		So(suites.Suites[0].Cases[0].Time, ShouldEqual, "1.000")
+		So(suites.Suites[0].Cases[1].Failure.Message, ShouldEqual, "connection refused")
+		So(suites.Suites[1].Cases[0].Skipped, ShouldNotBeNil)
+	})
+}
+
+func TestWriteWithoutDir(t *testing.T) {
+	Start("build", nil, "")
+	Record(Result{Kind: KIND_DOWNLOAD, Name: "x", Status: STATUS_PASSED})
+	Convey("No report is written without output dir", t, func() {
+		So(Write(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,228 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package scenario
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/buildtest"
+	"github.com/commonjava/indy-tests/pkg/cache"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/datest"
+	"github.com/commonjava/indy-tests/pkg/integrationtest"
+	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+// build is the state of a replayed build shared by the steps of a dataset
+type build struct {
+	dataset    integrationtest.Dataset
+	name       string // the build group, hosted repo and folo tracking id, e.g, build-913413
+	newVersion string // the version suffix of the uploads, e.g, 913413
+	promotion  string // the result of the last promotion, for rollback
+}
+
+// Run runs the steps in order and returns true if all the steps and the assertions passed. A failed step skips
+// the following ones except those with 'always'.
+func Run(s *Scenario) bool {
+	r := &runner{scenario: s, datasets: make(map[string]integrationtest.Dataset), builds: make(map[string]*build)}
+	start := time.Now()
+	failed := false
+	for _, step := range s.Steps {
+		if failed && !step.Always {
+			fmt.Printf("Skip step %s, a previous step failed\n", step.Name)
+			report.Record(report.Result{Suite: s.Name, Kind: report.KIND_STEP, Name: step.Name, Status: report.STATUS_SKIPPED,
+				Error: "a previous step failed"})
+			continue
+		}
+		if err := r.runStep(step); err != nil && !step.ContinueOnError {
+			failed = true
+		}
+	}
+	report.SetSuite("")
+
+	if !r.checkAssertions(time.Since(start)) {
+		failed = true
+	}
+	if failed {
+		fmt.Printf("Scenario %s FAILED, elapsed: %v\n", s.Name, time.Since(start))
+		return false
+	}
+	fmt.Printf("Scenario %s SUCCESS, elapsed: %v\n", s.Name, time.Since(start))
+	return true
+}
+
+type runner struct {
+	scenario *Scenario
+	datasets map[string]integrationtest.Dataset // loaded datasets by name
+	builds   map[string]*build                  // replayed builds by dataset name
+}
+
+func (r *runner) runStep(step Step) error {
+	if step.Wait > 0 {
+		fmt.Printf("Waiting %v before step %s...\n", step.Wait, step.Name)
+		time.Sleep(step.Wait)
+	}
+	fmt.Printf("Start step %s\n", step.Name)
+	fmt.Printf("==========================================\n\n")
+	report.SetSuite(r.scenario.Name + "/" + step.Name)
+	start := time.Now()
+	err := r.doStep(step)
+	elapsed := time.Since(start)
+	if err == nil && step.Assert.MaxDuration > 0 && elapsed > step.Assert.MaxDuration {
+		err = fmt.Errorf("took %v, longer than %v", elapsed.Round(time.Millisecond), step.Assert.MaxDuration)
+	}
+	result := report.Result{Suite: r.scenario.Name, Kind: report.KIND_STEP, Name: step.Name, Status: report.STATUS_PASSED, Duration: elapsed}
+	if err != nil {
+		result.Status, result.Error = report.STATUS_FAILED, err.Error()
+		fmt.Printf("Step %s FAILED, elapsed: %v, error: %s\n\n", step.Name, elapsed, err)
+	} else {
+		fmt.Printf("Step %s SUCCESS, elapsed: %v\n\n", step.Name, elapsed)
+	}
+	report.Record(result)
+	return err
+}
+
+func (r *runner) doStep(step Step) error {
+	indyURL := common.NormIndyURL(r.scenario.Targets[step.Target])
+	dryRun := r.scenario.DryRun
+
+	switch step.Type {
+	case STEP_DATEST:
+		return r.datest(indyURL, step)
+
+	case STEP_BUILD:
+		ds := r.dataset(step.Dataset)
+		b := &build{dataset: ds, name: common.GenerateRandomBuildName()}
+		b.newVersion = b.name[len(common.BUILD_TEST_):]
+		r.builds[step.Dataset] = b
+		upload := buildtest.UploadOptions{Stream: step.Stream, MemoryLimit: buildtest.DEFAULT_STREAM_MEMORY_LIMIT,
+			CacheMaxSize: cache.DEFAULT_MAX_SIZE}
+		if !buildtest.DoRun(ds.OriginalIndyBaseUrl(), "", indyURL, ds.PackageType(), b.name, ds.FoloTrackContent, ds.AdditionalRepos,
+			step.Concurrency, step.ClearCache, dryRun, upload, nil, step.Speed) {
+			return fmt.Errorf("build %s failed", b.name)
+		}
+		return nil
+	}
+
+	b := r.builds[step.Dataset]
+	if b == nil {
+		return fmt.Errorf("dataset %s is not built", step.Dataset)
+	}
+	packageType := b.dataset.PackageType()
+	switch step.Type {
+	case STEP_FOLO_CHECK:
+		if dryRun {
+			return nil
+		}
+		if !integrationtest.VerifyFoloRecord(indyURL, b.name, b.dataset.FoloTrackContent) {
+			return fmt.Errorf("folo record %s not matches the original build", b.name)
+		}
+
+	case STEP_METADATA_CHECK:
+		metaFiles := integrationtest.CalculateMetadataFiles(b.dataset.FoloTrackContent)
+		filesLoc := path.Join(integrationtest.TMP_METADATA_DIR, b.name, step.Name)
+		poll := integrationtest.PollOptions{Timeout: step.Timeout, Interval: step.Interval}
+		if dryRun {
+			poll.Timeout = 0
+		}
+		passed, e := integrationtest.PollMetadataAndValidate(indyURL, packageType, step.Repo, metaFiles, filesLoc, b.newVersion,
+			step.Expect == EXPECT_PRESENT, poll)
+		if !passed {
+			return fmt.Errorf("metadata check failed: %s", e.Error())
+		}
+
+	case STEP_PROMOTE:
+		sourceStore, targetStore := integrationtest.GetPromotionSrcTargetStores(packageType, b.name, step.Store, b.dataset.FoloTrackContent)
+		resp, _, success := promotetest.DoRun(indyURL, b.name, sourceStore, targetStore, b.newVersion, b.dataset.FoloTrackContent, dryRun, promotetest.AsyncOptions{})
+		if !success {
+			return fmt.Errorf("promote failed, %s", resp)
+		}
+		b.promotion = resp
+
+	case STEP_ROLLBACK:
+		resp, _, success := promotetest.Rollback(indyURL, b.promotion, dryRun)
+		if !success {
+			return fmt.Errorf("rollback failed, %s", resp)
+		}
+
+	case STEP_CLEANUP:
+		integrationtest.CleanUp(indyURL, packageType, b.name, dryRun)
+	}
+	return nil
+}
+
+func (r *runner) datest(indyURL string, step Step) error {
+	var urls []string
+	if step.DataDir != "" {
+		urls = datest.MetadataURLs(indyURL, step.Group, step.DataDir)
+	} else {
+		urls = integrationtest.AlignmentMetadataURLs(indyURL, r.dataset(step.Dataset), step.Group)
+	}
+	summary := datest.LookupMetadataByRoutines(urls, step.Concurrency).Summary()
+	fmt.Print(summary.Render())
+
+	var e common.MultiError
+	if step.Assert.MaxFailureRate != nil && summary.FailureRate() > *step.Assert.MaxFailureRate {
+		e.Append(fmt.Sprintf("failed lookups %.2f%% > %.2f%%", summary.FailureRate(), *step.Assert.MaxFailureRate))
+	}
+	if p95 := summary.Percentiles["p95"]; step.Assert.MaxP95 > 0 && p95 > step.Assert.MaxP95 {
+		e.Append(fmt.Sprintf("p95 latency %v > %v", p95, step.Assert.MaxP95))
+	}
+	if e.Error() != "" {
+		return &e
+	}
+	return nil
+}
+
+// dataset loads the dataset on first use, and clones the dataset repo if needed
+func (r *runner) dataset(name string) integrationtest.Dataset {
+	if ds, ok := r.datasets[name]; ok {
+		return ds
+	}
+	spec := r.scenario.Datasets[name]
+	dir := spec.Dir
+	if dir == "" {
+		dir = common.DownloadRepo(spec.Repo)
+		fmt.Printf("Clone SUCCESS, dir: %s\n", dir)
+	}
+	ds := integrationtest.LoadDataset(dir, spec.Build)
+	r.datasets[name] = ds
+	return ds
+}
+
+func (r *runner) checkAssertions(elapsed time.Duration) bool {
+	a := r.scenario.Assertions
+	var e common.MultiError
+	if a.MaxFailed != nil {
+		if failed := report.Current().Summary.Failed; failed > *a.MaxFailed {
+			e.Append(fmt.Sprintf("failed results %d > %d", failed, *a.MaxFailed))
+		}
+	}
+	if a.MaxDuration > 0 && elapsed > a.MaxDuration {
+		e.Append(fmt.Sprintf("took %v, longer than %v", elapsed.Round(time.Millisecond), a.MaxDuration))
+	}
+	if e.Error() != "" {
+		fmt.Printf("Scenario %s assertions FAILED: %s\n", r.scenario.Name, e.Error())
+		report.Record(report.Result{Suite: r.scenario.Name, Kind: report.KIND_STEP, Name: "assertions", Status: report.STATUS_FAILED,
+			Duration: elapsed, Error: e.Error()})
+		return false
+	}
+	return true
+}
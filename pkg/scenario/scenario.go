@@ -0,0 +1,276 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package scenario
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/integrationtest"
+	"gopkg.in/yaml.v2"
+)
+
+// Step types
+const (
+	STEP_DATEST         = "datest"         // look up the metadata in da.json of a dataset, or in the alignment reports of dataDir
+	STEP_BUILD          = "build"          // replay the build of a dataset in a new build group and hosted repo
+	STEP_FOLO_CHECK     = "folo-check"     // check the folo record of the replayed build against the original one
+	STEP_METADATA_CHECK = "metadata-check" // check the new version is present or absent in the metadata of the build
+	STEP_PROMOTE        = "promote"        // promote the uploads of the replayed build to a hosted repo
+	STEP_ROLLBACK       = "rollback"       // rollback the last promotion of the build
+	STEP_CLEANUP        = "cleanup"        // delete the build group, the hosted repo and the folo record
+)
+
+// Expectations of a metadata check
+const (
+	EXPECT_PRESENT = "present"
+	EXPECT_ABSENT  = "absent"
+)
+
+var stepTypes = []string{STEP_DATEST, STEP_BUILD, STEP_FOLO_CHECK, STEP_METADATA_CHECK, STEP_PROMOTE, STEP_ROLLBACK, STEP_CLEANUP}
+
+// Scenario is a test flow declared in a YAML file, e.g,
+//
+//	name: integrationtest
+//	targets:
+//	  indy: ${INDY_URL}
+//	datasets:
+//	  build:
+//	    repo: https://gitlab.xyz.com/nos/nos-integrationtest-dataset
+//	    build: "2836"
+//	steps:
+//	  - type: build
+//	  - type: promote
+//	    store: pnc-builds
+//	  - type: cleanup
+//	    always: true
+//
+// Environment variables in the file are expanded, so that a pipeline can pass its parameters.
+type Scenario struct {
+	Name        string                 `yaml:"name"`
+	Targets     map[string]string      `yaml:"targets"`     // name -> indy base url
+	Datasets    map[string]DatasetSpec `yaml:"datasets"`    // name -> build in a dataset repo
+	Concurrency int                    `yaml:"concurrency"` // default routines of the steps
+	DryRun      bool                   `yaml:"dryRun"`
+	Steps       []Step                 `yaml:"steps"`
+	Assertions  Assertions             `yaml:"assertions"`
+}
+
+// DatasetSpec locates a build in a dataset repo, which is cloned from Repo or read from the local Dir
+type DatasetSpec struct {
+	Repo  string `yaml:"repo"`
+	Dir   string `yaml:"dir"`
+	Build string `yaml:"build"`
+}
+
+// Step is an action of the scenario. Target and Dataset can be omitted if there is only one.
+type Step struct {
+	Name        string        `yaml:"name"` // defaults to <index>-<type>
+	Type        string        `yaml:"type"`
+	Target      string        `yaml:"target"`
+	Dataset     string        `yaml:"dataset"`
+	Concurrency int           `yaml:"concurrency"`
+	Wait        time.Duration `yaml:"wait"`   // sleep before the step, e.g, for indy to handle the promotion events
+	Always      bool          `yaml:"always"` // run even if a previous step failed, e.g, cleanup
+	// Go on with the next steps if this one fails. The scenario fails anyway.
+	ContinueOnError bool `yaml:"continueOnError"`
+
+	Group      string `yaml:"group"`      // datest: the DA group, defaults to DA or DA-temporary-builds by the dataset
+	DataDir    string `yaml:"dataDir"`    // datest: the dir of alignment reports, used instead of the dataset
+	ClearCache bool   `yaml:"clearCache"` // build: download the uploads from the original indy again
+	Stream     bool   `yaml:"stream"`     // build: pipe the uploads from the original indy without the local cache
+	Store      string `yaml:"store"`      // promote: the target hosted repo, defaults to pnc-builds
+	Repo       string `yaml:"repo"`       // metadata-check: the repo to get metadata from, e.g, maven:group:builds
+	Expect     string `yaml:"expect"`     // metadata-check: present or absent
+	// metadata-check: check again and again until as expected or the timeout elapses, for indy to handle the
+	// promotion events. Only once if 0.
+	Timeout  time.Duration `yaml:"timeout"`
+	Interval time.Duration `yaml:"interval"` // metadata-check: interval of checking again
+	// build: replay the downloads and uploads at their times in the folo record, speed times faster. As fast as
+	// possible if 0.
+	Speed float64 `yaml:"speed"`
+
+	Assert StepAssertions `yaml:"assert"`
+}
+
+// StepAssertions fail the step if not satisfied, besides the errors of the step itself
+type StepAssertions struct {
+	MaxFailureRate *float64      `yaml:"maxFailureRate"` // datest: max percentage (0 to 100) of failed lookups
+	MaxP95         time.Duration `yaml:"maxP95"`         // datest: max 95th percentile of the lookup latency
+	MaxDuration    time.Duration `yaml:"maxDuration"`
+}
+
+// Assertions on the whole run
+type Assertions struct {
+	MaxFailed   *int          `yaml:"maxFailed"` // max failed results in the report, e.g, downloads or metadata checks
+	MaxDuration time.Duration `yaml:"maxDuration"`
+}
+
+// Load reads the scenario from the YAML file, fills the defaults and validates it
+func Load(fileLoc string) (*Scenario, error) {
+	b, err := ioutil.ReadFile(fileLoc)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses the scenario from YAML, fills the defaults and validates it. Unknown fields are errors, to catch typos.
+func Parse(b []byte) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.UnmarshalStrict([]byte(os.ExpandEnv(string(b))), &s); err != nil {
+		return nil, fmt.Errorf("invalid scenario, %s", err)
+	}
+	s.fillDefaults()
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Scenario) fillDefaults() {
+	if s.Name == "" {
+		s.Name = "scenario"
+	}
+	if s.Concurrency < 1 {
+		s.Concurrency = integrationtest.DEFAULT_ROUTINES
+	}
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("%d-%s", i+1, step.Type)
+		}
+		if step.Concurrency < 1 {
+			step.Concurrency = s.Concurrency
+		}
+		if step.Target == "" {
+			step.Target = onlyKey(s.Targets)
+		}
+		if step.Dataset == "" && step.DataDir == "" {
+			step.Dataset = onlyKey(s.Datasets)
+		}
+	}
+}
+
+// onlyKey returns the key if the map has only one, otherwise empty
+func onlyKey(m interface{}) string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]string:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]DatasetSpec:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 1 {
+		return keys[0]
+	}
+	return ""
+}
+
+// Validate checks the scenario without running it, including the order of the steps, e.g, a promote step must
+// follow a build step of the same dataset.
+func (s *Scenario) Validate() error {
+	var e common.MultiError
+	if len(s.Targets) == 0 {
+		e.Append("no targets")
+	}
+	if len(s.Steps) == 0 {
+		e.Append("no steps")
+	}
+	var names []string
+	for name := range s.Datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ds := s.Datasets[name]
+		if ds.Repo == "" && ds.Dir == "" {
+			e.Append(fmt.Sprintf("dataset %s: repo or dir is required", name))
+		}
+		if ds.Build == "" {
+			e.Append(fmt.Sprintf("dataset %s: build is required", name))
+		}
+	}
+
+	built := make(map[string]bool)
+	promoted := make(map[string]bool)
+	stepNames := make(map[string]bool)
+	for _, step := range s.Steps {
+		prefix := "step " + step.Name
+		if stepNames[step.Name] {
+			e.Append(prefix + ": duplicated name")
+		}
+		stepNames[step.Name] = true
+		if !common.Contains(stepTypes, step.Type) {
+			e.Append(fmt.Sprintf("%s: unknown type '%s', should be one of %v", prefix, step.Type, stepTypes))
+			continue
+		}
+		if _, ok := s.Targets[step.Target]; !ok {
+			e.Append(fmt.Sprintf("%s: unknown target '%s'", prefix, step.Target))
+		}
+		if step.Type == STEP_DATEST && step.DataDir != "" {
+			if step.Group == "" {
+				e.Append(prefix + ": group is required with dataDir")
+			}
+			continue
+		}
+		if _, ok := s.Datasets[step.Dataset]; !ok {
+			e.Append(fmt.Sprintf("%s: unknown dataset '%s'", prefix, step.Dataset))
+			continue
+		}
+
+		switch step.Type {
+		case STEP_BUILD:
+			built[step.Dataset] = true
+		case STEP_FOLO_CHECK, STEP_CLEANUP:
+			if !built[step.Dataset] {
+				e.Append(fmt.Sprintf("%s: no build step of dataset %s before it", prefix, step.Dataset))
+			}
+		case STEP_METADATA_CHECK:
+			if !built[step.Dataset] {
+				e.Append(fmt.Sprintf("%s: no build step of dataset %s before it", prefix, step.Dataset))
+			}
+			if step.Repo == "" {
+				e.Append(prefix + ": repo is required")
+			}
+			if step.Expect != EXPECT_PRESENT && step.Expect != EXPECT_ABSENT {
+				e.Append(fmt.Sprintf("%s: expect should be %s or %s", prefix, EXPECT_PRESENT, EXPECT_ABSENT))
+			}
+		case STEP_PROMOTE:
+			if !built[step.Dataset] {
+				e.Append(fmt.Sprintf("%s: no build step of dataset %s before it", prefix, step.Dataset))
+			}
+			promoted[step.Dataset] = true
+		case STEP_ROLLBACK:
+			if !promoted[step.Dataset] {
+				e.Append(fmt.Sprintf("%s: no promote step of dataset %s before it", prefix, step.Dataset))
+			}
+		}
+	}
+	if e.Error() != "" {
+		return fmt.Errorf("invalid scenario %s: %s", s.Name, e.Error())
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+ *  Copyright (C) 2011-2021 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package scenario
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/dataset"
+	"github.com/commonjava/indy-tests/pkg/mockindy"
+	"github.com/commonjava/indy-tests/pkg/report"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const scenarioYAML = `
+name: it
+targets:
+  indy: ${SCENARIO_TEST_INDY}
+datasets:
+  build:
+    dir: ${SCENARIO_TEST_DATASET}
+    build: build-1234
+steps:
+  - type: datest
+    assert:
+      maxFailureRate: 0
+  - type: build
+    concurrency: 2
+  - type: folo-check
+  - type: metadata-check
+    repo: builds-untested+shared-imports+public
+    expect: %s
+  - type: promote
+  - name: after-promote
+    type: metadata-check
+    repo: builds-untested+shared-imports+public
+    expect: present
+  - type: rollback
+  - type: cleanup
+    always: true
+assertions:
+  maxFailed: 0
+`
+
+func TestParse(t *testing.T) {
+	os.Setenv("SCENARIO_TEST_INDY", "http://indy.xyz.com")
+	os.Setenv("SCENARIO_TEST_DATASET", "/tmp/dataset")
+	defer os.Unsetenv("SCENARIO_TEST_INDY")
+	defer os.Unsetenv("SCENARIO_TEST_DATASET")
+
+	Convey("TestParse", t, func() {
+		s, err := Parse([]byte(strings.Replace(scenarioYAML, "%s", "absent", 1)))
+		So(err, ShouldBeNil)
+		So(s.Targets["indy"], ShouldEqual, "http://indy.xyz.com")
+		So(s.Datasets["build"].Dir, ShouldEqual, "/tmp/dataset")
+		So(len(s.Steps), ShouldEqual, 8)
+		So(s.Steps[0].Name, ShouldEqual, "1-datest")
+		So(*s.Steps[0].Assert.MaxFailureRate, ShouldEqual, 0)
+		So(s.Steps[1].Concurrency, ShouldEqual, 2)
+		So(s.Steps[2].Concurrency, ShouldEqual, 4)
+		So(s.Steps[5].Name, ShouldEqual, "after-promote")
+		So(s.Steps[7].Target, ShouldEqual, "indy")
+		So(s.Steps[7].Dataset, ShouldEqual, "build")
+		So(s.Steps[7].Always, ShouldBeTrue)
+
+		_, err = Parse([]byte("targets: {indy: http://indy}\nsteps:\n  - type: deploy\n    wait: 10s\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "unknown type 'deploy'")
+
+		_, err = Parse([]byte("targets: {indy: http://indy}\nsteps:\n  - type: build\n    concurency: 2\n"))
+		So(err.Error(), ShouldContainSubstring, "concurency")
+
+		_, err = Parse([]byte(`
+targets: {indy: http://indy}
+datasets: {build: {dir: /tmp/dataset, build: "1"}}
+steps:
+  - type: rollback
+  - type: promote
+  - type: build
+  - type: metadata-check
+    expect: exists
+`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "step 1-rollback: no promote step of dataset build before it")
+		So(err.Error(), ShouldContainSubstring, "step 2-promote: no build step of dataset build before it")
+		So(err.Error(), ShouldContainSubstring, "step 4-metadata-check: repo is required")
+		So(err.Error(), ShouldContainSubstring, "step 4-metadata-check: expect should be present or absent")
+	})
+}
+
+// newDataset runs the original build through the folo of the mock indy, and writes it as a dataset
+func newDataset(indy *mockindy.Server, dir string) {
+	indy.Seed("maven:remote:central", "/org/dep/dep/1.0/dep-1.0.jar", []byte("dep-jar"))
+	indy.Seed("maven:hosted:pnc-builds", "/org/foo/bar/0.9.0.redhat-00001/bar-0.9.0.redhat-00001.pom", []byte("old-pom"))
+	indy.AddStore("maven:hosted:build-1234", nil)
+	indy.AddStore("maven:group:DA", []string{"maven:hosted:pnc-builds", "maven:remote:central"})
+
+	trackURL := indy.URL + "/api/folo/track/build-1234"
+	common.HTTPRequest(trackURL+"/maven/group/builds-untested+shared-imports+public/org/dep/dep/1.0/dep-1.0.jar",
+		common.MethodGet, nil, false, nil, nil, "", false)
+	for _, p := range []string{
+		"/org/foo/bar/1.0.0.redhat-00001/bar-1.0.0.redhat-00001.pom",
+		"/org/foo/bar/1.0.0.redhat-00001/bar-1.0.0.redhat-00001.jar",
+	} {
+		common.HTTPRequest(trackURL+"/maven/hosted/build-1234"+p, common.MethodPut, nil, false,
+			strings.NewReader("content of "+p), nil, "", false)
+	}
+	common.SealFoloRecord(indy.URL, "build-1234")
+	tracking, _ := json.Marshal(common.GetFoloRecord(indy.URL, "build-1234"))
+
+	buildDir := path.Join(dir, "build-1234")
+	os.MkdirAll(buildDir, 0755)
+	ioutil.WriteFile(path.Join(buildDir, dataset.INFO_JSON), []byte(`{"buildId": "1234", "buildType": "MVN"}`), 0644)
+	ioutil.WriteFile(path.Join(buildDir, dataset.TRACKING_JSON), tracking, 0644)
+	ioutil.WriteFile(path.Join(buildDir, dataset.DA_JSON), []byte(`["org/foo/bar/maven-metadata.xml", "org/dep/dep/maven-metadata.xml"]`), 0644)
+}
+
+func TestRun(t *testing.T) {
+	indy := mockindy.NewServer()
+	defer indy.Close()
+
+	mountPath, _ := ioutil.TempDir("", "indy-scenario")
+	defer os.RemoveAll(mountPath)
+	os.Setenv(common.ENVAR_TEST_MOUNT_PATH, mountPath)
+	defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+	datasetDir := path.Join(mountPath, "dataset")
+	newDataset(indy, datasetDir)
+	os.Setenv("SCENARIO_TEST_INDY", indy.URL)
+	os.Setenv("SCENARIO_TEST_DATASET", datasetDir)
+	defer os.Unsetenv("SCENARIO_TEST_INDY")
+	defer os.Unsetenv("SCENARIO_TEST_DATASET")
+
+	report.Start("run", nil, "")
+	s, err := Parse([]byte(strings.Replace(scenarioYAML, "%s", "absent", 1)))
+	start := time.Now()
+	passed := Run(s)
+	elapsed := time.Since(start)
+	passedReport := report.Current()
+
+	report.Start("run", nil, "")
+	s, _ = Parse([]byte(strings.Replace(scenarioYAML, "%s", "present", 1)))
+	failed := Run(s)
+	failedReport := report.Current()
+
+	Convey("TestRun", t, func() {
+		So(err, ShouldBeNil)
+		So(passed, ShouldBeTrue)
+		So(elapsed, ShouldBeLessThan, 10*time.Second)
+		So(passedReport.Summary.Failed, ShouldEqual, 0)
+		steps := map[string]string{}
+		suites := map[string]bool{}
+		for _, res := range passedReport.Results {
+			if res.Kind == report.KIND_STEP {
+				steps[res.Name] = res.Status
+			}
+			suites[res.Suite] = true
+		}
+		So(len(steps), ShouldEqual, 8)
+		So(steps["after-promote"], ShouldEqual, report.STATUS_PASSED)
+		So(suites["it/2-build"], ShouldBeTrue)
+		So(suites["it/5-promote"], ShouldBeTrue)
+		So(indy.HasStore("maven:hosted:pnc-builds"), ShouldBeTrue)
+
+		// The metadata check before promotion fails, the following steps are skipped except the cleanup
+		So(failed, ShouldBeFalse)
+		steps = map[string]string{}
+		for _, res := range failedReport.Results {
+			if res.Kind == report.KIND_STEP {
+				steps[res.Name] = res.Status
+			}
+		}
+		So(steps["4-metadata-check"], ShouldEqual, report.STATUS_FAILED)
+		So(steps["5-promote"], ShouldEqual, report.STATUS_SKIPPED)
+		So(steps["7-rollback"], ShouldEqual, report.STATUS_SKIPPED)
+		So(steps["8-cleanup"], ShouldEqual, report.STATUS_PASSED)
+		So(steps["assertions"], ShouldEqual, report.STATUS_FAILED)
+	})
+}